@@ -0,0 +1,61 @@
+// Package authn checks user credentials against the local users table and
+// external directories.
+package authn
+
+import (
+	"errors"
+
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticator checks a username and password and returns the local user
+// they belong to. It fails with ErrInvalidCredentials if they do not match
+// and ErrUserDisabled if the user is disabled.
+type Authenticator interface {
+	Authenticate(username, password string) (*store.User, error)
+}
+
+// Local checks passwords against the bcrypt hashes in the users table.
+type Local struct {
+	users store.UserStore
+}
+
+func NewLocal(users store.UserStore) *Local {
+	return &Local{users: users}
+}
+
+func (a *Local) Authenticate(username, password string) (*store.User, error) {
+	user, err := a.users.GetUserByUsername(username)
+	if errors.Is(err, apperrors.ErrUserNotFound) {
+		return nil, apperrors.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, apperrors.ErrInvalidCredentials
+	}
+
+	if user.Disabled {
+		return nil, apperrors.ErrUserDisabled
+	}
+	return user, nil
+}
+
+// Chain tries each authenticator in turn until one accepts the credentials
+// or fails with an error other than ErrInvalidCredentials.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(username, password string) (*store.User, error) {
+	for _, authenticator := range c {
+		user, err := authenticator.Authenticate(username, password)
+		if !errors.Is(err, apperrors.ErrInvalidCredentials) {
+			return user, err
+		}
+	}
+	return nil, apperrors.ErrInvalidCredentials
+}
@@ -0,0 +1,172 @@
+package authn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"rbac/config"
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapProvider names the directory in user_identities.
+const ldapProvider = "ldap"
+
+const ldapTimeout = 10 * time.Second
+
+var _ Authenticator = (*LDAP)(nil)
+
+// LDAP checks passwords by binding to a directory as the user. Users are
+// created on their first login and linked to their directory username;
+// on every login the roles mapped from groups are set to those of the
+// user's groups.
+type LDAP struct {
+	config     *config.LDAPConfig
+	tlsConfig  *tls.Config
+	users      store.UserStore
+	identities store.IdentityStore
+}
+
+func NewLDAP(ldapConfig *config.LDAPConfig, users store.UserStore, identities store.IdentityStore) (*LDAP, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ldapConfig.CAFile != "" {
+		pem, err := os.ReadFile(ldapConfig.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", ldapConfig.CAFile)
+		}
+	}
+	return &LDAP{config: ldapConfig, tlsConfig: tlsConfig, users: users, identities: identities}, nil
+}
+
+func (a *LDAP) Authenticate(username, password string) (*store.User, error) {
+	// An empty password would make the bind below an unauthenticated one,
+	// which many servers accept.
+	if username == "" || password == "" {
+		return nil, apperrors.ErrInvalidCredentials
+	}
+
+	conn, err := a.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	attributes := []string{a.config.UsernameAttribute}
+	if a.config.GroupFilter == "" {
+		attributes = append(attributes, a.config.GroupAttribute)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(a.config.UserFilter, ldap.EscapeFilter(username)), attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap: searching for %q: %w", username, err)
+	}
+	if err != nil || len(result.Entries) != 1 {
+		return nil, apperrors.ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, apperrors.ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap: binding as %q: %w", entry.DN, err)
+	}
+
+	groups := entry.GetAttributeValues(a.config.GroupAttribute)
+	if a.config.GroupFilter != "" {
+		if groups, err = a.searchGroups(conn, entry.DN); err != nil {
+			return nil, err
+		}
+	}
+
+	var granted, managed []string
+	for group, role := range a.config.GroupRoles {
+		if !slices.Contains(managed, role) {
+			managed = append(managed, role)
+		}
+		if slices.ContainsFunc(groups, func(dn string) bool { return strings.EqualFold(dn, group) }) && !slices.Contains(granted, role) {
+			granted = append(granted, role)
+		}
+	}
+	slices.Sort(granted)
+
+	name := entry.GetAttributeValue(a.config.UsernameAttribute)
+	if name == "" {
+		name = username
+	}
+	return Provision(a.users, a.identities, store.Identity{Provider: ldapProvider, Subject: name}, name, granted, managed)
+}
+
+// connect dials the directory and binds as the search account.
+func (a *LDAP) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(a.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: connecting: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if a.config.StartTLS {
+		if err := conn.StartTLS(a.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: starting TLS: %w", err)
+		}
+	}
+
+	if err := a.bindSearchAccount(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (a *LDAP) bindSearchAccount(conn *ldap.Conn) error {
+	var err error
+	if a.config.BindDN != "" {
+		err = conn.Bind(a.config.BindDN, a.config.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return fmt.Errorf("ldap: binding as search account: %w", err)
+	}
+	return nil
+}
+
+// searchGroups returns the DNs of the groups matching GroupFilter for the
+// user; the search runs as the search account again, as users may not be
+// allowed to read groups.
+func (a *LDAP) searchGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	if err := a.bindSearchAccount(conn); err != nil {
+		return nil, err
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(a.config.GroupFilter, ldap.EscapeFilter(userDN)), []string{"1.1"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: searching groups of %q: %w", userDN, err)
+	}
+
+	var groups []string
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
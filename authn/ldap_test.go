@@ -0,0 +1,298 @@
+package authn
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"rbac/config"
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+const (
+	searchDN  = "cn=search,dc=example,dc=com"
+	aliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+	adminsDN  = "cn=Admins,ou=groups,dc=example,dc=com"
+	editorsDN = "cn=editors,ou=groups,dc=example,dc=com"
+)
+
+// testDirectory is a minimal LDAP server answering simple binds and
+// searches with an equality filter, enough for LDAP to run against.
+type testDirectory struct {
+	mu        sync.Mutex
+	passwords map[string]string
+	uids      map[string]string
+	groups    map[string][]string
+}
+
+func newTestDirectory(t *testing.T) (*testDirectory, string) {
+	t.Helper()
+	d := &testDirectory{
+		passwords: map[string]string{searchDN: "search", aliceDN: "wonderland"},
+		uids:      map[string]string{aliceDN: "alice"},
+		groups:    map[string][]string{adminsDN: {aliceDN}, editorsDN: {aliceDN}},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d, "ldap://" + listener.Addr().String()
+}
+
+// leave removes the user from a group.
+func (d *testDirectory) leave(group, dn string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var members []string
+	for _, member := range d.groups[group] {
+		if member != dn {
+			members = append(members, member)
+		}
+	}
+	d.groups[group] = members
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		d.mu.Lock()
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldapBindRequest:
+			name := string(op.Children[1].Data.Bytes())
+			password := string(op.Children[2].Data.Bytes())
+			code := int64(ldapInvalidCredentials)
+			if want, ok := d.passwords[name]; ok && password != "" && password == want {
+				code = ldapSuccess
+			}
+			responses = append(responses, ldapResult(id, ldapBindResponse, code))
+		case ldapUnbindRequest:
+			d.mu.Unlock()
+			return
+		case ldapSearchRequest:
+			responses = append(d.search(id, op), ldapResult(id, ldapSearchDone, ldapSuccess))
+		}
+		d.mu.Unlock()
+
+		for _, response := range responses {
+			if _, err := conn.Write(response.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (d *testDirectory) search(id int64, op *ber.Packet) []*ber.Packet {
+	filter := op.Children[6]
+	if filter.Tag != ldapEqualityMatch {
+		return nil
+	}
+	attribute := string(filter.Children[0].Data.Bytes())
+	value := string(filter.Children[1].Data.Bytes())
+	var requested []string
+	for _, child := range op.Children[7].Children {
+		requested = append(requested, string(child.Data.Bytes()))
+	}
+
+	var entries []*ber.Packet
+	switch strings.ToLower(attribute) {
+	case "uid":
+		for dn, uid := range d.uids {
+			if uid != value {
+				continue
+			}
+			attributes := map[string][]string{"uid": {uid}}
+			for group, members := range d.groups {
+				for _, member := range members {
+					if member == dn {
+						attributes["memberOf"] = append(attributes["memberOf"], group)
+					}
+				}
+			}
+			entries = append(entries, ldapEntry(id, dn, attributes, requested))
+		}
+	case "member":
+		for group, members := range d.groups {
+			for _, member := range members {
+				if strings.EqualFold(member, value) {
+					entries = append(entries, ldapEntry(id, group, nil, nil))
+				}
+			}
+		}
+	}
+	return entries
+}
+
+const (
+	ldapBindRequest   = 0
+	ldapBindResponse  = 1
+	ldapUnbindRequest = 2
+	ldapSearchRequest = 3
+	ldapSearchEntry   = 4
+	ldapSearchDone    = 5
+	ldapEqualityMatch = 3
+
+	ldapSuccess            = 0
+	ldapInvalidCredentials = 49
+)
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	message.AppendChild(op)
+	return message
+}
+
+func ldapResult(id int64, tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return ldapMessage(id, op)
+}
+
+func ldapEntry(id int64, dn string, attributes map[string][]string, requested []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range attributes {
+		if !containsFold(requested, name) {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+		}
+		attribute.AppendChild(set)
+		list.AppendChild(attribute)
+	}
+	op.AppendChild(list)
+	return ldapMessage(id, op)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestLDAP(t *testing.T, url, groupFilter string) (*LDAP, *store.MemoryStore) {
+	t.Helper()
+	s := newProvisionStore(t)
+	a, err := NewLDAP(&config.LDAPConfig{
+		URL:               url,
+		BindDN:            searchDN,
+		BindPassword:      "search",
+		BaseDN:            "dc=example,dc=com",
+		UserFilter:        "(uid=%s)",
+		UsernameAttribute: "uid",
+		GroupAttribute:    "memberOf",
+		GroupBaseDN:       "ou=groups,dc=example,dc=com",
+		GroupFilter:       groupFilter,
+		GroupRoles: map[string]string{
+			strings.ToLower(adminsDN):  "admin",
+			strings.ToLower(editorsDN): "editor",
+		},
+	}, s, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, s
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	_, url := newTestDirectory(t)
+	a, _ := newTestLDAP(t, url, "")
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  error
+	}{
+		{"valid password", "alice", "wonderland", nil},
+		{"wrong password", "alice", "looking-glass", apperrors.ErrInvalidCredentials},
+		{"empty password", "alice", "", apperrors.ErrInvalidCredentials},
+		{"unknown user", "mallory", "wonderland", apperrors.ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := a.Authenticate(tt.username, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && user.Username != tt.username {
+				t.Errorf("username = %q, want %q", user.Username, tt.username)
+			}
+		})
+	}
+}
+
+func TestLDAPSyncsGroupRoles(t *testing.T) {
+	tests := []struct {
+		name        string
+		groupFilter string
+	}{
+		{"memberOf attribute", ""},
+		{"group search", "(member=%s)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, url := newTestDirectory(t)
+			a, s := newTestLDAP(t, url, tt.groupFilter)
+
+			login := func(want ...string) {
+				t.Helper()
+				user, err := a.Authenticate("alice", "wonderland")
+				if err != nil {
+					t.Fatalf("Authenticate: %v", err)
+				}
+				stored, err := s.GetUser(user.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !sameRoles(stored.Roles, want) {
+					t.Errorf("roles = %v, want %v", stored.Roles, want)
+				}
+			}
+
+			login("admin", "editor")
+
+			d.leave(adminsDN, aliceDN)
+			login("editor")
+
+			d.leave(editorsDN, aliceDN)
+			login()
+		})
+	}
+}
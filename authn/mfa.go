@@ -0,0 +1,310 @@
+package authn
+
+import (
+	"errors"
+	"time"
+
+	"rbac/authz"
+	apperrors "rbac/errors"
+	"rbac/store"
+	"rbac/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// ChallengeTTL is how long a login waits for its second factor.
+	ChallengeTTL = 5 * time.Minute
+	// maxChallengeAttempts bounds the codes one challenge can be answered
+	// with, as six digits are quickly guessed otherwise.
+	maxChallengeAttempts = 5
+	// maxMFAAttempts bounds the codes a user can try in a row, over all
+	// challenges and re-checks, before their codes are refused for
+	// MFALockout.
+	maxMFAAttempts    = 5
+	MFALockout        = 15 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// MFA manages second factors: the codes of a user's authenticator app and
+// their single-use recovery codes, of which only bcrypt hashes are stored.
+// A user needs a second factor to log in once they have confirmed an
+// authenticator, or when a role they hold requires one.
+type MFA struct {
+	store      store.MFAStore
+	authorizer *authz.Authorizer
+	issuer     string
+}
+
+func NewMFA(mfa store.MFAStore, authorizer *authz.Authorizer, issuer string) *MFA {
+	return &MFA{store: mfa, authorizer: authorizer, issuer: issuer}
+}
+
+// Status reports whether the user has confirmed an authenticator, and
+// whether the roles they hold in the tenant require a second factor.
+func (m *MFA) Status(userID, tenantID int) (enabled, required bool, err error) {
+	totp, err := m.store.GetTOTP(userID)
+	if err != nil && !errors.Is(err, apperrors.ErrTOTPNotFound) {
+		return false, false, err
+	}
+	enabled = err == nil && totp.Confirmed
+
+	required, err = m.authorizer.RequiresMFA(userID, tenantID)
+	if err != nil {
+		return false, false, err
+	}
+	return enabled, required, nil
+}
+
+// Challenge starts the second step of a login and returns its token.
+func (m *MFA) Challenge(userID, tenantID int) (string, error) {
+	token, err := utils.RandomID()
+	if err != nil {
+		return "", err
+	}
+	err = m.store.CreateMFAChallenge(store.MFAChallenge{
+		TokenHash: utils.HashToken(token),
+		UserID:    userID,
+		TenantID:  tenantID,
+		ExpiresAt: time.Now().Add(ChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Pending returns the challenge of token while it can be answered, failing
+// with ErrChallengeNotFound otherwise.
+func (m *MFA) Pending(token string) (*store.MFAChallenge, error) {
+	challenge, err := m.store.GetMFAChallenge(utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= maxChallengeAttempts {
+		return nil, apperrors.ErrChallengeNotFound
+	}
+	return challenge, nil
+}
+
+// Answer checks code against the challenge's user and uses the challenge
+// up. A user who has only started enrolling confirms their authenticator
+// with the code and receives recovery codes. A wrong code fails with
+// ErrInvalidMFACode and counts against the challenge and the user.
+func (m *MFA) Answer(token, code string) (*store.MFAChallenge, []string, error) {
+	challenge, err := m.Pending(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recoveryCodes []string
+	err = m.limit(challenge.UserID, func() error {
+		totp, err := m.store.GetTOTP(challenge.UserID)
+		switch {
+		case errors.Is(err, apperrors.ErrTOTPNotFound):
+			return apperrors.ErrInvalidMFACode
+		case err != nil:
+			return err
+		case totp.Confirmed:
+			return m.verify(totp, code)
+		}
+		recoveryCodes, err = m.confirm(totp, code)
+		return err
+	})
+	if errors.Is(err, apperrors.ErrInvalidMFACode) {
+		if _, failErr := m.store.FailMFAChallenge(challenge.TokenHash); failErr != nil {
+			return nil, nil, failErr
+		}
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	used, err := m.store.DeleteMFAChallenge(challenge.TokenHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !used {
+		return nil, nil, apperrors.ErrChallengeNotFound
+	}
+	return challenge, recoveryCodes, nil
+}
+
+// Enroll starts setting up an authenticator for the user, replacing one
+// not confirmed yet, and returns its secret and otpauth URI. It fails with
+// ErrTOTPEnabled if the user already has one.
+func (m *MFA) Enroll(userID int, username string) (string, string, error) {
+	totp, err := m.store.GetTOTP(userID)
+	if err != nil && !errors.Is(err, apperrors.ErrTOTPNotFound) {
+		return "", "", err
+	}
+	if err == nil && totp.Confirmed {
+		return "", "", apperrors.ErrTOTPEnabled
+	}
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := m.store.CreateTOTP(store.TOTP{UserID: userID, Secret: secret}); err != nil {
+		return "", "", err
+	}
+	return secret, TOTPURI(m.issuer, username, secret), nil
+}
+
+// Confirm completes enrollment with a code from the authenticator and
+// returns the user's new recovery codes.
+func (m *MFA) Confirm(userID int, code string) ([]string, error) {
+	totp, err := m.store.GetTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp.Confirmed {
+		return nil, apperrors.ErrTOTPEnabled
+	}
+
+	var codes []string
+	err = m.limit(userID, func() error {
+		codes, err = m.confirm(totp, code)
+		return err
+	})
+	return codes, err
+}
+
+// Verify checks a code from the user's confirmed authenticator or one of
+// their recovery codes, which is then used up. Wrong codes count towards
+// the user's lockout as in Answer.
+func (m *MFA) Verify(userID int, code string) error {
+	totp, err := m.store.GetTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !totp.Confirmed {
+		return apperrors.ErrTOTPNotFound
+	}
+	return m.limit(userID, func() error { return m.verify(totp, code) })
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes.
+func (m *MFA) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	codes, hashes, err := m.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// limit runs check on a code of the user unless they are locked out,
+// failing with ErrMFALocked then. The attempt is counted before the check
+// so that concurrent guesses cannot exceed maxMFAAttempts; the count is
+// cleared when a code passes and the user locked out when the last allowed
+// one does not.
+func (m *MFA) limit(userID int, check func() error) error {
+	lockout, err := m.store.GetMFALockout(userID)
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(lockout.LockedUntil) {
+		return apperrors.ErrMFALocked
+	}
+
+	attempts, err := m.store.AddMFAAttempt(userID)
+	if err != nil {
+		return err
+	}
+	if attempts > maxMFAAttempts {
+		err = apperrors.ErrMFALocked
+	} else if err = check(); err == nil {
+		return m.store.ResetMFAAttempts(userID)
+	}
+	if attempts >= maxMFAAttempts {
+		if lockErr := m.store.LockMFA(userID, time.Now().Add(MFALockout)); lockErr != nil {
+			return lockErr
+		}
+	}
+	return err
+}
+
+func (m *MFA) confirm(totp *store.TOTP, code string) ([]string, error) {
+	if err := m.useTOTPCode(totp, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := m.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.ConfirmTOTP(totp.UserID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (m *MFA) verify(totp *store.TOTP, code string) error {
+	if len(code) == totpDigits {
+		return m.useTOTPCode(totp, code)
+	}
+	return m.useRecoveryCode(totp.UserID, code)
+}
+
+// useTOTPCode accepts a code once; an intercepted code cannot be replayed
+// while it is still valid.
+func (m *MFA) useTOTPCode(totp *store.TOTP, code string) error {
+	step, ok := ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return apperrors.ErrInvalidMFACode
+	}
+	fresh, err := m.store.UseTOTPStep(totp.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return apperrors.ErrInvalidMFACode
+	}
+	return nil
+}
+
+// useRecoveryCode compares code with each of the user's unused recovery
+// codes, as their hashes are salted, and uses up the one it matches.
+func (m *MFA) useRecoveryCode(userID int, code string) error {
+	recoveryCodes, err := m.store.GetRecoveryCodes(userID)
+	if err != nil {
+		return err
+	}
+
+	normalized := []byte(normalizeRecoveryCode(code))
+	for _, recoveryCode := range recoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(recoveryCode.CodeHash), normalized) != nil {
+			continue
+		}
+		used, err := m.store.UseRecoveryCode(userID, recoveryCode.ID)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return apperrors.ErrInvalidMFACode
+		}
+		return nil
+	}
+	return apperrors.ErrInvalidMFACode
+}
+
+func (m *MFA) newRecoveryCodes() ([]string, []string, error) {
+	codes, err := newRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(normalizeRecoveryCode(code)), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		hashes[i] = string(hash)
+	}
+	return codes, hashes, nil
+}
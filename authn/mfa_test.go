@@ -0,0 +1,333 @@
+package authn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"rbac/authz"
+	apperrors "rbac/errors"
+	"rbac/store"
+	"rbac/utils"
+)
+
+func newTestMFA(t *testing.T) (*MFA, *store.MemoryStore) {
+	t.Helper()
+	s := store.NewMemoryStore()
+	authorizer := authz.NewAuthorizer(s, s, s, s, s, authz.NewCache(time.Minute, 100))
+	return NewMFA(s, authorizer, "RBAC"), s
+}
+
+func createMFAUser(t *testing.T, s *store.MemoryStore, username string, roles ...string) int {
+	t.Helper()
+	id, err := s.CreateUser(store.User{Username: username, Password: NoPassword, Roles: roles})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// enroll sets up and confirms an authenticator for the user and returns
+// its secret and the recovery codes.
+func enroll(t *testing.T, m *MFA, userID int) (string, []string) {
+	t.Helper()
+	secret, _, err := m.Enroll(userID, "alice")
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+	codes, err := m.Confirm(userID, totpAt(t, secret, -1))
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	return secret, codes
+}
+
+// totpAt returns the code of the step offset from the current one; codes
+// are accepted once, so each check in a test takes a later step.
+func totpAt(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, time.Now().Unix()/totpPeriod+offset)
+}
+
+func TestMFARequiredByRoles(t *testing.T) {
+	m, s := newTestMFA(t)
+	tenantID, err := s.CreateTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []store.Role{
+		{Name: "ops", RequireMFA: true},
+		{Name: "ops", TenantID: tenantID},
+		{Name: "staff"},
+		{Name: "staff", TenantID: tenantID, RequireMFA: true},
+		{Name: "oncall", Parents: []string{"ops"}},
+	} {
+		if _, err := s.CreateRole(role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		global      []string
+		tenantRoles []string
+		tenantID    int
+		want        bool
+	}{
+		{"global role", []string{"ops"}, nil, 0, true},
+		{"global role shadowed in tenant", []string{"ops"}, nil, tenantID, true},
+		{"inherited global role", []string{"oncall"}, nil, tenantID, true},
+		{"global role without requirement", []string{"staff"}, nil, tenantID, false},
+		{"tenant role", nil, []string{"staff"}, tenantID, true},
+		{"tenant role outside tenant", nil, []string{"staff"}, 0, false},
+		{"tenant role without requirement", nil, []string{"ops"}, tenantID, false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := createMFAUser(t, s, fmt.Sprintf("user%d", i), tt.global...)
+			if tt.tenantRoles != nil {
+				if err := s.SetUserTenantRoles(tenantID, userID, tt.tenantRoles, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			enabled, required, err := m.Status(userID, tt.tenantID)
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+			if enabled || required != tt.want {
+				t.Errorf("Status = %v, %v, want false, %v", enabled, required, tt.want)
+			}
+		})
+	}
+}
+
+func TestMFARecoveryCodes(t *testing.T) {
+	m, s := newTestMFA(t)
+	userID := createMFAUser(t, s, "alice")
+	_, codes := enroll(t, m, userID)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	stored, err := s.GetRecoveryCodes(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range stored {
+		if !strings.HasPrefix(code.CodeHash, "$2a$") {
+			t.Fatalf("code hash %q is not a bcrypt hash", code.CodeHash)
+		}
+	}
+
+	if err := m.Verify(userID, strings.ToUpper(strings.ReplaceAll(codes[3], "-", " "))); err != nil {
+		t.Fatalf("Verify retyped code: %v", err)
+	}
+	if err := m.Verify(userID, codes[3]); !errors.Is(err, apperrors.ErrInvalidMFACode) {
+		t.Fatalf("Verify used code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if left, err := s.CountRecoveryCodes(userID); err != nil || left != recoveryCodeCount-1 {
+		t.Errorf("CountRecoveryCodes = %d, %v, want %d", left, err, recoveryCodeCount-1)
+	}
+}
+
+func TestMFALockout(t *testing.T) {
+	m, s := newTestMFA(t)
+	userID := createMFAUser(t, s, "alice")
+	secret, _ := enroll(t, m, userID)
+
+	// A passing code clears the count.
+	for i := 0; i < maxMFAAttempts-1; i++ {
+		if err := m.Verify(userID, "000000"); !errors.Is(err, apperrors.ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: err = %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+	if err := m.Verify(userID, totpAt(t, secret, 0)); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// Wrong codes count across challenges and re-checks alike.
+	for i := 0; i < maxMFAAttempts; i++ {
+		var err error
+		if i%2 == 0 {
+			err = m.Verify(userID, "000000")
+		} else {
+			token, challengeErr := m.Challenge(userID, 0)
+			if challengeErr != nil {
+				t.Fatal(challengeErr)
+			}
+			_, _, err = m.Answer(token, "000000")
+		}
+		if !errors.Is(err, apperrors.ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: err = %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+
+	if err := m.Verify(userID, totpAt(t, secret, 1)); !errors.Is(err, apperrors.ErrMFALocked) {
+		t.Fatalf("Verify while locked: err = %v, want ErrMFALocked", err)
+	}
+	token, err := m.Challenge(userID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Answer(token, totpAt(t, secret, 1)); !errors.Is(err, apperrors.ErrMFALocked) {
+		t.Fatalf("Answer while locked: err = %v, want ErrMFALocked", err)
+	}
+
+	lockout, err := s.GetMFALockout(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(lockout.LockedUntil); until <= 0 || until > MFALockout {
+		t.Errorf("locked for %v, want up to %v", until, MFALockout)
+	}
+}
+
+func TestMFAAnswer(t *testing.T) {
+	challenge := func(t *testing.T, m *MFA, userID int) string {
+		t.Helper()
+		token, err := m.Challenge(userID, 0)
+		if err != nil {
+			t.Fatalf("Challenge: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name string
+		// setup returns the challenge token and the code to answer it with.
+		setup             func(t *testing.T, m *MFA, s *store.MemoryStore, userID int) (string, string)
+		wantErr           error
+		wantRecoveryCodes bool
+	}{
+		{
+			name: "authenticator code",
+			setup: func(t *testing.T, m *MFA, _ *store.MemoryStore, userID int) (string, string) {
+				secret, _ := enroll(t, m, userID)
+				return challenge(t, m, userID), totpAt(t, secret, 0)
+			},
+		},
+		{
+			name: "recovery code",
+			setup: func(t *testing.T, m *MFA, _ *store.MemoryStore, userID int) (string, string) {
+				_, codes := enroll(t, m, userID)
+				return challenge(t, m, userID), codes[0]
+			},
+		},
+		{
+			name: "code confirms enrollment",
+			setup: func(t *testing.T, m *MFA, _ *store.MemoryStore, userID int) (string, string) {
+				secret, _, err := m.Enroll(userID, "alice")
+				if err != nil {
+					t.Fatalf("Enroll: %v", err)
+				}
+				return challenge(t, m, userID), totpAt(t, secret, 0)
+			},
+			wantRecoveryCodes: true,
+		},
+		{
+			name: "wrong code",
+			setup: func(t *testing.T, m *MFA, _ *store.MemoryStore, userID int) (string, string) {
+				enroll(t, m, userID)
+				return challenge(t, m, userID), "000000"
+			},
+			wantErr: apperrors.ErrInvalidMFACode,
+		},
+		{
+			name: "replayed code",
+			setup: func(t *testing.T, m *MFA, _ *store.MemoryStore, userID int) (string, string) {
+				secret, _ := enroll(t, m, userID)
+				code := totpAt(t, secret, 0)
+				if err := m.Verify(userID, code); err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				return challenge(t, m, userID), code
+			},
+			wantErr: apperrors.ErrInvalidMFACode,
+		},
+		{
+			name: "no authenticator",
+			setup: func(t *testing.T, m *MFA, _ *store.MemoryStore, userID int) (string, string) {
+				return challenge(t, m, userID), "000000"
+			},
+			wantErr: apperrors.ErrInvalidMFACode,
+		},
+		{
+			name: "challenge out of attempts",
+			setup: func(t *testing.T, m *MFA, _ *store.MemoryStore, userID int) (string, string) {
+				secret, _ := enroll(t, m, userID)
+				token := challenge(t, m, userID)
+				for i := 0; i < maxChallengeAttempts; i++ {
+					m.Answer(token, "000000")
+				}
+				return token, totpAt(t, secret, 0)
+			},
+			wantErr: apperrors.ErrChallengeNotFound,
+		},
+		{
+			name: "expired challenge",
+			setup: func(t *testing.T, m *MFA, s *store.MemoryStore, userID int) (string, string) {
+				secret, _ := enroll(t, m, userID)
+				err := s.CreateMFAChallenge(store.MFAChallenge{
+					TokenHash: utils.HashToken("expired"),
+					UserID:    userID,
+					ExpiresAt: time.Now().Add(-time.Second),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return "expired", totpAt(t, secret, 0)
+			},
+			wantErr: apperrors.ErrChallengeNotFound,
+		},
+		{
+			name: "unknown challenge",
+			setup: func(t *testing.T, m *MFA, _ *store.MemoryStore, userID int) (string, string) {
+				secret, _ := enroll(t, m, userID)
+				return "unknown", totpAt(t, secret, 0)
+			},
+			wantErr: apperrors.ErrChallengeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, s := newTestMFA(t)
+			userID := createMFAUser(t, s, "alice")
+			token, code := tt.setup(t, m, s, userID)
+
+			answered, recoveryCodes, err := m.Answer(token, code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Answer: err = %v, want %v", err, tt.wantErr)
+			}
+			if got := len(recoveryCodes) > 0; got != tt.wantRecoveryCodes {
+				t.Errorf("got %d recovery codes, want some: %v", len(recoveryCodes), tt.wantRecoveryCodes)
+			}
+
+			switch {
+			case err == nil:
+				if answered.UserID != userID {
+					t.Errorf("answered challenge of user %d, want %d", answered.UserID, userID)
+				}
+				if _, err := m.Pending(token); !errors.Is(err, apperrors.ErrChallengeNotFound) {
+					t.Errorf("Pending after answer: err = %v, want ErrChallengeNotFound", err)
+				}
+			case errors.Is(err, apperrors.ErrInvalidMFACode):
+				pending, err := m.Pending(token)
+				if err != nil {
+					t.Fatalf("Pending after wrong code: %v", err)
+				}
+				if pending.Attempts != 1 {
+					t.Errorf("attempts = %d, want 1", pending.Attempts)
+				}
+			}
+		})
+	}
+}
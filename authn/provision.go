@@ -0,0 +1,87 @@
+package authn
+
+import (
+	"errors"
+	"slices"
+
+	apperrors "rbac/errors"
+	"rbac/store"
+)
+
+// NoPassword is stored as the password of users created for an external
+// identity; it is not a bcrypt hash, so no password matches it.
+const NoPassword = "!"
+
+// Provision returns the user linked to identity, creating them named
+// username on first sign-in. Of the roles in managed, the ones an external
+// source decides, the user is given those in granted; other roles were
+// assigned here and are kept. A user created by Provision has no password.
+func Provision(users store.UserStore, identities store.IdentityStore, identity store.Identity, username string, granted, managed []string) (*store.User, error) {
+	linked, err := identities.GetIdentity(identity.Provider, identity.Subject)
+	if errors.Is(err, apperrors.ErrIdentityNotFound) {
+		if username == "" {
+			return nil, apperrors.ErrMissingUsername
+		}
+		userID, err := identities.CreateIdentityUser(store.User{
+			Username: username,
+			Password: NoPassword,
+			Roles:    granted,
+		}, identity)
+		if err != nil {
+			return nil, err
+		}
+		return users.GetUser(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := users.GetUser(linked.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, apperrors.ErrUserDisabled
+	}
+
+	// Not nil: an empty list still replaces the user's roles.
+	roles := []string{}
+	for _, role := range user.Roles {
+		if !slices.Contains(managed, role) {
+			roles = append(roles, role)
+		}
+	}
+	roles = append(roles, granted...)
+	conditions := make(map[string]string)
+	for _, role := range roles {
+		if condition, ok := user.RoleConditions[role]; ok {
+			conditions[role] = condition
+		}
+	}
+
+	if !sameRoles(roles, user.Roles) {
+		err := users.UpdateUser(store.User{
+			ID:             user.ID,
+			Username:       user.Username,
+			Roles:          roles,
+			RoleConditions: conditions,
+		})
+		if err != nil {
+			return nil, err
+		}
+		user.Roles, user.RoleConditions = roles, conditions
+	}
+	return user, nil
+}
+
+func sameRoles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, role := range a {
+		if !slices.Contains(b, role) {
+			return false
+		}
+	}
+	return true
+}
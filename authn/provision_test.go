@@ -0,0 +1,96 @@
+package authn
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"rbac/config"
+	apperrors "rbac/errors"
+	"rbac/sso"
+	"rbac/store"
+)
+
+var groupRoles = []config.RoleMapping{
+	{Claim: "groups", Value: "admins", Role: "admin"},
+	{Claim: "groups", Value: "editors", Role: "editor"},
+}
+
+func newProvisionStore(t *testing.T) *store.MemoryStore {
+	t.Helper()
+	s := store.NewMemoryStore()
+	for _, name := range []string{"admin", "editor", "user"} {
+		if _, err := s.CreateRole(store.Role{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestProvisionSyncsMappedRoles(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		groups   []interface{}
+		want     []string
+	}{
+		{"adds a granted role", []string{"editor"}, []interface{}{"admins", "editors"}, []string{"admin", "editor"}},
+		{"removes a group", []string{"admin", "editor"}, []interface{}{"editors"}, []string{"editor"}},
+		{"removes the last group", []string{"admin"}, []interface{}{}, []string{}},
+		{"keeps local roles", []string{"admin", "user"}, nil, []string{"user"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newProvisionStore(t)
+			identity := store.Identity{Provider: "corp", Subject: "alice-1"}
+			if _, err := s.CreateIdentityUser(store.User{Username: "alice", Password: NoPassword, Roles: tt.existing}, identity); err != nil {
+				t.Fatal(err)
+			}
+
+			granted, managed := sso.Claims{"groups": tt.groups}.MapRoles(groupRoles)
+			user, err := Provision(s, s, identity, "alice", granted, managed)
+			if err != nil {
+				t.Fatalf("Provision: %v", err)
+			}
+
+			stored, err := s.GetUser(user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, roles := range [][]string{user.Roles, stored.Roles} {
+				if !sameRoles(roles, tt.want) {
+					t.Errorf("roles = %v, want %v", roles, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestProvisionCreatesUser(t *testing.T) {
+	s := newProvisionStore(t)
+	identity := store.Identity{Provider: "corp", Subject: "bob-1"}
+
+	if _, err := Provision(s, s, identity, "", []string{"editor"}, []string{"editor"}); !errors.Is(err, apperrors.ErrMissingUsername) {
+		t.Fatalf("without username: err = %v, want ErrMissingUsername", err)
+	}
+
+	user, err := Provision(s, s, identity, "bob", []string{"editor"}, []string{"editor"})
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	if user.Username != "bob" || !slices.Equal(user.Roles, []string{"editor"}) {
+		t.Errorf("user = %q with %v, want bob with [editor]", user.Username, user.Roles)
+	}
+	if user.Password != NoPassword {
+		t.Errorf("password = %q, want NoPassword", user.Password)
+	}
+
+	again, err := Provision(s, s, identity, "bob", nil, []string{"editor"})
+	if err != nil {
+		t.Fatalf("second sign-in: %v", err)
+	}
+	if again.ID != user.ID || len(again.Roles) != 0 {
+		t.Errorf("second sign-in: user %d with %v, want %d with no roles", again.ID, again.Roles, user.ID)
+	}
+}
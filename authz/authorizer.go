@@ -0,0 +1,524 @@
+package authz
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	apperrors "rbac/errors"
+	"rbac/store"
+)
+
+type Authorizer struct {
+	users      store.UserStore
+	roles      store.RoleStore
+	groups     store.GroupStore
+	tenants    store.TenantStore
+	bindings   store.BindingStore
+	conditions *conditionCache
+	cache      *Cache
+}
+
+// Request is a single authorization question. Env carries the attributes of
+// the HTTP request that conditions can refer to.
+type Request struct {
+	UserID     int
+	TenantID   int
+	Permission string
+	Resource   *Resource
+	Env        Env
+}
+
+type Env struct {
+	IP      string
+	Method  string
+	Path    string
+	Headers http.Header
+	Time    time.Time
+}
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// DebugPermission lets its holders see the evaluation trace of requests
+// they are denied and look up and explain the decisions of other users.
+const DebugPermission = "debug_authz"
+
+// ManageUsersPermission lets its holders act on other users' accounts, such
+// as revoking all their sessions or resetting their second factor.
+const ManageUsersPermission = "manage_users"
+
+// ManageRolesPermission lets its holders change who is granted what outside
+// of user accounts: permissions, groups, tenants, tenant roles and resource
+// bindings.
+const ManageRolesPermission = "manage_roles"
+
+// ViewKeysPermission lets its holders see the status of the signing keys.
+const ViewKeysPermission = "view_keys"
+
+// ManageClientsPermission lets its holders register and delete the clients
+// of the OpenID Connect provider.
+const ManageClientsPermission = "manage_clients"
+
+// Decision is the outcome of a Request. Rule is the grant that decided it,
+// or nil when no grant of the permission applied.
+type Decision struct {
+	Allowed bool  `json:"allowed"`
+	Rule    *Rule `json:"rule"`
+}
+
+// Rule describes an applied grant: the role assigned to the user, how it is
+// assigned (Source), and the role whose grant matched, which is the
+// assigned role or one of its ancestors.
+type Rule struct {
+	Role                string `json:"role"`
+	Source              string `json:"source"`
+	GrantedBy           string `json:"granted_by"`
+	Permission          string `json:"permission"`
+	Effect              string `json:"effect"`
+	AssignmentCondition string `json:"assignment_condition,omitempty"`
+	GrantCondition      string `json:"grant_condition,omitempty"`
+}
+
+// Explanation is a Decision together with every role assignment of the
+// user that was considered and the grants of the permission each reaches.
+type Explanation struct {
+	Decision
+	Assignments []AssignmentTrace `json:"assignments"`
+}
+
+type AssignmentTrace struct {
+	Role      string       `json:"role"`
+	Source    string       `json:"source"`
+	Condition string       `json:"condition,omitempty"`
+	Holds     bool         `json:"holds"`
+	Error     string       `json:"error,omitempty"`
+	Grants    []GrantTrace `json:"grants"`
+}
+
+type GrantTrace struct {
+	GrantedBy string `json:"granted_by"`
+	Effect    string `json:"effect"`
+	Condition string `json:"condition,omitempty"`
+	Holds     bool   `json:"holds"`
+	Error     string `json:"error,omitempty"`
+}
+
+type assignment struct {
+	roleID    int
+	source    string
+	condition string
+}
+
+// NewAuthorizer returns an Authorizer reading from the given stores. With a
+// non-nil cache, writes must go through an InvalidatingStore sharing it.
+func NewAuthorizer(users store.UserStore, roles store.RoleStore, groups store.GroupStore, tenants store.TenantStore, bindings store.BindingStore, cache *Cache) *Authorizer {
+	return &Authorizer{
+		users:      users,
+		roles:      roles,
+		groups:     groups,
+		tenants:    tenants,
+		bindings:   bindings,
+		conditions: newConditionCache(),
+		cache:      cache,
+	}
+}
+
+// UserRoles returns the roles assigned to the user directly, through the
+// groups they belong to and, when tenantID is set, within that tenant,
+// without duplicates.
+func (a *Authorizer) UserRoles(user *store.User, tenantID int) ([]string, error) {
+	groupRoles, err := a.groupRoles(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantRoles, _, err := a.tenantRoles(user.ID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var roles []string
+	for _, names := range [][]string{user.Roles, groupRoles, tenantRoles} {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				roles = append(roles, name)
+			}
+		}
+	}
+	return roles, nil
+}
+
+// RequiresMFA reports whether a role assigned to the user in the tenant,
+// resolved as for permission checks, requires a second factor at login.
+func (a *Authorizer) RequiresMFA(userID, tenantID int) (bool, error) {
+	sub, err := a.subject(userID, tenantID)
+	if err != nil {
+		return false, err
+	}
+
+	ids := make([]int, len(sub.assigned))
+	for i, assignment := range sub.assigned {
+		ids[i] = assignment.roleID
+	}
+	return sub.graph.RequiresMFA(ids), nil
+}
+
+// HasPermission evaluates the permission for the user within the tenant.
+// Global assignments apply in every tenant; tenant assignments only in
+// their own.
+func (a *Authorizer) HasPermission(userID, tenantID int, permission string) (bool, error) {
+	return a.Check(userID, tenantID, permission, nil)
+}
+
+// Check is HasPermission for a single resource. Besides the user's
+// unscoped roles, the roles of their resource bindings matching the
+// resource count. A nil resource only considers unscoped roles. Conditions
+// see no request attributes; use Authorize when they matter.
+func (a *Authorizer) Check(userID, tenantID int, permission string, resource *Resource) (bool, error) {
+	return a.Authorize(Request{
+		UserID:     userID,
+		TenantID:   tenantID,
+		Permission: permission,
+		Resource:   resource,
+		Env:        Env{Time: time.Now()},
+	})
+}
+
+// Authorize reports whether Decide allows the request.
+func (a *Authorizer) Authorize(req Request) (bool, error) {
+	decision, err := a.Decide(req)
+	return decision.Allowed, err
+}
+
+// Decide evaluates every grant of the permission reachable from a role
+// assignment whose condition holds. Deny overrides allow: the first
+// applicable deny decides, otherwise the first applicable allow does, and
+// with neither the request is denied. A condition that fails to compile or
+// evaluate fails closed: it does not hold for an allow, but a deny whose
+// assignment or grant condition failed still applies.
+func (a *Authorizer) Decide(req Request) (Decision, error) {
+	explanation, err := a.evaluate(req, false)
+	if errors.Is(err, apperrors.ErrUserNotFound) || errors.Is(err, apperrors.ErrTenantNotFound) {
+		return Decision{}, nil
+	}
+	if err != nil {
+		return Decision{}, err
+	}
+	return explanation.Decision, nil
+}
+
+// Explain decides the request like Decide but evaluates every assignment
+// and grant and records them. Unlike Decide it reports an unknown user or
+// tenant as an error.
+func (a *Authorizer) Explain(req Request) (*Explanation, error) {
+	return a.evaluate(req, true)
+}
+
+// AuthorizeAll answers several requests like Authorize, loading the roles
+// of each user and tenant involved only once.
+func (a *Authorizer) AuthorizeAll(reqs []Request) ([]bool, error) {
+	subjects := make(map[[2]int]*subject)
+	allowed := make([]bool, len(reqs))
+	for i, req := range reqs {
+		key := [2]int{req.UserID, req.TenantID}
+		sub, ok := subjects[key]
+		if !ok {
+			var err error
+			sub, err = a.subject(req.UserID, req.TenantID)
+			if errors.Is(err, apperrors.ErrUserNotFound) || errors.Is(err, apperrors.ErrTenantNotFound) {
+				sub = nil
+			} else if err != nil {
+				return nil, err
+			}
+			subjects[key] = sub
+		}
+		if sub != nil {
+			allowed[i] = a.decide(sub, req, false).Allowed
+		}
+	}
+	return allowed, nil
+}
+
+func (a *Authorizer) evaluate(req Request, full bool) (*Explanation, error) {
+	sub, err := a.subject(req.UserID, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	return a.decide(sub, req, full), nil
+}
+
+// decide stops at the first applicable deny unless full is set.
+func (a *Authorizer) decide(sub *subject, req Request, full bool) *Explanation {
+	graph := sub.graph
+	vars := conditionVars(sub.user, req)
+	explanation := &Explanation{Assignments: []AssignmentTrace{}}
+	var allow, deny *Rule
+	for _, assigned := range sub.assignments(req.TenantID, req.Resource) {
+		trace := AssignmentTrace{
+			Role:      graph.Name(assigned.roleID),
+			Source:    assigned.source,
+			Condition: assigned.condition,
+			Grants:    []GrantTrace{},
+		}
+		trace.Holds, trace.Error = a.check(assigned.condition, vars)
+
+		grants := graph.Grants(assigned.roleID, req.Permission)
+		if !trace.Holds && trace.Error == "" && !full {
+			grants = nil
+		}
+		for _, grant := range grants {
+			grantTrace := GrantTrace{
+				GrantedBy: graph.Name(grant.SourceID),
+				Effect:    EffectAllow,
+				Condition: grant.Condition,
+			}
+			if grant.Deny {
+				grantTrace.Effect = EffectDeny
+			}
+			grantTrace.Holds, grantTrace.Error = a.check(grant.Condition, vars)
+			trace.Grants = append(trace.Grants, grantTrace)
+
+			if !applies(trace.Holds, trace.Error, grant.Deny) || !applies(grantTrace.Holds, grantTrace.Error, grant.Deny) {
+				continue
+			}
+
+			rule := &Rule{
+				Role:                trace.Role,
+				Source:              assigned.source,
+				GrantedBy:           grantTrace.GrantedBy,
+				Permission:          req.Permission,
+				Effect:              grantTrace.Effect,
+				AssignmentCondition: assigned.condition,
+				GrantCondition:      grant.Condition,
+			}
+			if grant.Deny && deny == nil {
+				deny = rule
+			}
+			if !grant.Deny && allow == nil {
+				allow = rule
+			}
+		}
+		explanation.Assignments = append(explanation.Assignments, trace)
+
+		if deny != nil && !full {
+			break
+		}
+	}
+
+	switch {
+	case deny != nil:
+		explanation.Decision = Decision{Allowed: false, Rule: deny}
+	case allow != nil:
+		explanation.Decision = Decision{Allowed: true, Rule: allow}
+	}
+	return explanation
+}
+
+// applies reports whether a grant passes a condition that held, or failed
+// with errMsg: failures only let denies through.
+func applies(holds bool, errMsg string, deny bool) bool {
+	return holds || (deny && errMsg != "")
+}
+
+// ValidateCondition reports whether source compiles; an empty source is a
+// missing condition and always valid.
+func ValidateCondition(source string) error {
+	if source == "" {
+		return nil
+	}
+	_, err := CompileCondition(source)
+	return err
+}
+
+// subject holds what evaluation needs to know about a user within a
+// tenant.
+type subject struct {
+	user     *store.User
+	graph    *RoleGraph
+	assigned []assignment
+	bindings []store.ResourceBinding
+}
+
+// CacheStats reports the hits and misses of the subject cache.
+func (a *Authorizer) CacheStats() CacheStats {
+	return a.cache.Stats()
+}
+
+func (a *Authorizer) subject(userID, tenantID int) (*subject, error) {
+	key := subjectKey{userID: userID, tenantID: tenantID}
+	sub, generation := a.cache.get(key)
+	if sub != nil {
+		return sub, nil
+	}
+
+	sub, err := a.loadSubject(userID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	a.cache.put(key, sub, generation)
+	return sub, nil
+}
+
+// loadSubject resolves the user's direct, group and tenant role
+// assignments and fetches their resource bindings. Source is "user",
+// "group <name>", "tenant <id>" or "binding <id>".
+func (a *Authorizer) loadSubject(userID, tenantID int) (*subject, error) {
+	user, err := a.users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := a.roles.GetRoles()
+	if err != nil {
+		return nil, err
+	}
+	graph := NewRoleGraph(roles)
+
+	groups, err := a.groups.GetUserGroups(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantRoles, tenantConditions, err := a.tenantRoles(user.ID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings, err := a.bindings.GetUserResourceBindings(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &subject{user: user, graph: graph, bindings: bindings}
+	add := func(names []string, tenantID int, source string, conditions map[string]string) {
+		for _, name := range names {
+			if id, ok := graph.Lookup(name, tenantID); ok {
+				sub.assigned = append(sub.assigned, assignment{roleID: id, source: source, condition: conditions[name]})
+			}
+		}
+	}
+	add(user.Roles, 0, "user", user.RoleConditions)
+	for _, group := range groups {
+		add(group.Roles, 0, "group "+group.Name, nil)
+	}
+	add(tenantRoles, tenantID, "tenant "+strconv.Itoa(tenantID), tenantConditions)
+	return sub, nil
+}
+
+// assignments returns the subject's unscoped assignments plus those of its
+// bindings matching resource.
+func (s *subject) assignments(tenantID int, resource *Resource) []assignment {
+	if resource == nil {
+		return s.assigned
+	}
+
+	assignments := append([]assignment(nil), s.assigned...)
+	for _, binding := range s.bindings {
+		if bindingApplies(binding, tenantID, *resource) {
+			assignments = append(assignments, assignment{
+				roleID:    binding.RoleID,
+				source:    "binding " + strconv.Itoa(binding.ID),
+				condition: binding.Condition,
+			})
+		}
+	}
+	return assignments
+}
+
+func (a *Authorizer) groupRoles(userID int) ([]string, error) {
+	groups, err := a.groups.GetUserGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	for _, group := range groups {
+		roles = append(roles, group.Roles...)
+	}
+	return roles, nil
+}
+
+func (a *Authorizer) tenantRoles(userID, tenantID int) ([]string, map[string]string, error) {
+	if tenantID == 0 {
+		return nil, nil, nil
+	}
+	return a.tenants.GetUserTenantRoles(tenantID, userID)
+}
+
+// check reports whether the condition holds, and why not when it failed to
+// compile or evaluate. Such failures are also logged.
+func (a *Authorizer) check(source string, vars map[string]interface{}) (bool, string) {
+	if source == "" {
+		return true, ""
+	}
+
+	cond, err := a.conditions.get(source)
+	if err != nil {
+		log.Printf("authz: %v", err)
+		return false, err.Error()
+	}
+
+	result, err := cond.Eval(vars)
+	if err != nil {
+		log.Printf("authz: evaluating %q: %v", source, err)
+		return false, err.Error()
+	}
+	return result, ""
+}
+
+func conditionVars(user *store.User, req Request) map[string]interface{} {
+	attributes := make(map[string]interface{}, len(user.Attributes))
+	for key, value := range user.Attributes {
+		attributes[key] = value
+	}
+
+	headers := make(map[string]interface{}, len(req.Env.Headers))
+	for name, values := range req.Env.Headers {
+		if len(values) > 0 {
+			headers[strings.ToLower(name)] = values[0]
+		}
+	}
+
+	now := req.Env.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var resource interface{}
+	if req.Resource != nil {
+		resource = map[string]interface{}{"type": req.Resource.Type, "id": req.Resource.ID}
+	}
+
+	return map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":         float64(user.ID),
+			"username":   user.Username,
+			"attributes": attributes,
+		},
+		"request": map[string]interface{}{
+			"ip":      req.Env.IP,
+			"method":  req.Env.Method,
+			"path":    req.Env.Path,
+			"headers": headers,
+		},
+		"time": map[string]interface{}{
+			"hour":    float64(now.Hour()),
+			"minute":  float64(now.Minute()),
+			"weekday": float64(now.Weekday()),
+			"date":    now.Format("2006-01-02"),
+			"unix":    float64(now.Unix()),
+		},
+		"tenant": map[string]interface{}{
+			"id": float64(req.TenantID),
+		},
+		"resource": resource,
+	}
+}
@@ -0,0 +1,339 @@
+package authz
+
+import (
+	"fmt"
+	"testing"
+
+	"rbac/store"
+)
+
+// newTestAuthorizer returns an Authorizer over a store with these roles:
+// viewer may view_post, editor inherits from viewer and may edit_post,
+// blocked is denied edit_post, office may delete_post from 10.0.0.0/8 and
+// guarded is denied view_post when user.attributes.level > 3. Members of
+// the group staff get blocked, and tenant acme has its own editor, which
+// may delete_post.
+func newTestAuthorizer(t *testing.T) (*Authorizer, *store.MemoryStore, int, int) {
+	t.Helper()
+	s := store.NewMemoryStore()
+	for _, name := range []string{"view_post", "edit_post", "delete_post"} {
+		if _, err := s.CreatePermission(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tenantID, err := s.CreateTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []store.Role{
+		{Name: "viewer", Permissions: []string{"view_post"}},
+		{Name: "editor", Permissions: []string{"edit_post"}, Parents: []string{"viewer"}},
+		{Name: "blocked", DeniedPermissions: []string{"edit_post"}},
+		{
+			Name:                 "office",
+			Permissions:          []string{"delete_post"},
+			PermissionConditions: map[string]string{"delete_post": `ip_in(request.ip, "10.0.0.0/8")`},
+		},
+		{
+			Name:                 "guarded",
+			DeniedPermissions:    []string{"view_post"},
+			PermissionConditions: map[string]string{"view_post": "user.attributes.level > 3"},
+		},
+		{Name: "editor", TenantID: tenantID, Permissions: []string{"delete_post"}},
+	} {
+		if _, err := s.CreateRole(role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	groupID, err := s.CreateGroup(store.Group{Name: "staff", Roles: []string{"blocked"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthorizer(s, s, s, s, s, nil), s, tenantID, groupID
+}
+
+func TestDecide(t *testing.T) {
+	a, s, tenantID, staffID := newTestAuthorizer(t)
+
+	type want struct {
+		allowed   bool
+		effect    string
+		role      string
+		grantedBy string
+		source    string
+	}
+	tests := []struct {
+		name        string
+		user        store.User
+		staff       bool
+		tenantRoles []string
+		binding     *store.ResourceBinding
+		tenantID    int
+		permission  string
+		resource    *Resource
+		ip          string
+		want        want
+	}{
+		{
+			name:       "no roles",
+			permission: "view_post",
+		},
+		{
+			name:       "direct grant",
+			user:       store.User{Roles: []string{"viewer"}},
+			permission: "view_post",
+			want:       want{true, EffectAllow, "viewer", "viewer", "user"},
+		},
+		{
+			name:       "inherited grant",
+			user:       store.User{Roles: []string{"editor"}},
+			permission: "view_post",
+			want:       want{true, EffectAllow, "editor", "viewer", "user"},
+		},
+		{
+			name:       "permission not granted",
+			user:       store.User{Roles: []string{"viewer"}},
+			permission: "edit_post",
+		},
+		{
+			name:       "deny overrides allow",
+			user:       store.User{Roles: []string{"editor", "blocked"}},
+			permission: "edit_post",
+			want:       want{false, EffectDeny, "blocked", "blocked", "user"},
+		},
+		{
+			name:       "group deny overrides direct allow",
+			user:       store.User{Roles: []string{"editor"}},
+			staff:      true,
+			permission: "edit_post",
+			want:       want{false, EffectDeny, "blocked", "blocked", "group staff"},
+		},
+		{
+			name:       "deny of another permission",
+			user:       store.User{Roles: []string{"editor", "blocked"}},
+			permission: "view_post",
+			want:       want{true, EffectAllow, "editor", "viewer", "user"},
+		},
+		{
+			name:       "grant condition holds",
+			user:       store.User{Roles: []string{"office"}},
+			permission: "delete_post",
+			ip:         "10.1.2.3",
+			want:       want{true, EffectAllow, "office", "office", "user"},
+		},
+		{
+			name:       "grant condition does not hold",
+			user:       store.User{Roles: []string{"office"}},
+			permission: "delete_post",
+			ip:         "192.168.1.1",
+		},
+		{
+			name: "assignment condition holds",
+			user: store.User{
+				Roles:          []string{"viewer"},
+				RoleConditions: map[string]string{"viewer": `user.attributes.department == "support"`},
+				Attributes:     map[string]string{"department": "support"},
+			},
+			permission: "view_post",
+			want:       want{true, EffectAllow, "viewer", "viewer", "user"},
+		},
+		{
+			name: "assignment condition does not hold",
+			user: store.User{
+				Roles:          []string{"viewer"},
+				RoleConditions: map[string]string{"viewer": `user.attributes.department == "support"`},
+				Attributes:     map[string]string{"department": "sales"},
+			},
+			permission: "view_post",
+		},
+		{
+			name: "deny condition does not hold",
+			user: store.User{
+				Roles:      []string{"viewer", "guarded"},
+				Attributes: map[string]string{"level": "1"},
+			},
+			permission: "view_post",
+			want:       want{true, EffectAllow, "viewer", "viewer", "user"},
+		},
+		{
+			name: "failing deny condition denies",
+			user: store.User{
+				Roles:      []string{"viewer", "guarded"},
+				Attributes: map[string]string{"level": "high"},
+			},
+			permission: "view_post",
+			want:       want{false, EffectDeny, "guarded", "guarded", "user"},
+		},
+		{
+			name: "failing allow condition does not allow",
+			user: store.User{
+				Roles:          []string{"viewer"},
+				RoleConditions: map[string]string{"viewer": "user.attributes.level > 3"},
+				Attributes:     map[string]string{"level": "high"},
+			},
+			permission: "view_post",
+		},
+		{
+			name:        "tenant role within tenant",
+			tenantRoles: []string{"editor"},
+			tenantID:    tenantID,
+			permission:  "delete_post",
+			want:        want{true, EffectAllow, "editor", "editor", fmt.Sprintf("tenant %d", tenantID)},
+		},
+		{
+			name:        "tenant role outside tenant",
+			tenantRoles: []string{"editor"},
+			permission:  "delete_post",
+		},
+		{
+			name:       "global role within tenant",
+			user:       store.User{Roles: []string{"editor"}},
+			tenantID:   tenantID,
+			permission: "edit_post",
+			want:       want{true, EffectAllow, "editor", "editor", "user"},
+		},
+		{
+			name:       "binding on matching resource",
+			binding:    &store.ResourceBinding{Role: "viewer", ResourceType: "post", ResourceID: "12*"},
+			permission: "view_post",
+			resource:   &Resource{Type: "post", ID: "123"},
+			want:       want{true, EffectAllow, "viewer", "viewer", "binding"},
+		},
+		{
+			name:       "binding on other resource",
+			binding:    &store.ResourceBinding{Role: "viewer", ResourceType: "post", ResourceID: "12*"},
+			permission: "view_post",
+			resource:   &Resource{Type: "post", ID: "99"},
+		},
+		{
+			name:       "binding without resource",
+			binding:    &store.ResourceBinding{Role: "viewer", ResourceType: "post", ResourceID: "*"},
+			permission: "view_post",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			user.Username = fmt.Sprintf("user%d", i)
+			userID, err := s.CreateUser(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.staff {
+				if err := s.AddGroupMember(staffID, userID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.tenantRoles != nil {
+				if err := s.SetUserTenantRoles(tenantID, userID, tt.tenantRoles, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.binding != nil {
+				binding := *tt.binding
+				binding.UserID = userID
+				if _, err := s.CreateResourceBinding(binding); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			decision, err := a.Decide(Request{
+				UserID:     userID,
+				TenantID:   tt.tenantID,
+				Permission: tt.permission,
+				Resource:   tt.resource,
+				Env:        Env{IP: tt.ip},
+			})
+			if err != nil {
+				t.Fatalf("Decide: %v", err)
+			}
+			if decision.Allowed != tt.want.allowed {
+				t.Errorf("allowed = %v, want %v", decision.Allowed, tt.want.allowed)
+			}
+			if tt.want.effect == "" {
+				if decision.Rule != nil {
+					t.Errorf("rule = %+v, want none", *decision.Rule)
+				}
+				return
+			}
+			if decision.Rule == nil {
+				t.Fatalf("rule = nil, want %s by %s", tt.want.effect, tt.want.role)
+			}
+			rule := decision.Rule
+			if rule.Effect != tt.want.effect || rule.Role != tt.want.role || rule.GrantedBy != tt.want.grantedBy ||
+				!sourceMatches(rule.Source, tt.want.source) || rule.Permission != tt.permission {
+				t.Errorf("rule = %+v, want %s of %s on %s granted by %s through %s",
+					*rule, tt.want.effect, tt.permission, tt.want.role, tt.want.grantedBy, tt.want.source)
+			}
+		})
+	}
+}
+
+// sourceMatches compares a rule's source, taking "binding" to match any
+// binding ID.
+func sourceMatches(source, want string) bool {
+	if want == "binding" {
+		var id int
+		_, err := fmt.Sscanf(source, "binding %d", &id)
+		return err == nil
+	}
+	return source == want
+}
+
+func TestDecideUnknownSubject(t *testing.T) {
+	a, s, _, _ := newTestAuthorizer(t)
+	userID, err := s.CreateUser(store.User{Username: "alice", Roles: []string{"viewer"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		userID   int
+		tenantID int
+	}{
+		{"unknown user", userID + 100, 0},
+		{"unknown tenant", userID, 999},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := a.Decide(Request{UserID: tt.userID, TenantID: tt.tenantID, Permission: "view_post"})
+			if err != nil || decision.Allowed {
+				t.Errorf("Decide = %+v, %v, want denied without error", decision, err)
+			}
+			if _, err := a.Explain(Request{UserID: tt.userID, TenantID: tt.tenantID, Permission: "view_post"}); err == nil {
+				t.Error("Explain: want an error")
+			}
+		})
+	}
+}
+
+func TestExplainEvaluatesPastDeny(t *testing.T) {
+	a, s, _, _ := newTestAuthorizer(t)
+	userID, err := s.CreateUser(store.User{Username: "alice", Roles: []string{"blocked", "editor"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := Request{UserID: userID, Permission: "edit_post"}
+	explanation, err := a.Explain(req)
+	if err != nil {
+		t.Fatalf("Explain: %v", err)
+	}
+	decision, err := a.Decide(req)
+	if err != nil {
+		t.Fatalf("Decide: %v", err)
+	}
+	if explanation.Allowed || decision.Allowed || explanation.Rule.Role != decision.Rule.Role {
+		t.Errorf("Explain decided %+v, Decide %+v; want the same deny", explanation.Decision, decision)
+	}
+	if len(explanation.Assignments) != 2 {
+		t.Fatalf("explained %d assignments, want 2", len(explanation.Assignments))
+	}
+	editor := explanation.Assignments[1]
+	if editor.Role != "editor" || len(editor.Grants) != 1 || editor.Grants[0].Effect != EffectAllow || !editor.Grants[0].Holds {
+		t.Errorf("editor assignment = %+v, want its allow recorded", editor)
+	}
+}
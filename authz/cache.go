@@ -0,0 +1,147 @@
+package authz
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache keeps the subjects loaded for authorization, keyed by user and
+// tenant, so repeated checks for the same user stay off the database.
+// Entries expire after the TTL and the least recently used one is evicted
+// once the cache is full. A nil *Cache caches nothing.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu         sync.Mutex
+	entries    map[subjectKey]*list.Element
+	order      *list.List
+	generation uint64
+	stats      CacheStats
+}
+
+type CacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+}
+
+type subjectKey struct {
+	userID   int
+	tenantID int
+}
+
+type cacheEntry struct {
+	key     subjectKey
+	subject *subject
+	expires time.Time
+}
+
+func NewCache(ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[subjectKey]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// get returns the cached subject, or the generation to pass to put once
+// it has been loaded.
+func (c *Cache) get(key subjectKey) (*subject, uint64) {
+	if c == nil {
+		return nil, 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.order.MoveToFront(elem)
+			c.stats.Hits++
+			return entry.subject, 0
+		}
+		c.remove(elem)
+	}
+	c.stats.Misses++
+	return nil, c.generation
+}
+
+// put stores a subject loaded at generation. It is dropped if the cache
+// was invalidated since, as it may have been read before the change.
+func (c *Cache) put(key subjectKey, sub *subject, generation uint64) {
+	if c == nil || c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	for c.order.Len() >= c.maxEntries {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, subject: sub, expires: time.Now().Add(c.ttl)})
+}
+
+// InvalidateUser drops every entry of the user.
+func (c *Cache) InvalidateUser(userID int) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.stats.Invalidations++
+	for key, elem := range c.entries {
+		if key.userID == userID {
+			c.remove(elem)
+		}
+	}
+}
+
+// InvalidateAll empties the cache, e.g. after a role changed.
+func (c *Cache) InvalidateAll() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.stats.Invalidations++
+	c.entries = make(map[subjectKey]*list.Element)
+	c.order.Init()
+}
+
+func (c *Cache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
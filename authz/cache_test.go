@@ -0,0 +1,184 @@
+package authz
+
+import (
+	"testing"
+	"time"
+
+	"rbac/store"
+)
+
+func TestCacheGetPut(t *testing.T) {
+	c := NewCache(time.Minute, 100)
+	alice := subjectKey{userID: 1}
+	sub := &subject{}
+
+	got, generation := c.get(alice)
+	if got != nil {
+		t.Fatal("hit on an empty cache")
+	}
+	c.put(alice, sub, generation)
+	if got, _ := c.get(alice); got != sub {
+		t.Error("miss after put")
+	}
+	if got, _ := c.get(subjectKey{userID: 1, tenantID: 10}); got != nil {
+		t.Error("hit for another tenant")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 1 {
+		t.Errorf("stats %+v, want 1 hit, 2 misses, 1 entry", stats)
+	}
+}
+
+func TestCacheGeneration(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(c *Cache)
+	}{
+		{"user invalidated", func(c *Cache) { c.InvalidateUser(1) }},
+		{"other user invalidated", func(c *Cache) { c.InvalidateUser(2) }},
+		{"all invalidated", func(c *Cache) { c.InvalidateAll() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(time.Minute, 100)
+			key := subjectKey{userID: 1}
+			// A subject read before a change must not be stored after it.
+			_, generation := c.get(key)
+			tt.invalidate(c)
+			c.put(key, &subject{}, generation)
+			if got, _ := c.get(key); got != nil {
+				t.Error("subject loaded before the invalidation was cached")
+			}
+
+			_, generation = c.get(key)
+			c.put(key, &subject{}, generation)
+			if got, _ := c.get(key); got == nil {
+				t.Error("subject loaded after the invalidation was not cached")
+			}
+		})
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	keys := []subjectKey{{userID: 1}, {userID: 1, tenantID: 10}, {userID: 2}}
+
+	tests := []struct {
+		name       string
+		invalidate func(c *Cache)
+		wantCached []bool
+	}{
+		{"user", func(c *Cache) { c.InvalidateUser(1) }, []bool{false, false, true}},
+		{"unknown user", func(c *Cache) { c.InvalidateUser(3) }, []bool{true, true, true}},
+		{"all", func(c *Cache) { c.InvalidateAll() }, []bool{false, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(time.Minute, 100)
+			for _, key := range keys {
+				_, generation := c.get(key)
+				c.put(key, &subject{}, generation)
+			}
+			tt.invalidate(c)
+			for i, key := range keys {
+				if got, _ := c.get(key); (got != nil) != tt.wantCached[i] {
+					t.Errorf("%+v cached: %v, want %v", key, got != nil, tt.wantCached[i])
+				}
+			}
+			if got := c.Stats().Invalidations; got != 1 {
+				t.Errorf("%d invalidations, want 1", got)
+			}
+		})
+	}
+}
+
+func TestCacheExpiryAndEviction(t *testing.T) {
+	c := NewCache(0, 100)
+	key := subjectKey{userID: 1}
+	_, generation := c.get(key)
+	c.put(key, &subject{}, generation)
+	if got, _ := c.get(key); got != nil {
+		t.Error("hit on an expired entry")
+	}
+
+	c = NewCache(time.Minute, 2)
+	put := func(userID int) {
+		key := subjectKey{userID: userID}
+		_, generation := c.get(key)
+		c.put(key, &subject{}, generation)
+	}
+	put(1)
+	put(2)
+	c.get(subjectKey{userID: 1})
+	put(3)
+	if got, _ := c.get(subjectKey{userID: 2}); got != nil {
+		t.Error("least recently used entry kept")
+	}
+	if got, _ := c.get(subjectKey{userID: 1}); got == nil {
+		t.Error("recently used entry evicted")
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("stats %+v, want 1 eviction, 2 entries", stats)
+	}
+
+	var disabled *Cache
+	disabled.put(key, &subject{}, 0)
+	disabled.InvalidateAll()
+	if got, _ := disabled.get(key); got != nil {
+		t.Error("nil cache returned a subject")
+	}
+}
+
+// Writes through an InvalidatingStore sharing the authorizer's cache are
+// seen by the next check.
+func TestCacheInvalidatedByWrites(t *testing.T) {
+	s := store.NewMemoryStore()
+	for _, perm := range []string{"view_post", "edit_post"} {
+		if _, err := s.CreatePermission(perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.CreateRole(store.Role{Name: "viewer", Permissions: []string{"view_post"}}); err != nil {
+		t.Fatal(err)
+	}
+	editorID, err := s.CreateRole(store.Role{Name: "editor", Permissions: []string{"edit_post"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := s.CreateUser(store.User{Username: "alice", Roles: []string{"viewer"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewCache(time.Minute, 100)
+	a := NewAuthorizer(s, s, s, s, s, cache)
+	writes := NewInvalidatingStore(s, cache)
+
+	check := func(permission string, want bool) {
+		t.Helper()
+		allowed, err := a.HasPermission(userID, 0, permission)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != want {
+			t.Errorf("%s allowed: %v, want %v", permission, allowed, want)
+		}
+	}
+
+	check("edit_post", false)
+	if err := writes.UpdateUser(store.User{ID: userID, Username: "alice", Roles: []string{"viewer", "editor"}}); err != nil {
+		t.Fatal(err)
+	}
+	check("edit_post", true)
+	if err := writes.UpdateRole(store.Role{ID: editorID, Name: "editor", Permissions: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	check("edit_post", false)
+	check("view_post", true)
+
+	if hits := a.CacheStats().Hits; hits == 0 {
+		t.Error("checks never hit the cache")
+	}
+}
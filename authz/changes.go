@@ -0,0 +1,293 @@
+package authz
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"rbac/store"
+)
+
+// Invalidator is told about writes that change authorization. *Cache
+// applies them locally; *ChangeFeed also passes them on to other replicas.
+type Invalidator interface {
+	InvalidateUser(userID int)
+	InvalidateAll()
+}
+
+// PubSub is an optional transport, e.g. Redis or NATS, that carries
+// changes between replicas faster than polling the database.
+type PubSub interface {
+	Publish(ctx context.Context, change store.Change) error
+	// Subscribe calls handle for every change published by any replica,
+	// including this one, until ctx is done.
+	Subscribe(ctx context.Context, handle func(store.Change)) error
+}
+
+// changeRetention is how long recorded changes are kept for replicas to
+// poll.
+const changeRetention = time.Hour
+
+// changeGapTimeout is how long a missing change ID is waited for. IDs are
+// allocated before the insert commits, so a lower ID can become visible
+// after a higher one; one still missing after this was rolled back.
+const changeGapTimeout = time.Minute
+
+// ChangeFeed keeps the caches of several replicas consistent. Changes made
+// on this replica are recorded in the authz_changes table, and published
+// if a PubSub is set; changes recorded by other replicas are picked up by
+// polling the table every interval, or sooner through the PubSub.
+type ChangeFeed struct {
+	changes  store.ChangeStore
+	cache    *Cache
+	pubsub   PubSub
+	interval time.Duration
+
+	mu sync.Mutex
+	// lastID is the ID up to which every change has been applied or given
+	// up on. Polling starts above it, so changes committed after a higher
+	// ID are still found.
+	lastID int
+	// applied holds IDs above lastID that were already applied, because
+	// they were polled, made here or arrived through the PubSub.
+	applied map[int]bool
+	// gaps holds when each missing ID above lastID was first noticed.
+	gaps  map[int]time.Time
+	stale bool
+
+	// ready is set once lastID is known. latest is the ID of the latest
+	// change seen; globalVersion and userVersions those of the latest
+	// changes for every user and for single users.
+	ready         bool
+	latest        int
+	globalVersion int
+	userVersions  map[int]int
+}
+
+func NewChangeFeed(changes store.ChangeStore, cache *Cache, pubsub PubSub, interval time.Duration) *ChangeFeed {
+	return &ChangeFeed{
+		changes:  changes,
+		cache:    cache,
+		pubsub:   pubsub,
+		interval: interval,
+		applied:  make(map[int]bool),
+		gaps:     make(map[int]time.Time),
+
+		userVersions: make(map[int]int),
+	}
+}
+
+// CurrentVersion returns the ID up to which every change has been applied
+// here, which new tokens are stamped with. Changes seen above it, made here
+// or received through the PubSub, may have passed changes of other replicas
+// not polled yet, so tokens never claim them. ok is false while the feed
+// has not started.
+func (f *ChangeFeed) CurrentVersion() (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.lastID, f.ready
+}
+
+// PolicyVersion returns the ID of the latest change seen that affected the
+// user. ok is false while the feed has not started or cannot poll, when
+// changes may be missing.
+func (f *ChangeFeed) PolicyVersion(userID int) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	version := f.globalVersion
+	if v := f.userVersions[userID]; v > version {
+		version = v
+	}
+	return version, f.ready && !f.stale
+}
+
+func (f *ChangeFeed) InvalidateUser(userID int) {
+	f.record(userID)
+}
+
+func (f *ChangeFeed) InvalidateAll() {
+	f.record(0)
+}
+
+// record invalidates the local cache and tells the other replicas. If the
+// change cannot be recorded they only catch up once their entries expire,
+// so the failure is logged, and tokens are not trusted here until polling
+// succeeds again.
+func (f *ChangeFeed) record(userID int) {
+	f.apply(store.Change{UserID: userID})
+
+	id, err := f.changes.RecordChange(userID)
+	if err != nil {
+		log.Printf("authz: recording change: %v", err)
+		f.mu.Lock()
+		f.stale = true
+		f.mu.Unlock()
+		return
+	}
+	change := store.Change{ID: id, UserID: userID}
+
+	f.mu.Lock()
+	f.applied[id] = true
+	f.observe(change)
+	f.mu.Unlock()
+
+	if f.pubsub != nil {
+		if err := f.pubsub.Publish(context.Background(), change); err != nil {
+			log.Printf("authz: publishing change %d: %v", id, err)
+		}
+	}
+}
+
+// Run polls for changes until ctx is done. Changes recorded before Run
+// starts are not applied; the cache holds nothing older than them.
+func (f *ChangeFeed) Run(ctx context.Context) {
+	lastID, err := f.changes.LatestChangeID()
+	if err != nil {
+		log.Printf("authz: reading latest change: %v", err)
+	}
+	// Tokens issued before the start may predate any change up to lastID.
+	f.mu.Lock()
+	f.lastID = lastID
+	f.latest = lastID
+	f.globalVersion = lastID
+	f.ready = err == nil
+	f.stale = err != nil
+	f.mu.Unlock()
+
+	if f.pubsub != nil {
+		go func() {
+			err := f.pubsub.Subscribe(ctx, func(change store.Change) {
+				f.mu.Lock()
+				skip := change.ID <= f.lastID || f.applied[change.ID]
+				f.applied[change.ID] = true
+				f.observe(change)
+				f.mu.Unlock()
+				if !skip {
+					f.apply(change)
+				}
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Printf("authz: change subscription ended: %v", err)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	lastPrune := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		f.poll()
+		if time.Since(lastPrune) >= changeRetention {
+			if err := f.changes.PruneChanges(time.Now().Add(-changeRetention)); err != nil {
+				log.Printf("authz: pruning changes: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+	}
+}
+
+// poll applies the changes recorded since the last poll, and those below
+// them that were still missing then. After a failed poll changes may have
+// been pruned unseen, so everything is invalidated once polling works
+// again.
+func (f *ChangeFeed) poll() {
+	f.mu.Lock()
+	lastID, stale := f.lastID, f.stale
+	f.mu.Unlock()
+
+	changes, err := f.changes.GetChangesSince(lastID)
+	if err != nil {
+		log.Printf("authz: polling changes: %v", err)
+		f.mu.Lock()
+		f.stale = true
+		f.mu.Unlock()
+		return
+	}
+	if stale {
+		// Whatever was missed counts as a change for every user.
+		f.mu.Lock()
+		f.stale = false
+		f.ready = true
+		f.observe(store.Change{ID: f.latest})
+		if len(changes) > 0 {
+			f.observe(store.Change{ID: changes[len(changes)-1].ID})
+		}
+		f.mu.Unlock()
+		f.apply(store.Change{})
+	}
+
+	for _, change := range changes {
+		f.mu.Lock()
+		skip := f.applied[change.ID]
+		f.observe(change)
+		f.mu.Unlock()
+		if !skip {
+			f.apply(change)
+		}
+
+		// Only once applied, as tokens issued from now on are stamped with
+		// the IDs advance reaches.
+		f.mu.Lock()
+		f.applied[change.ID] = true
+		f.mu.Unlock()
+	}
+
+	if len(changes) > 0 {
+		f.mu.Lock()
+		f.advance(changes[len(changes)-1].ID, time.Now())
+		f.mu.Unlock()
+	}
+}
+
+// advance moves lastID up through the applied IDs up to maxID, stopping at
+// the first one missing unless it has been missing for changeGapTimeout;
+// f.mu must be held.
+func (f *ChangeFeed) advance(maxID int, now time.Time) {
+	for id := f.lastID + 1; id <= maxID; id++ {
+		if _, ok := f.gaps[id]; !ok && !f.applied[id] {
+			f.gaps[id] = now
+		}
+	}
+
+	for id := f.lastID + 1; id <= maxID; id++ {
+		if !f.applied[id] && now.Sub(f.gaps[id]) < changeGapTimeout {
+			break
+		}
+		delete(f.applied, id)
+		delete(f.gaps, id)
+		f.lastID = id
+	}
+}
+
+// observe advances the policy versions; f.mu must be held.
+func (f *ChangeFeed) observe(change store.Change) {
+	if change.ID > f.latest {
+		f.latest = change.ID
+	}
+	if change.UserID == 0 {
+		if change.ID > f.globalVersion {
+			f.globalVersion = change.ID
+		}
+		return
+	}
+	if change.ID > f.userVersions[change.UserID] {
+		f.userVersions[change.UserID] = change.ID
+	}
+}
+
+func (f *ChangeFeed) apply(change store.Change) {
+	if change.UserID == 0 {
+		f.cache.InvalidateAll()
+		return
+	}
+	f.cache.InvalidateUser(change.UserID)
+}
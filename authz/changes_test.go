@@ -0,0 +1,240 @@
+package authz
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rbac/store"
+)
+
+// replica is one server's view of a shared store.
+type replica struct {
+	feed   *ChangeFeed
+	policy *TokenPolicy
+}
+
+func newReplica(t *testing.T, s *store.MemoryStore) *replica {
+	t.Helper()
+	cache := NewCache(time.Minute, 100)
+	feed := NewChangeFeed(s, cache, nil, time.Minute)
+	// Run starts the feed and returns, as its context is already done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	feed.Run(ctx)
+	return &replica{feed: feed, policy: NewTokenPolicy(NewAuthorizer(s, s, s, s, s, cache), feed)}
+}
+
+// issue returns the permissions and version of a new token of the user.
+func (r *replica) issue(t *testing.T, userID int) ([]string, int) {
+	t.Helper()
+	permissions, version, err := r.policy.Issue(userID, 0)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return permissions, version
+}
+
+func TestTokenPolicyAcrossReplicas(t *testing.T) {
+	tests := []struct {
+		name string
+		// change revokes alice's role on the replicas b and a, and records
+		// other changes on them, before a issues alice's token.
+		change func(t *testing.T, a, b *replica, alice, bob int)
+	}{
+		{
+			name: "revoked elsewhere, then a local change",
+			change: func(t *testing.T, a, b *replica, alice, bob int) {
+				b.feed.InvalidateUser(alice)
+				a.feed.InvalidateUser(bob)
+			},
+		},
+		{
+			name: "revoked elsewhere, then a local change for everyone",
+			change: func(t *testing.T, a, b *replica, alice, bob int) {
+				b.feed.InvalidateUser(alice)
+				a.feed.InvalidateAll()
+			},
+		},
+		{
+			name: "revoked elsewhere between local changes",
+			change: func(t *testing.T, a, b *replica, alice, bob int) {
+				a.feed.InvalidateUser(bob)
+				b.feed.InvalidateUser(alice)
+				a.feed.InvalidateUser(bob)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			if _, err := s.CreatePermission("view_post"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CreateRole(store.Role{Name: "viewer", Permissions: []string{"view_post"}}); err != nil {
+				t.Fatal(err)
+			}
+			alice, err := s.CreateUser(store.User{Username: "alice", Roles: []string{"viewer"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			bob, err := s.CreateUser(store.User{Username: "bob"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, b := newReplica(t, s), newReplica(t, s)
+
+			// a caches alice's roles.
+			if permissions, _ := a.issue(t, alice); len(permissions) != 1 {
+				t.Fatalf("permissions = %v, want view_post", permissions)
+			}
+
+			if err := s.UpdateUser(store.User{ID: alice, Username: "alice", Roles: []string{}}); err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, a, b, alice, bob)
+
+			// a has not polled the revocation, so it still has alice's old
+			// permissions; the token must not be trusted once it has.
+			permissions, version := a.issue(t, alice)
+			a.feed.poll()
+			if a.policy.Allows(alice, version, permissions, "view_post") {
+				t.Errorf("token issued at version %d with %v trusted after polling the revocation", version, permissions)
+			}
+			if permissions, _ := a.issue(t, alice); len(permissions) != 0 {
+				t.Errorf("permissions after polling = %v, want none", permissions)
+			}
+		})
+	}
+}
+
+func TestTokenPolicyTrustsCurrentTokens(t *testing.T) {
+	s := store.NewMemoryStore()
+	if _, err := s.CreatePermission("view_post"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateRole(store.Role{Name: "viewer", Permissions: []string{"view_post"}}); err != nil {
+		t.Fatal(err)
+	}
+	alice, err := s.CreateUser(store.User{Username: "alice", Roles: []string{"viewer"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.CreateUser(store.User{Username: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := newReplica(t, s), newReplica(t, s)
+
+	tests := []struct {
+		name   string
+		change func()
+		want   bool
+	}{
+		{"no change", func() {}, true},
+		{"another user changed here", func() { a.feed.InvalidateUser(bob) }, true},
+		{"another user changed elsewhere", func() { b.feed.InvalidateUser(bob) }, true},
+		{"user changed here", func() { a.feed.InvalidateUser(alice) }, false},
+		{"user changed elsewhere", func() { b.feed.InvalidateUser(alice) }, false},
+		{"everyone changed elsewhere", func() { b.feed.InvalidateAll() }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.feed.poll()
+			permissions, version := a.issue(t, alice)
+			tt.change()
+			a.feed.poll()
+			if got := a.policy.Allows(alice, version, permissions, "view_post"); got != tt.want {
+				t.Errorf("Allows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// lateChanges hides the changes in hidden from polls, as if their inserts
+// had not committed yet.
+type lateChanges struct {
+	*store.MemoryStore
+	hidden map[int]bool
+}
+
+func (s *lateChanges) GetChangesSince(id int) ([]store.Change, error) {
+	changes, err := s.MemoryStore.GetChangesSince(id)
+	var visible []store.Change
+	for _, change := range changes {
+		if !s.hidden[change.ID] {
+			visible = append(visible, change)
+		}
+	}
+	return visible, err
+}
+
+func TestChangeFeedCommittedOutOfOrder(t *testing.T) {
+	s := &lateChanges{MemoryStore: store.NewMemoryStore(), hidden: make(map[int]bool)}
+	cache := NewCache(time.Minute, 100)
+	feed := NewChangeFeed(s, cache, nil, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	feed.Run(ctx)
+	start, _ := feed.CurrentVersion()
+
+	late, err := s.RecordChange(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.hidden[late] = true
+	other, err := s.RecordChange(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed.poll()
+	if version, _ := feed.CurrentVersion(); version != start {
+		t.Errorf("version %d with change %d missing, want %d", version, late, start)
+	}
+	if version, _ := feed.PolicyVersion(2); version != other {
+		t.Errorf("policy version of user 2 = %d, want %d", version, other)
+	}
+
+	delete(s.hidden, late)
+	invalidations := cache.Stats().Invalidations
+	feed.poll()
+	if got := cache.Stats().Invalidations - invalidations; got != 1 {
+		t.Errorf("%d invalidations for the late change, want 1", got)
+	}
+	if version, _ := feed.PolicyVersion(1); version != late {
+		t.Errorf("policy version of user 1 = %d, want %d", version, late)
+	}
+	if version, _ := feed.CurrentVersion(); version != other {
+		t.Errorf("version %d once every change is applied, want %d", version, other)
+	}
+}
+
+func TestChangeFeedGivesUpOnGaps(t *testing.T) {
+	s := &lateChanges{MemoryStore: store.NewMemoryStore(), hidden: make(map[int]bool)}
+	feed := NewChangeFeed(s, NewCache(time.Minute, 100), nil, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	feed.Run(ctx)
+
+	rolledBack, err := s.RecordChange(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.hidden[rolledBack] = true
+	other, err := s.RecordChange(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed.poll()
+	feed.mu.Lock()
+	feed.gaps[rolledBack] = time.Now().Add(-changeGapTimeout)
+	feed.mu.Unlock()
+	feed.poll()
+	if version, _ := feed.CurrentVersion(); version != other {
+		t.Errorf("version %d after giving up on change %d, want %d", version, rolledBack, other)
+	}
+}
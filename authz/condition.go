@@ -0,0 +1,721 @@
+package authz
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Condition is a compiled boolean expression attached to a role assignment,
+// a resource binding or a role's permission grant. The language is a small
+// CEL-like subset:
+//
+//	literals     "text" 'text' 12 1.5 true false null [a, b]
+//	attributes   user.attributes.department  request.headers["x-device"]
+//	operators    || && ! == != < <= > >= in  (and parentheses)
+//	functions    ip_in(ip, cidr...) starts_with(s, prefix) ends_with(s, suffix)
+//	             contains(s or list, x) lower(s)
+//
+// The root attributes are user, request, time, resource and tenant.
+type Condition struct {
+	source string
+	root   node
+}
+
+var conditionRoots = map[string]bool{
+	"user":     true,
+	"request":  true,
+	"time":     true,
+	"resource": true,
+	"tenant":   true,
+}
+
+var conditionFuncs = map[string]struct {
+	minArgs, maxArgs int
+	call             func(args []interface{}) (interface{}, error)
+}{
+	"ip_in":       {2, -1, ipIn},
+	"starts_with": {2, 2, stringFunc(strings.HasPrefix)},
+	"ends_with":   {2, 2, stringFunc(strings.HasSuffix)},
+	"contains":    {2, 2, contains},
+	"lower":       {1, 1, lower},
+}
+
+func CompileCondition(source string) (*Condition, error) {
+	p := &parser{lexer: lexer{src: source}}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", source, err)
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("invalid condition %q: unexpected %s", source, p.tok)
+	}
+	return &Condition{source: source, root: root}, nil
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
+
+// Eval runs the condition against the attributes. Missing attributes are
+// null; a result that is not a boolean is an error.
+func (c *Condition) Eval(vars map[string]interface{}) (bool, error) {
+	value, err := c.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition %q is not boolean", c.source)
+	}
+	return result, nil
+}
+
+// conditionCache keeps compiled conditions by source so each expression
+// stored in the database is parsed once.
+type conditionCache struct {
+	mu       sync.RWMutex
+	compiled map[string]*Condition
+}
+
+func newConditionCache() *conditionCache {
+	return &conditionCache{compiled: make(map[string]*Condition)}
+}
+
+func (c *conditionCache) get(source string) (*Condition, error) {
+	c.mu.RLock()
+	cond, ok := c.compiled[source]
+	c.mu.RUnlock()
+	if ok {
+		return cond, nil
+	}
+
+	cond, err := CompileCondition(source)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.compiled[source] = cond
+	c.mu.Unlock()
+	return cond, nil
+}
+
+var comparisonOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) scan() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF}, nil
+	}
+
+	start := l.pos
+	ch := l.src[l.pos]
+	switch {
+	case ch == '_' || unicode.IsLetter(rune(ch)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || unicode.IsLetter(rune(l.src[l.pos])) || unicode.IsDigit(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos]}, nil
+
+	case unicode.IsDigit(rune(ch)):
+		for l.pos < len(l.src) && (unicode.IsDigit(rune(l.src[l.pos])) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.src[start:l.pos]}, nil
+
+	case ch == '"' || ch == '\'':
+		var b strings.Builder
+		l.pos++
+		for l.pos < len(l.src) && l.src[l.pos] != ch {
+			if l.src[l.pos] == '\\' && l.pos+1 < len(l.src) {
+				l.pos++
+			}
+			b.WriteByte(l.src[l.pos])
+			l.pos++
+		}
+		if l.pos >= len(l.src) {
+			return token{}, fmt.Errorf("unterminated string")
+		}
+		l.pos++
+		return token{kind: tokString, text: b.String()}, nil
+	}
+
+	for _, op := range []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ",", "."} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op}, nil
+		}
+	}
+	return token{}, fmt.Errorf("unexpected character %q", ch)
+}
+
+// Parser
+
+type parser struct {
+	lexer lexer
+	tok   token
+	err   error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lexer.scan()
+}
+
+func (p *parser) isOp(op string) bool {
+	return p.err == nil && p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if !p.isOp(op) {
+		return fmt.Errorf("expected %q, found %s", op, p.tok)
+	}
+	p.next()
+	return p.err
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "||", left: left, right: right}
+	}
+	return left, p.err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, p.err
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isOp("!") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	var op string
+	switch {
+	case p.tok.kind == tokOp && comparisonOps[p.tok.text]:
+		op = p.tok.text
+	case p.tok.kind == tokIdent && p.tok.text == "in":
+		op = "in"
+	default:
+		return left, p.err
+	}
+	p.next()
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", tok)
+		}
+		return literalNode{value: value}, nil
+
+	case tokString:
+		p.next()
+		return literalNode{value: tok.text}, nil
+
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		}
+		if p.isOp("(") {
+			return p.parseCall(tok.text)
+		}
+		if !conditionRoots[tok.text] {
+			return nil, fmt.Errorf("unknown attribute %s", tok)
+		}
+		return p.parseSelectors(attributeNode{name: tok.text})
+
+	case tokOp:
+		switch tok.text {
+		case "(":
+			p.next()
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		case "[":
+			p.next()
+			var items []node
+			for !p.isOp("]") {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+			return listNode{items: items}, p.expect("]")
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s", tok)
+}
+
+func (p *parser) parseSelectors(target node) (node, error) {
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			if p.err != nil {
+				return nil, p.err
+			}
+			if p.tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected attribute name, found %s", p.tok)
+			}
+			target = selectNode{target: target, key: literalNode{value: p.tok.text}}
+			p.next()
+		case p.isOp("["):
+			p.next()
+			key, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			target = selectNode{target: target, key: key}
+		default:
+			return target, p.err
+		}
+	}
+}
+
+func (p *parser) parseCall(name string) (node, error) {
+	fn, ok := conditionFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	p.next()
+
+	var args []node
+	for !p.isOp(")") {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments to %s", name)
+	}
+	// Literal networks are checked here so that a typo is rejected when the
+	// condition is written instead of failing every evaluation.
+	if name == "ip_in" {
+		for _, arg := range args[1:] {
+			literal, ok := arg.(literalNode)
+			if !ok {
+				continue
+			}
+			cidr, ok := literal.value.(string)
+			if !ok {
+				return nil, fmt.Errorf("ip_in expects CIDR strings")
+			}
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return callNode{name: name, args: args}, nil
+}
+
+// Evaluation
+
+type node interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct{ value interface{} }
+
+type attributeNode struct{ name string }
+
+type selectNode struct {
+	target node
+	key    node
+}
+
+type listNode struct{ items []node }
+
+type notNode struct{ operand node }
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n literalNode) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n attributeNode) eval(vars map[string]interface{}) (interface{}, error) {
+	return vars[n.name], nil
+}
+
+func (n selectNode) eval(vars map[string]interface{}) (interface{}, error) {
+	target, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := target.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key must be a string")
+		}
+		return t[name], nil
+	}
+	return nil, fmt.Errorf("cannot select from %T", target)
+}
+
+func (n listNode) eval(vars map[string]interface{}) (interface{}, error) {
+	items := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+	return items, nil
+}
+
+func (n notNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := evalBool(n.operand, vars)
+	if err != nil {
+		return nil, err
+	}
+	return !value, nil
+}
+
+func (n logicalNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := evalBool(n.left, vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "||" && left {
+		return true, nil
+	}
+	if n.op == "&&" && !left {
+		return false, nil
+	}
+	return evalBool(n.right, vars)
+}
+
+func (n compareNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		items, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("right side of in must be a list")
+		}
+		for _, item := range items {
+			if equal(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if left == nil || right == nil {
+		return false, nil
+	}
+	cmp, err := order(left, right)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func (n callNode) eval(vars map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	return conditionFuncs[n.name].call(args)
+}
+
+func evalBool(n node, vars map[string]interface{}) (bool, error) {
+	value, err := n.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected boolean, got %T", value)
+	}
+	return b, nil
+}
+
+func equal(a, b interface{}) bool {
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	case float64:
+		bv, ok := toNumber(b)
+		return ok && av == bv
+	case string:
+		if bv, ok := b.(string); ok {
+			return av == bv
+		}
+		bv, ok := toNumber(b)
+		if !ok {
+			return false
+		}
+		an, err := strconv.ParseFloat(av, 64)
+		return err == nil && an == bv
+	}
+	return false
+}
+
+// order compares two numbers or two strings. A string that parses as a
+// number is compared numerically against a number, so string-valued user
+// attributes can be compared with numeric literals.
+func order(a, b interface{}) (int, error) {
+	as, aString := a.(string)
+	bs, bString := b.(string)
+	if aString && bString {
+		return strings.Compare(as, bs), nil
+	}
+
+	an, aOK := toNumber(a)
+	bn, bOK := toNumber(b)
+	if !aOK || !bOK {
+		return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+	}
+	switch {
+	case an < bn:
+		return -1, nil
+	case an > bn:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func ipIn(args []interface{}) (interface{}, error) {
+	addr, _ := args[0].(string)
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false, nil
+	}
+	for _, arg := range args[1:] {
+		cidr, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("ip_in expects CIDR strings")
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		if network.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func stringFunc(fn func(s, arg string) bool) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		s, ok1 := args[0].(string)
+		arg, ok2 := args[1].(string)
+		if args[0] == nil {
+			return false, nil
+		}
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("expected string arguments")
+		}
+		return fn(s, arg), nil
+	}
+}
+
+func contains(args []interface{}) (interface{}, error) {
+	switch haystack := args[0].(type) {
+	case nil:
+		return false, nil
+	case string:
+		needle, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("contains expects a string to look for")
+		}
+		return strings.Contains(haystack, needle), nil
+	case []interface{}:
+		for _, item := range haystack {
+			if equal(item, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return nil, fmt.Errorf("contains expects a string or a list")
+}
+
+func lower(args []interface{}) (interface{}, error) {
+	switch s := args[0].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.ToLower(s), nil
+	}
+	return nil, fmt.Errorf("lower expects a string")
+}
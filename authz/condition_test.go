@@ -0,0 +1,132 @@
+package authz
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"rbac/store"
+)
+
+func TestConditionEval(t *testing.T) {
+	vars := conditionVars(&store.User{
+		ID:         7,
+		Username:   "alice",
+		Attributes: map[string]string{"department": "Support", "level": "4", "grade": "senior"},
+	}, Request{
+		TenantID: 3,
+		Resource: &Resource{Type: "post", ID: "proj-x-12"},
+		Env: Env{
+			IP:      "10.1.2.3",
+			Method:  http.MethodGet,
+			Headers: http.Header{"X-Device": {"managed"}},
+			Time:    time.Date(2024, 5, 6, 14, 30, 0, 0, time.UTC),
+		},
+	})
+
+	tests := []struct {
+		name    string
+		source  string
+		want    bool
+		wantErr bool
+	}{
+		{"literal", "true", true, false},
+		{"string equality", `user.username == "alice"`, true, false},
+		{"single quotes", `user.username == 'alice'`, true, false},
+		{"inequality", `user.username != "alice"`, false, false},
+		{"numeric string against number", "user.attributes.level == 4", true, false},
+		{"numeric ordering", "user.attributes.level > 3 && user.attributes.level <= 4", true, false},
+		{"string ordering", `user.attributes.grade >= "junior"`, true, false},
+		{"header index", `request.headers["x-device"] == "managed"`, true, false},
+		{"in list", `request.method in ["GET", "HEAD"]`, true, false},
+		{"not in list", `request.method in ["POST"]`, false, false},
+		{"time", "time.weekday == 1 && time.hour >= 9 && time.hour < 17", true, false},
+		{"tenant", "tenant.id == 3", true, false},
+		{"resource", `resource.type == "post" && starts_with(resource.id, "proj-x-")`, true, false},
+		{"ip_in", `ip_in(request.ip, "192.168.0.0/16", "10.0.0.0/8")`, true, false},
+		{"ip_in outside", `ip_in(request.ip, "192.168.0.0/16")`, false, false},
+		{"lower", `lower(user.attributes.department) == "support"`, true, false},
+		{"contains string", `contains(user.username, "lic")`, true, false},
+		{"contains list", `contains(["a", "b"], "b")`, true, false},
+		{"ends_with", `ends_with(resource.id, "12")`, true, false},
+
+		{"and binds tighter than or", "true || false && false", true, false},
+		{"parentheses", "(true || false) && false", false, false},
+		{"not binds tightest", "!false && false", false, false},
+		{"not before comparison", "!user.id == 8", true, false},
+		{"double negation", "!!true", true, false},
+		{"or short-circuits", "true || user.username > 1", true, false},
+		{"and short-circuits", "false && user.username > 1", false, false},
+
+		{"missing attribute equals null", "user.attributes.region == null", true, false},
+		{"missing attribute against string", `user.attributes.region == "eu"`, false, false},
+		{"missing attribute ordering", "user.attributes.region > 3", false, false},
+		{"select from missing", `user.attributes.region.name == "eu"`, false, false},
+		{"missing in list", `user.attributes.region in ["eu"]`, false, false},
+
+		{"non-numeric string against number", "user.attributes.grade > 3", false, true},
+		{"boolean ordering", "true < false", false, true},
+		{"non-boolean result", "user.username", false, true},
+		{"non-boolean operand of and", "1 && true", false, true},
+		{"non-boolean operand of not", `!"yes"`, false, true},
+		{"in without list", `"a" in "abc"`, false, true},
+		{"select from string", "user.username.first == 1", false, true},
+		{"non-string key", "user.attributes[1] == 1", false, true},
+		{"string function on number", "starts_with(user.id, 7)", false, true},
+		{"lower of number", `lower(user.id) == "7"`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := CompileCondition(tt.source)
+			if err != nil {
+				t.Fatalf("CompileCondition(%q): %v", tt.source, err)
+			}
+			got, err := cond.Eval(vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Eval(%q) = %v, %v, want error: %v", tt.source, got, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Eval(%q) = %v, want %v", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr bool
+	}{
+		{"empty", "", false},
+		{"valid", `user.attributes.department == "support" && ip_in(request.ip, "10.0.0.0/8")`, false},
+		{"non-literal network", "ip_in(request.ip, user.attributes.network)", false},
+
+		{"unknown attribute", `department == "support"`, true},
+		{"unknown function", `upper(user.username) == "ALICE"`, true},
+		{"too few arguments", `starts_with(user.username)`, true},
+		{"too many arguments", `lower(user.username, "x")`, true},
+		{"invalid network", `ip_in(request.ip, "10.0.0.0/33")`, true},
+		{"non-string network", "ip_in(request.ip, 10)", true},
+		{"unterminated string", `user.username == "alice`, true},
+		{"unexpected character", "user.username == #", true},
+		{"missing operand", "user.username ==", true},
+		{"chained comparison", "1 < 2 < 3", true},
+		{"trailing tokens", "true false", true},
+		{"unclosed parenthesis", "(true || false", true},
+		{"unclosed list", `request.method in ["GET"`, true},
+		{"missing attribute name", "user. == 1", true},
+		{"unclosed index", `request.headers["x-device" == 1`, true},
+		{"dangling operator", "true &&", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCondition(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCondition(%q) = %v, want error: %v", tt.source, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package authz
+
+import "rbac/store"
+
+type RoleGraph struct {
+	roles  map[int]store.Role
+	byName map[roleKey]int
+}
+
+type roleKey struct {
+	tenantID int
+	name     string
+}
+
+func NewRoleGraph(roles []store.Role) *RoleGraph {
+	g := &RoleGraph{
+		roles:  make(map[int]store.Role, len(roles)),
+		byName: make(map[roleKey]int, len(roles)),
+	}
+	for _, role := range roles {
+		g.roles[role.ID] = role
+		g.byName[roleKey{role.TenantID, role.Name}] = role.ID
+	}
+	return g
+}
+
+// Lookup resolves a role name the way the store does: the tenant's own role
+// wins over a global role of the same name. A tenantID of 0 only matches
+// global roles.
+func (g *RoleGraph) Lookup(name string, tenantID int) (int, bool) {
+	if tenantID != 0 {
+		if id, ok := g.byName[roleKey{tenantID, name}]; ok {
+			return id, true
+		}
+	}
+	id, ok := g.byName[roleKey{0, name}]
+	return id, ok
+}
+
+// Ancestors returns the IDs of every role id inherits from, nearest first.
+// Cycles that slipped into the data are walked only once.
+func (g *RoleGraph) Ancestors(id int) []int {
+	seen := map[int]bool{id: true}
+	var ancestors []int
+	queue := append([]int(nil), g.roles[id].ParentIDs...)
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		if seen[parent] {
+			continue
+		}
+		seen[parent] = true
+		ancestors = append(ancestors, parent)
+		queue = append(queue, g.roles[parent].ParentIDs...)
+	}
+	return ancestors
+}
+
+// InheritedPermissions returns the permissions id receives from its
+// ancestors that it is not granted directly.
+func (g *RoleGraph) InheritedPermissions(id int) []string {
+	seen := make(map[string]bool)
+	for _, perm := range g.roles[id].Permissions {
+		seen[perm] = true
+	}
+
+	var inherited []string
+	for _, ancestor := range g.Ancestors(id) {
+		for _, perm := range g.roles[ancestor].Permissions {
+			if !seen[perm] {
+				seen[perm] = true
+				inherited = append(inherited, perm)
+			}
+		}
+	}
+	return inherited
+}
+
+// Grant is one way a role obtains or loses a permission: the role itself or
+// one of its ancestors (SourceID) allows or denies it, possibly under a
+// condition.
+type Grant struct {
+	SourceID  int
+	Deny      bool
+	Condition string
+}
+
+// Grants returns every grant of the permission reachable from the role,
+// nearest first.
+func (g *RoleGraph) Grants(roleID int, permission string) []Grant {
+	var grants []Grant
+	for _, id := range append([]int{roleID}, g.Ancestors(roleID)...) {
+		role := g.roles[id]
+		for _, perm := range role.Permissions {
+			if perm == permission {
+				grants = append(grants, Grant{SourceID: id, Condition: role.PermissionConditions[perm]})
+			}
+		}
+		for _, perm := range role.DeniedPermissions {
+			if perm == permission {
+				grants = append(grants, Grant{SourceID: id, Deny: true, Condition: role.PermissionConditions[perm]})
+			}
+		}
+	}
+	return grants
+}
+
+// RequiresMFA reports whether any of the roles or any role they inherit
+// from requires a second factor at login.
+func (g *RoleGraph) RequiresMFA(ids []int) bool {
+	for _, id := range ids {
+		for _, roleID := range append([]int{id}, g.Ancestors(id)...) {
+			if g.roles[roleID].RequireMFA {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *RoleGraph) Name(id int) string {
+	return g.roles[id].Name
+}
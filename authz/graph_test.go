@@ -0,0 +1,77 @@
+package authz
+
+import (
+	"reflect"
+	"testing"
+
+	"rbac/store"
+)
+
+func TestRoleGraphAncestors(t *testing.T) {
+	g := NewRoleGraph([]store.Role{
+		{ID: 1, Name: "admin", ParentIDs: []int{2, 3}},
+		{ID: 2, Name: "editor", ParentIDs: []int{4}},
+		{ID: 3, Name: "auditor", ParentIDs: []int{4}},
+		{ID: 4, Name: "viewer"},
+		// Cycles that bypassed the store's checks.
+		{ID: 5, Name: "self", ParentIDs: []int{5}},
+		{ID: 6, Name: "ping", ParentIDs: []int{7}},
+		{ID: 7, Name: "pong", ParentIDs: []int{8}},
+		{ID: 8, Name: "back", ParentIDs: []int{6, 4}},
+	})
+
+	tests := []struct {
+		name string
+		id   int
+		want []int
+	}{
+		{"no parents", 4, nil},
+		{"chain", 2, []int{4}},
+		{"shared ancestor once, nearest first", 1, []int{2, 3, 4}},
+		{"self parent", 5, nil},
+		{"indirect cycle", 6, []int{7, 8, 4}},
+		{"unknown role", 99, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.Ancestors(tt.id); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Ancestors(%d) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleGraphLookup(t *testing.T) {
+	g := NewRoleGraph([]store.Role{
+		{ID: 1, Name: "admin"},
+		{ID: 2, Name: "viewer"},
+		{ID: 3, Name: "admin", TenantID: 10},
+		{ID: 4, Name: "auditor", TenantID: 10},
+	})
+
+	tests := []struct {
+		name     string
+		role     string
+		tenantID int
+		wantID   int
+		wantOK   bool
+	}{
+		{"global role", "admin", 0, 1, true},
+		{"tenant role over global", "admin", 10, 3, true},
+		{"global role in tenant", "viewer", 10, 2, true},
+		{"global role in other tenant", "admin", 20, 1, true},
+		{"tenant role outside tenant", "auditor", 0, 0, false},
+		{"tenant role in other tenant", "auditor", 20, 0, false},
+		{"unknown role", "missing", 10, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := g.Lookup(tt.role, tt.tenantID)
+			if id != tt.wantID || ok != tt.wantOK {
+				t.Errorf("Lookup(%q, %d) = %d, %v; want %d, %v", tt.role, tt.tenantID, id, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
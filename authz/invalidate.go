@@ -0,0 +1,124 @@
+package authz
+
+import "rbac/store"
+
+// InvalidatingStore wraps a store and notifies an Invalidator after every
+// successful write that can change what a user is authorized to do.
+type InvalidatingStore struct {
+	store.Store
+	cache Invalidator
+}
+
+func NewInvalidatingStore(s store.Store, cache Invalidator) *InvalidatingStore {
+	return &InvalidatingStore{Store: s, cache: cache}
+}
+
+func (s *InvalidatingStore) UpdateUser(user store.User) error {
+	return s.user(user.ID, s.Store.UpdateUser(user))
+}
+
+func (s *InvalidatingStore) DeleteUser(id int) error {
+	return s.user(id, s.Store.DeleteUser(id))
+}
+
+// SetUserDisabled revokes the user's sessions when disabling them.
+func (s *InvalidatingStore) SetUserDisabled(id int, disabled bool) error {
+	return s.user(id, s.Store.SetUserDisabled(id, disabled))
+}
+
+// CreateRole invalidates everything: a tenant role shadows the global role
+// of the same name for the tenant's users.
+func (s *InvalidatingStore) CreateRole(role store.Role) (int, error) {
+	id, err := s.Store.CreateRole(role)
+	return id, s.all(err)
+}
+
+func (s *InvalidatingStore) CreateRoleWithMembers(role store.Role, members []int) (int, error) {
+	id, err := s.Store.CreateRoleWithMembers(role, members)
+	return id, s.all(err)
+}
+
+func (s *InvalidatingStore) UpdateRole(role store.Role) error {
+	return s.all(s.Store.UpdateRole(role))
+}
+
+func (s *InvalidatingStore) DeleteRole(id int) error {
+	return s.all(s.Store.DeleteRole(id))
+}
+
+func (s *InvalidatingStore) SetRoleMembers(id int, name string, members []int) error {
+	return s.all(s.Store.SetRoleMembers(id, name, members))
+}
+
+func (s *InvalidatingStore) UpdatePermission(id int, name string) error {
+	return s.all(s.Store.UpdatePermission(id, name))
+}
+
+func (s *InvalidatingStore) DeletePermission(id int, cascade bool) error {
+	return s.all(s.Store.DeletePermission(id, cascade))
+}
+
+func (s *InvalidatingStore) UpdateGroup(group store.Group) error {
+	return s.all(s.Store.UpdateGroup(group))
+}
+
+func (s *InvalidatingStore) DeleteGroup(id int) error {
+	return s.all(s.Store.DeleteGroup(id))
+}
+
+func (s *InvalidatingStore) AddGroupMember(groupID, userID int) error {
+	return s.user(userID, s.Store.AddGroupMember(groupID, userID))
+}
+
+func (s *InvalidatingStore) RemoveGroupMember(groupID, userID int) error {
+	return s.user(userID, s.Store.RemoveGroupMember(groupID, userID))
+}
+
+func (s *InvalidatingStore) DeleteTenant(id int) error {
+	return s.all(s.Store.DeleteTenant(id))
+}
+
+func (s *InvalidatingStore) SetUserTenantRoles(tenantID, userID int, roles []string, conditions map[string]string) error {
+	return s.user(userID, s.Store.SetUserTenantRoles(tenantID, userID, roles, conditions))
+}
+
+func (s *InvalidatingStore) CreateResourceBinding(binding store.ResourceBinding) (int, error) {
+	id, err := s.Store.CreateResourceBinding(binding)
+	return id, s.user(binding.UserID, err)
+}
+
+func (s *InvalidatingStore) DeleteResourceBinding(id int) error {
+	return s.all(s.Store.DeleteResourceBinding(id))
+}
+
+// Revoking sessions counts as a change for their user, so that SessionCache
+// stops trusting them.
+func (s *InvalidatingStore) RevokeSession(id int) error {
+	session, err := s.Store.GetSession(id)
+	if err != nil {
+		return err
+	}
+	return s.user(session.UserID, s.Store.RevokeSession(id))
+}
+
+func (s *InvalidatingStore) RevokeUserSessions(userID int) error {
+	return s.user(userID, s.Store.RevokeUserSessions(userID))
+}
+
+func (s *InvalidatingStore) RevokeRefreshTokenFamily(userID int, familyID string) error {
+	return s.user(userID, s.Store.RevokeRefreshTokenFamily(userID, familyID))
+}
+
+func (s *InvalidatingStore) user(userID int, err error) error {
+	if err == nil {
+		s.cache.InvalidateUser(userID)
+	}
+	return err
+}
+
+func (s *InvalidatingStore) all(err error) error {
+	if err == nil {
+		s.cache.InvalidateAll()
+	}
+	return err
+}
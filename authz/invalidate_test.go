@@ -0,0 +1,116 @@
+package authz
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"rbac/store"
+)
+
+// invalidations records what an InvalidatingStore invalidated.
+type invalidations struct {
+	users []int
+	all   int
+}
+
+func (i *invalidations) InvalidateUser(userID int) { i.users = append(i.users, userID) }
+func (i *invalidations) InvalidateAll()            { i.all++ }
+
+func TestInvalidatingStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		write     func(s *InvalidatingStore, alice int) error
+		wantUsers bool
+		wantAll   bool
+	}{
+		{
+			name: "refresh token reuse",
+			write: func(s *InvalidatingStore, alice int) error {
+				return s.RevokeRefreshTokenFamily(alice, "family")
+			},
+			wantUsers: true,
+		},
+		{
+			name: "session revoked",
+			write: func(s *InvalidatingStore, alice int) error {
+				sessions, err := s.GetUserSessions(alice)
+				if err != nil {
+					return err
+				}
+				return s.RevokeSession(sessions[0].ID)
+			},
+			wantUsers: true,
+		},
+		{
+			name:      "all sessions revoked",
+			write:     func(s *InvalidatingStore, alice int) error { return s.RevokeUserSessions(alice) },
+			wantUsers: true,
+		},
+		{
+			name:      "user disabled",
+			write:     func(s *InvalidatingStore, alice int) error { return s.SetUserDisabled(alice, true) },
+			wantUsers: true,
+		},
+		{
+			name: "user disabled by update",
+			write: func(s *InvalidatingStore, alice int) error {
+				disabled := true
+				return s.UpdateUser(store.User{ID: alice, Username: "alice", SetDisabled: &disabled})
+			},
+			wantUsers: true,
+		},
+		{
+			name: "role changed",
+			write: func(s *InvalidatingStore, _ int) error {
+				_, err := s.CreateRole(store.Role{Name: "editor"})
+				return err
+			},
+			wantAll: true,
+		},
+		{
+			name: "role members set",
+			write: func(s *InvalidatingStore, alice int) error {
+				id, err := s.Store.CreateRole(store.Role{Name: "editor"})
+				if err != nil {
+					return err
+				}
+				return s.SetRoleMembers(id, "editor", []int{alice})
+			},
+			wantAll: true,
+		},
+		{
+			name:  "failed write",
+			write: func(s *InvalidatingStore, alice int) error { return s.RevokeSession(999) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := store.NewMemoryStore()
+			alice, err := base.CreateUser(store.User{Username: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expires := time.Now().Add(time.Hour)
+			if _, err := base.CreateSession(store.Session{UserID: alice, FamilyID: "family", ExpiresAt: expires}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := base.CreateRefreshToken(store.RefreshToken{UserID: alice, FamilyID: "family", TokenHash: "hash", ExpiresAt: expires}); err != nil {
+				t.Fatal(err)
+			}
+
+			recorded := &invalidations{}
+			err = tt.write(NewInvalidatingStore(base, recorded), alice)
+			if failed := !tt.wantUsers && !tt.wantAll; (err != nil) != failed {
+				t.Fatalf("write: %v", err)
+			}
+			if got := slices.Equal(recorded.users, []int{alice}); got != tt.wantUsers {
+				t.Errorf("invalidated users %v, want alice only: %v", recorded.users, tt.wantUsers)
+			}
+			if got := recorded.all > 0; got != tt.wantAll {
+				t.Errorf("invalidated everything %d times, want some: %v", recorded.all, tt.wantAll)
+			}
+		})
+	}
+}
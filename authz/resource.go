@@ -0,0 +1,33 @@
+package authz
+
+import (
+	"strings"
+
+	"rbac/store"
+)
+
+type Resource struct {
+	Type string
+	ID   string
+}
+
+// bindingApplies reports whether the binding grants its role on the
+// resource when acting within tenantID.
+func bindingApplies(binding store.ResourceBinding, tenantID int, resource Resource) bool {
+	if binding.TenantID != 0 && binding.TenantID != tenantID {
+		return false
+	}
+	if binding.ResourceType != resource.Type {
+		return false
+	}
+	return matchResourceID(binding.ResourceID, resource.ID)
+}
+
+// matchResourceID matches an exact ID, a prefix pattern ending in "*", or
+// "*" for any ID.
+func matchResourceID(pattern, id string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(id, prefix)
+	}
+	return pattern == id
+}
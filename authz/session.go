@@ -0,0 +1,96 @@
+package authz
+
+import (
+	"sync"
+	"time"
+
+	"rbac/store"
+)
+
+const (
+	// sessionCacheTTL bounds how long a session read from the database is
+	// trusted, for changes made to it directly in the database.
+	sessionCacheTTL  = time.Minute
+	sessionCacheSize = 100000
+)
+
+// SessionCache serves the session lookups of AuthMiddleware from memory so
+// that requests are authenticated without reading the database. A cached
+// session is trusted while the change feed has seen no change affecting its
+// user since it was read. Revoking sessions through InvalidatingStore
+// records such a change, so a revocation takes effect on this replica at
+// once and on the others within the feed's poll interval.
+type SessionCache struct {
+	store.SessionStore
+	feed *ChangeFeed
+
+	mu      sync.Mutex
+	entries map[int]cachedSession
+}
+
+type cachedSession struct {
+	session store.Session
+	version int
+	readAt  time.Time
+}
+
+func NewSessionCache(sessions store.SessionStore, feed *ChangeFeed) *SessionCache {
+	return &SessionCache{SessionStore: sessions, feed: feed, entries: make(map[int]cachedSession)}
+}
+
+func (c *SessionCache) GetSession(id int) (*store.Session, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && time.Since(entry.readAt) < sessionCacheTTL {
+		if version, ready := c.feed.PolicyVersion(entry.session.UserID); ready && version <= entry.version {
+			session := entry.session
+			return &session, nil
+		}
+	}
+
+	// The version is read first so that a revocation racing with the read
+	// makes the entry stale, not wrong.
+	version, ready := c.feed.CurrentVersion()
+	session, err := c.SessionStore.GetSession(id)
+	if err != nil || !ready {
+		return session, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= sessionCacheSize {
+		for key, entry := range c.entries {
+			if time.Since(entry.readAt) >= sessionCacheTTL {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= sessionCacheSize {
+			c.entries = make(map[int]cachedSession)
+		}
+	}
+	c.entries[id] = cachedSession{session: *session, version: version, readAt: time.Now()}
+	return session, nil
+}
+
+// TouchSession also updates the cached session, so that its last use stays
+// current.
+func (c *SessionCache) TouchSession(id int, ip string, expiresAt time.Time) error {
+	if err := c.SessionStore.TouchSession(id, ip, expiresAt); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[id]; ok {
+		entry.session.LastUsedAt = time.Now()
+		if ip != "" {
+			entry.session.IP = ip
+		}
+		if !expiresAt.IsZero() {
+			entry.session.ExpiresAt = expiresAt
+		}
+		c.entries[id] = entry
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package authz
+
+import (
+	"testing"
+	"time"
+
+	"rbac/store"
+)
+
+func newTestSession(t *testing.T, s *store.MemoryStore) (int, int) {
+	t.Helper()
+	userID, err := s.CreateUser(store.User{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, err := s.CreateSession(store.Session{UserID: userID, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID, sessionID
+}
+
+func revoked(t *testing.T, sessions store.SessionStore, id int) bool {
+	t.Helper()
+	session, err := sessions.GetSession(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return !session.RevokedAt.IsZero()
+}
+
+func TestSessionCacheTrust(t *testing.T) {
+	s := store.NewMemoryStore()
+	_, sessionID := newTestSession(t, s)
+	a, b := newReplica(t, s), newReplica(t, s)
+	aWrites := NewInvalidatingStore(s, a.feed)
+	aSessions := NewSessionCache(aWrites, a.feed)
+	bSessions := NewSessionCache(NewInvalidatingStore(s, b.feed), b.feed)
+
+	for name, sessions := range map[string]*SessionCache{"a": aSessions, "b": bSessions} {
+		if revoked(t, sessions, sessionID) {
+			t.Fatalf("%s: session revoked before logout", name)
+		}
+	}
+
+	// A revocation written to the database directly is only seen once the
+	// entry expires.
+	if err := s.RevokeSession(sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if revoked(t, aSessions, sessionID) {
+		t.Fatal("cached session not served from memory")
+	}
+
+	if err := aWrites.RevokeSession(sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if !revoked(t, aSessions, sessionID) {
+		t.Error("session still trusted on the replica that revoked it")
+	}
+	if revoked(t, bSessions, sessionID) {
+		t.Error("other replica saw the revocation before polling")
+	}
+	b.feed.poll()
+	if !revoked(t, bSessions, sessionID) {
+		t.Error("session still trusted on the other replica after polling")
+	}
+}
+
+func TestSessionCacheRevokeUserSessions(t *testing.T) {
+	s := store.NewMemoryStore()
+	userID, sessionID := newTestSession(t, s)
+	r := newReplica(t, s)
+	writes := NewInvalidatingStore(s, r.feed)
+	sessions := NewSessionCache(writes, r.feed)
+
+	if revoked(t, sessions, sessionID) {
+		t.Fatal("session revoked before signing out")
+	}
+	if err := writes.RevokeUserSessions(userID); err != nil {
+		t.Fatal(err)
+	}
+	if !revoked(t, sessions, sessionID) {
+		t.Error("session still trusted after revoking the user's sessions")
+	}
+}
+
+// Until the feed has started, changes may be missing, so nothing is
+// cached.
+func TestSessionCacheFeedNotStarted(t *testing.T) {
+	s := store.NewMemoryStore()
+	_, sessionID := newTestSession(t, s)
+	feed := NewChangeFeed(s, nil, nil, time.Minute)
+	sessions := NewSessionCache(s, feed)
+
+	if revoked(t, sessions, sessionID) {
+		t.Fatal("session revoked before logout")
+	}
+	if err := s.RevokeSession(sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if !revoked(t, sessions, sessionID) {
+		t.Error("session cached before the feed started")
+	}
+}
+
+func TestSessionCacheTouch(t *testing.T) {
+	s := store.NewMemoryStore()
+	_, sessionID := newTestSession(t, s)
+	sessions := NewSessionCache(s, newReplica(t, s).feed)
+	if _, err := sessions.GetSession(sessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(2 * time.Hour)
+	if err := sessions.TouchSession(sessionID, "192.0.2.1", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	session, err := sessions.GetSession(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.IP != "192.0.2.1" || !session.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("cached session IP %q expires %v, want the touched values", session.IP, session.ExpiresAt)
+	}
+}
@@ -0,0 +1,104 @@
+package authz
+
+import (
+	"errors"
+
+	apperrors "rbac/errors"
+)
+
+// TokenPolicy embeds a user's effective permissions in their access tokens
+// and decides when a token's permissions can be trusted without evaluating
+// the request. A nil *TokenPolicy embeds nothing and trusts nothing.
+type TokenPolicy struct {
+	authorizer *Authorizer
+	feed       *ChangeFeed
+}
+
+func NewTokenPolicy(authorizer *Authorizer, feed *ChangeFeed) *TokenPolicy {
+	return &TokenPolicy{authorizer: authorizer, feed: feed}
+}
+
+// Issue returns the permissions to embed in a token of the user within the
+// tenant and the policy version they reflect. The version is read first so
+// that a change racing with the lookup makes the token stale, not wrong.
+func (p *TokenPolicy) Issue(userID, tenantID int) ([]string, int, error) {
+	if p == nil {
+		return nil, 0, nil
+	}
+
+	version, ok := p.feed.CurrentVersion()
+	if !ok {
+		return nil, 0, nil
+	}
+
+	permissions, err := p.authorizer.TokenPermissions(userID, tenantID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return permissions, version, nil
+}
+
+// Allows reports whether a token issued at version with permissions grants
+// permission by itself. It does while no change affecting the user has
+// been seen since the token was issued; otherwise, or when permission is
+// not embedded, the request has to be evaluated.
+func (p *TokenPolicy) Allows(userID, version int, permissions []string, permission string) bool {
+	if p == nil || len(permissions) == 0 {
+		return false
+	}
+
+	current, ok := p.feed.PolicyVersion(userID)
+	if !ok || current > version {
+		return false
+	}
+
+	for _, perm := range permissions {
+		if perm == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenPermissions returns the permissions the user holds within the
+// tenant regardless of the request: granted by an unconditional allow
+// through an unconditional assignment, and not subject to any deny.
+// Resource bindings are left out as they only apply to their resources.
+func (a *Authorizer) TokenPermissions(userID, tenantID int) ([]string, error) {
+	sub, err := a.subject(userID, tenantID)
+	if errors.Is(err, apperrors.ErrUserNotFound) || errors.Is(err, apperrors.ErrTenantNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool)
+	denied := make(map[string]bool)
+	var order []string
+	for _, assigned := range sub.assigned {
+		for _, id := range append([]int{assigned.roleID}, sub.graph.Ancestors(assigned.roleID)...) {
+			role := sub.graph.roles[id]
+			for _, perm := range role.DeniedPermissions {
+				denied[perm] = true
+			}
+			if assigned.condition != "" {
+				continue
+			}
+			for _, perm := range role.Permissions {
+				if role.PermissionConditions[perm] == "" && !allowed[perm] {
+					allowed[perm] = true
+					order = append(order, perm)
+				}
+			}
+		}
+	}
+
+	var permissions []string
+	for _, perm := range order {
+		if !denied[perm] {
+			permissions = append(permissions, perm)
+		}
+	}
+	return permissions, nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+type AuthzConfig struct {
+	CacheTTL  time.Duration
+	CacheSize int
+
+	ChangePollInterval time.Duration
+
+	TokenPermissions bool
+
+	// TrustedProxies are the addresses or CIDRs of the reverse proxies whose
+	// X-Forwarded-For header gives the client IP that conditions see. With
+	// none the header is ignored.
+	TrustedProxies []string
+}
+
+// LoadAuthzConfig reads the authorization settings from the environment;
+// LoadEnv has already loaded the .env file. A CacheSize of 0 turns
+// the permission cache off.
+func LoadAuthzConfig() (*AuthzConfig, error) {
+	ttl, err := time.ParseDuration(getEnv("AUTHZ_CACHE_TTL", "1m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AUTHZ_CACHE_TTL: %w", err)
+	}
+
+	size, err := strconv.Atoi(getEnv("AUTHZ_CACHE_SIZE", "10000"))
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid AUTHZ_CACHE_SIZE: %q", getEnv("AUTHZ_CACHE_SIZE", ""))
+	}
+
+	pollInterval, err := time.ParseDuration(getEnv("AUTHZ_CHANGE_POLL_INTERVAL", "5s"))
+	if err != nil || pollInterval <= 0 {
+		return nil, fmt.Errorf("invalid AUTHZ_CHANGE_POLL_INTERVAL: %q", getEnv("AUTHZ_CHANGE_POLL_INTERVAL", ""))
+	}
+
+	tokenPermissions, err := strconv.ParseBool(getEnv("AUTHZ_TOKEN_PERMISSIONS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AUTHZ_TOKEN_PERMISSIONS: %w", err)
+	}
+
+	trustedProxies := splitList(getEnv("TRUSTED_PROXIES", ""))
+	for _, proxy := range trustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %q is not an IP address or CIDR", proxy)
+		}
+	}
+
+	return &AuthzConfig{
+		CacheTTL:           ttl,
+		CacheSize:          size,
+		ChangePollInterval: pollInterval,
+		TokenPermissions:   tokenPermissions,
+		TrustedProxies:     trustedProxies,
+	}, nil
+}
@@ -2,37 +2,76 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type DBConfig struct {
+	Driver   string
 	Host     string
 	Port     string
 	User     string
 	Password string
 	DBName   string
+	SSLMode  string
+
+	AutoMigrate bool
+}
+
+// LoadEnv loads the .env file into the environment.
+func LoadEnv() error {
+	if err := godotenv.Load(); err != nil {
+		return fmt.Errorf("error loading .env file: %w", err)
+	}
+	return nil
 }
 
 func LoadDBConfig() (*DBConfig, error) {
-	err := godotenv.Load()
+	if err := LoadEnv(); err != nil {
+		return nil, err
+	}
+
+	autoMigrate, err := strconv.ParseBool(getEnv("DB_AUTO_MIGRATE", "true"))
 	if err != nil {
-		return nil, fmt.Errorf("error loading .env file: %w", err)
+		return nil, fmt.Errorf("invalid DB_AUTO_MIGRATE: %w", err)
 	}
 
 	config := &DBConfig{
+		Driver:   getEnv("DB_DRIVER", "mysql"),
 		Host:     os.Getenv("DB_HOST"),
 		Port:     os.Getenv("DB_PORT"),
 		User:     os.Getenv("DB_USER"),
 		Password: os.Getenv("DB_PASSWORD"),
 		DBName:   os.Getenv("DB_NAME"),
+		SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+		AutoMigrate: autoMigrate,
 	}
 
 	return config, nil
 }
 
+// GetDSN builds the data source name for the driver, which is matched
+// ignoring case as store.ParseDialect matches it.
 func (c *DBConfig) GetDSN() string {
+	switch strings.ToLower(c.Driver) {
+	case "postgres", "postgresql":
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(c.User, c.Password),
+			Host:     c.Host + ":" + c.Port,
+			Path:     c.DBName,
+			RawQuery: url.Values{"sslmode": {c.SSLMode}}.Encode(),
+		}
+		return dsn.String()
+	case "sqlite", "sqlite3":
+		return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", c.DBName)
+	}
+
 	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
 		c.User,
 		c.Password,
@@ -40,4 +79,11 @@ func (c *DBConfig) GetDSN() string {
 		c.Port,
 		c.DBName,
 	)
-} 
\ No newline at end of file
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
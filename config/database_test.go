@@ -0,0 +1,31 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetDSNDriverCase(t *testing.T) {
+	tests := []struct {
+		driver     string
+		wantPrefix string
+	}{
+		{"", "user:secret@tcp("},
+		{"MySQL", "user:secret@tcp("},
+		{"postgres", "postgres://"},
+		{"Postgres", "postgres://"},
+		{"PostgreSQL", "postgres://"},
+		{"sqlite", "file:rbac?"},
+		{"SQLite", "file:rbac?"},
+		{"SQLITE3", "file:rbac?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			c := &DBConfig{Driver: tt.driver, Host: "localhost", Port: "5432", User: "user", Password: "secret", DBName: "rbac", SSLMode: "disable"}
+			if dsn := c.GetDSN(); !strings.HasPrefix(dsn, tt.wantPrefix) {
+				t.Errorf("GetDSN() = %q, want prefix %q", dsn, tt.wantPrefix)
+			}
+		})
+	}
+}
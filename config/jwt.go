@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// KeyDir, when set, replaces the single configured key with a rotating
+// keyring; see utils.LoadKeyring. PreviousSecretKeys and PreviousKeyFiles
+// keep verifying tokens signed with keys rotated out by hand.
+type JWTConfig struct {
+	SigningMethod  string
+	SecretKey      string
+	PrivateKeyFile string
+	KeyID          string
+
+	PreviousSecretKeys []string
+	PreviousKeyFiles   []string
+
+	KeyDir             string
+	KeyReloadInterval  time.Duration
+	KeyActivationDelay time.Duration
+}
+
+// LoadJWTConfig reads the token signing settings from the environment;
+// LoadEnv has already loaded the .env file.
+func LoadJWTConfig() (*JWTConfig, error) {
+	method := getEnv("JWT_SIGNING_METHOD", "HS256")
+	switch method {
+	case "HS256", "RS256", "ES256", "EdDSA":
+	default:
+		return nil, fmt.Errorf("invalid JWT_SIGNING_METHOD: %q", method)
+	}
+
+	reloadInterval, err := time.ParseDuration(getEnv("JWT_KEY_RELOAD_INTERVAL", "1m"))
+	if err != nil || reloadInterval <= 0 {
+		return nil, fmt.Errorf("invalid JWT_KEY_RELOAD_INTERVAL: %q", getEnv("JWT_KEY_RELOAD_INTERVAL", ""))
+	}
+
+	activationDelay, err := time.ParseDuration(getEnv("JWT_KEY_ACTIVATION_DELAY", "10m"))
+	if err != nil || activationDelay < 0 {
+		return nil, fmt.Errorf("invalid JWT_KEY_ACTIVATION_DELAY: %q", getEnv("JWT_KEY_ACTIVATION_DELAY", ""))
+	}
+	// Every server has to load a rotated key before any of them signs with
+	// it, or the others reject its tokens.
+	if activationDelay < reloadInterval {
+		return nil, fmt.Errorf("JWT_KEY_ACTIVATION_DELAY (%s) must not be shorter than JWT_KEY_RELOAD_INTERVAL (%s)", activationDelay, reloadInterval)
+	}
+
+	return &JWTConfig{
+		SigningMethod:      method,
+		SecretKey:          os.Getenv("JWT_SECRET_KEY"),
+		PrivateKeyFile:     os.Getenv("JWT_PRIVATE_KEY_FILE"),
+		KeyID:              os.Getenv("JWT_KEY_ID"),
+		PreviousSecretKeys: splitList(os.Getenv("JWT_PREVIOUS_SECRET_KEYS")),
+		PreviousKeyFiles:   splitList(os.Getenv("JWT_PREVIOUS_KEY_FILES")),
+		KeyDir:             os.Getenv("JWT_KEY_DIR"),
+		KeyReloadInterval:  reloadInterval,
+		KeyActivationDelay: activationDelay,
+	}, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
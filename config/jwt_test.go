@@ -0,0 +1,38 @@
+package config
+
+import "testing"
+
+func TestLoadJWTConfigKeyTimes(t *testing.T) {
+	tests := []struct {
+		name           string
+		reloadInterval string
+		delay          string
+		wantErr        bool
+	}{
+		{"defaults", "", "", false},
+		{"delay equal to reload interval", "5m", "5m", false},
+		{"delay longer than reload interval", "30s", "1m", false},
+		{"no delay", "", "0s", true},
+		{"delay shorter than reload interval", "5m", "1m", true},
+		{"delay shorter than default reload interval", "", "30s", true},
+		{"negative delay", "", "-10m", true},
+		{"invalid delay", "", "soon", true},
+		{"zero reload interval", "0s", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SIGNING_METHOD", "")
+			t.Setenv("JWT_KEY_RELOAD_INTERVAL", tt.reloadInterval)
+			t.Setenv("JWT_KEY_ACTIVATION_DELAY", tt.delay)
+
+			cfg, err := LoadJWTConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadJWTConfig: err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.KeyActivationDelay < cfg.KeyReloadInterval {
+				t.Errorf("delay %s is shorter than reload interval %s", cfg.KeyActivationDelay, cfg.KeyReloadInterval)
+			}
+		})
+	}
+}
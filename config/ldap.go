@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LDAPConfig turns on login against an LDAP directory or Active Directory;
+// it is off while URL is empty. Users are looked up with UserFilter, in
+// which %s stands for the escaped username, after binding as BindDN, or
+// anonymously if it is empty. Their groups are read from GroupAttribute of
+// the user's entry, or searched for with GroupFilter, in which %s stands
+// for the user's DN, if it is set. GroupRoles maps group DNs, compared
+// case-insensitively, to the roles their members get.
+type LDAPConfig struct {
+	URL          string
+	StartTLS     bool
+	CAFile       string
+	BindDN       string
+	BindPassword string
+
+	BaseDN            string
+	UserFilter        string
+	UsernameAttribute string
+
+	GroupAttribute string
+	GroupBaseDN    string
+	GroupFilter    string
+	GroupRoles     map[string]string
+}
+
+// LoadLDAPConfig reads the directory settings from the environment;
+// LoadEnv has already loaded the .env file.
+func LoadLDAPConfig() (*LDAPConfig, error) {
+	config := &LDAPConfig{URL: os.Getenv("LDAP_URL")}
+	if config.URL == "" {
+		return config, nil
+	}
+	if !strings.HasPrefix(config.URL, "ldap://") && !strings.HasPrefix(config.URL, "ldaps://") {
+		return nil, fmt.Errorf("invalid LDAP_URL: %q", config.URL)
+	}
+
+	startTLS, err := strconv.ParseBool(getEnv("LDAP_START_TLS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP_START_TLS: %w", err)
+	}
+	config.StartTLS = startTLS
+	config.CAFile = os.Getenv("LDAP_CA_FILE")
+	config.BindDN = os.Getenv("LDAP_BIND_DN")
+	config.BindPassword = os.Getenv("LDAP_BIND_PASSWORD")
+
+	config.BaseDN = os.Getenv("LDAP_BASE_DN")
+	if config.BaseDN == "" {
+		return nil, fmt.Errorf("LDAP_BASE_DN is required with LDAP_URL")
+	}
+	config.UserFilter = getEnv("LDAP_USER_FILTER", "(uid=%s)")
+	if strings.Count(config.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("invalid LDAP_USER_FILTER: %q needs one %%s", config.UserFilter)
+	}
+	config.UsernameAttribute = getEnv("LDAP_USERNAME_ATTRIBUTE", "uid")
+
+	config.GroupAttribute = getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf")
+	config.GroupBaseDN = getEnv("LDAP_GROUP_BASE_DN", config.BaseDN)
+	config.GroupFilter = os.Getenv("LDAP_GROUP_FILTER")
+	if config.GroupFilter != "" && strings.Count(config.GroupFilter, "%s") != 1 {
+		return nil, fmt.Errorf("invalid LDAP_GROUP_FILTER: %q needs one %%s", config.GroupFilter)
+	}
+
+	// Group DNs contain commas and equals signs, so mappings are separated
+	// by semicolons and the role follows the last colon.
+	config.GroupRoles = make(map[string]string)
+	for _, mapping := range strings.Split(os.Getenv("LDAP_GROUP_ROLES"), ";") {
+		mapping = strings.TrimSpace(mapping)
+		if mapping == "" {
+			continue
+		}
+		i := strings.LastIndex(mapping, ":")
+		if i <= 0 || i == len(mapping)-1 {
+			return nil, fmt.Errorf("invalid LDAP_GROUP_ROLES mapping: %q", mapping)
+		}
+		config.GroupRoles[strings.ToLower(strings.TrimSpace(mapping[:i]))] = strings.TrimSpace(mapping[i+1:])
+	}
+	return config, nil
+}
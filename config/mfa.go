@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MFAConfig holds the settings of two-factor authentication. Issuer names
+// this server in authenticator apps.
+type MFAConfig struct {
+	Issuer string
+}
+
+// LoadMFAConfig reads the settings from the environment; LoadEnv has
+// already loaded the .env file.
+func LoadMFAConfig() (*MFAConfig, error) {
+	issuer := getEnv("MFA_ISSUER", "RBAC")
+	// The issuer prefixes the account in otpauth labels, separated by a
+	// colon.
+	if strings.Contains(issuer, ":") {
+		return nil, fmt.Errorf("invalid MFA_ISSUER: %q contains a colon", issuer)
+	}
+	return &MFAConfig{Issuer: issuer}, nil
+}
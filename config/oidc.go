@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// OIDCConfig turns on the OpenID Connect provider. Issuer is the external
+// base URL of this server, e.g. https://auth.example.com; the provider is
+// off while it is empty.
+type OIDCConfig struct {
+	Issuer string
+}
+
+// LoadOIDCConfig reads the provider settings from the environment; LoadEnv
+// has already loaded the .env file. ID tokens are signed like access
+// tokens, with signingMethod, which has to be asymmetric for clients to
+// verify them.
+func LoadOIDCConfig(signingMethod string) (*OIDCConfig, error) {
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer != "" {
+		u, err := url.Parse(issuer)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("invalid OIDC_ISSUER: %q", issuer)
+		}
+		if signingMethod == "HS256" {
+			return nil, fmt.Errorf("OIDC_ISSUER requires an asymmetric JWT_SIGNING_METHOD (RS256, ES256 or EdDSA), as clients cannot verify HS256 ID tokens")
+		}
+	}
+	return &OIDCConfig{Issuer: issuer}, nil
+}
@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestLoadOIDCConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		issuer        string
+		signingMethod string
+		want          string
+		wantErr       bool
+	}{
+		{"off", "", "HS256", "", false},
+		{"asymmetric signing", "https://auth.example.com/", "ES256", "https://auth.example.com", false},
+		{"symmetric signing", "https://auth.example.com", "HS256", "", true},
+		{"relative issuer", "auth.example.com", "RS256", "", true},
+		{"issuer with query", "https://auth.example.com?tenant=1", "EdDSA", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OIDC_ISSUER", tt.issuer)
+
+			cfg, err := LoadOIDCConfig(tt.signingMethod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadOIDCConfig: err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Issuer != tt.want {
+				t.Errorf("issuer = %q, want %q", cfg.Issuer, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// SCIMConfig turns on the SCIM 2.0 provisioning endpoints, which identity
+// providers call with Token as a bearer token; they are off while it is
+// empty.
+type SCIMConfig struct {
+	Token string
+}
+
+// LoadSCIMConfig reads the provisioning token from the environment;
+// LoadEnv has already loaded the .env file.
+func LoadSCIMConfig() (*SCIMConfig, error) {
+	token := os.Getenv("SCIM_TOKEN")
+	if token != "" && len(token) < 32 {
+		return nil, fmt.Errorf("SCIM_TOKEN must be at least 32 characters long")
+	}
+	return &SCIMConfig{Token: token}, nil
+}
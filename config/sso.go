@@ -0,0 +1,104 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SSOConfig lists the external OpenID Connect identity providers users can
+// sign in with. It is read from the JSON file named by SSO_PROVIDERS_FILE,
+// e.g.
+//
+//	{"providers": [{
+//	  "name": "corp",
+//	  "issuer": "https://idp.example.com",
+//	  "client_id": "rbac",
+//	  "client_secret": "...",
+//	  "redirect_uri": "https://auth.example.com/api/sso/corp/callback",
+//	  "role_mappings": [{"claim": "groups", "value": "admins", "role": "admin"}]
+//	}]}
+type SSOConfig struct {
+	Providers []ProviderConfig `json:"providers"`
+}
+
+// ProviderConfig describes one identity provider. Name appears in the
+// login URLs. UsernameClaim names the claim new users are named after,
+// preferred_username by default.
+type ProviderConfig struct {
+	Name          string        `json:"name"`
+	DisplayName   string        `json:"display_name"`
+	Issuer        string        `json:"issuer"`
+	ClientID      string        `json:"client_id"`
+	ClientSecret  string        `json:"client_secret"`
+	RedirectURI   string        `json:"redirect_uri"`
+	Scopes        []string      `json:"scopes"`
+	UsernameClaim string        `json:"username_claim"`
+	RoleMappings  []RoleMapping `json:"role_mappings"`
+}
+
+// RoleMapping grants Role to users whose ID token has Value in Claim, a
+// string or a list of strings. Claim may be a dotted path into nested
+// objects, e.g. realm_access.roles.
+type RoleMapping struct {
+	Claim string `json:"claim"`
+	Value string `json:"value"`
+	Role  string `json:"role"`
+}
+
+var providerName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// LoadSSOConfig reads the identity providers; there are none while
+// SSO_PROVIDERS_FILE is unset. LoadEnv has already loaded the .env file.
+func LoadSSOConfig() (*SSOConfig, error) {
+	file := os.Getenv("SSO_PROVIDERS_FILE")
+	if file == "" {
+		return &SSOConfig{}, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config SSOConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	names := make(map[string]bool)
+	for i := range config.Providers {
+		provider := &config.Providers[i]
+		if !providerName.MatchString(provider.Name) || names[provider.Name] {
+			return nil, fmt.Errorf("%s: invalid or duplicate provider name %q", file, provider.Name)
+		}
+		names[provider.Name] = true
+
+		provider.Issuer = strings.TrimSuffix(provider.Issuer, "/")
+		if !isHTTPURL(provider.Issuer) || !isHTTPURL(provider.RedirectURI) || provider.ClientID == "" {
+			return nil, fmt.Errorf("%s: provider %s needs an issuer, a client_id and a redirect_uri", file, provider.Name)
+		}
+		if provider.DisplayName == "" {
+			provider.DisplayName = provider.Name
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "profile", "email"}
+		}
+		if provider.UsernameClaim == "" {
+			provider.UsernameClaim = "preferred_username"
+		}
+		for _, mapping := range provider.RoleMappings {
+			if mapping.Claim == "" || mapping.Value == "" || mapping.Role == "" {
+				return nil, fmt.Errorf("%s: provider %s has a role mapping without claim, value or role", file, provider.Name)
+			}
+		}
+	}
+	return &config, nil
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
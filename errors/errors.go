@@ -3,15 +3,40 @@ package errors
 import "errors"
 
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrDuplicateUsername = errors.New("username already exists")
-	ErrInvalidRole       = errors.New("invalid role")
-	ErrInvalidPermission = errors.New("invalid permission")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrDuplicateUsername   = errors.New("username already exists")
+	ErrInvalidRole         = errors.New("invalid role")
+	ErrInvalidPermission   = errors.New("invalid permission")
+	ErrRoleNotFound        = errors.New("role not found")
+	ErrDuplicateRole       = errors.New("role already exists")
+	ErrRoleCycle           = errors.New("role hierarchy cycle")
+	ErrPermissionNotFound  = errors.New("permission not found")
+	ErrDuplicatePermission = errors.New("permission already exists")
+	ErrPermissionInUse     = errors.New("permission is still assigned to roles")
+	ErrGroupNotFound       = errors.New("group not found")
+	ErrDuplicateGroup      = errors.New("group already exists")
+	ErrNotGroupMember      = errors.New("user is not a member of the group")
+	ErrTenantNotFound      = errors.New("tenant not found")
+	ErrDuplicateTenant     = errors.New("tenant already exists")
+	ErrBindingNotFound     = errors.New("resource binding not found")
+	ErrTokenNotFound       = errors.New("refresh token not found")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrUserDisabled        = errors.New("user is disabled")
+	ErrClientNotFound      = errors.New("oauth client not found")
+	ErrCodeNotFound        = errors.New("authorization code not found")
+	ErrIdentityNotFound    = errors.New("identity not found")
+	ErrLoginStateNotFound  = errors.New("login state not found")
+	ErrMissingUsername     = errors.New("identity has no username")
+	ErrTOTPNotFound        = errors.New("totp not enrolled")
+	ErrTOTPEnabled         = errors.New("totp already enabled")
+	ErrInvalidMFACode      = errors.New("invalid authentication code")
+	ErrChallengeNotFound   = errors.New("mfa challenge not found")
+	ErrMFALocked           = errors.New("too many failed authentication codes")
 )
 
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
 	Code    int    `json:"code"`
-} 
\ No newline at end of file
+}
@@ -1,37 +1,73 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
+	"log"
 	"net/http"
+	"rbac/authn"
+	"rbac/authz"
+	apperrors "rbac/errors"
+	"rbac/store"
 	"rbac/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	db *sql.DB
+	users         store.UserStore
+	tenants       store.TenantStore
+	refreshTokens store.RefreshTokenStore
+	sessions      store.SessionStore
+	authenticator authn.Authenticator
+	authorizer    *authz.Authorizer
+	tokens        *authz.TokenPolicy
+	mfa           *authn.MFA
 }
 
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	TenantID int    `json:"tenant_id"`
 }
 
+// LoginResponse carries RecoveryCodes when the login confirmed the user's
+// authenticator.
 type LoginResponse struct {
-	AccessToken  string   `json:"access_token"`
-	RefreshToken string   `json:"refresh_token"`
-	User         UserInfo `json:"user"`
+	AccessToken   string   `json:"access_token"`
+	RefreshToken  string   `json:"refresh_token"`
+	User          UserInfo `json:"user"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// MFAChallengeResponse answers a login that needs a second factor; the
+// token is exchanged with a code at LoginMFA. EnrollmentRequired means the
+// user has no authenticator yet and sets one up with the token first.
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	MFAToken           string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"enrollment_required,omitempty"`
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFAEnrollLoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
 }
 
 type UserInfo struct {
 	ID       int      `json:"id"`
 	Username string   `json:"username"`
 	Roles    []string `json:"roles"`
+	TenantID int      `json:"tenant_id,omitempty"`
 }
 
-func NewAuthHandler(db *sql.DB) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(users store.UserStore, tenants store.TenantStore, refreshTokens store.RefreshTokenStore, sessions store.SessionStore, authenticator authn.Authenticator, authorizer *authz.Authorizer, tokens *authz.TokenPolicy, mfa *authn.MFA) *AuthHandler {
+	return &AuthHandler{users: users, tenants: tenants, refreshTokens: refreshTokens, sessions: sessions, authenticator: authenticator, authorizer: authorizer, tokens: tokens, mfa: mfa}
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -41,61 +77,150 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	var user struct {
-		ID       int
-		Username string
-		Password string
+	user, err := h.authenticate(req.Username, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		case errors.Is(err, apperrors.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "User is disabled"})
+		case errors.Is(err, apperrors.ErrDuplicateUsername):
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		default:
+			log.Printf("Failed to authenticate %q: %v", req.Username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate user"})
+		}
+		return
+	}
+
+	if !h.checkTenantAccess(c, user.ID, req.TenantID) {
+		return
 	}
-	err := h.db.QueryRow("SELECT id, username, password FROM users WHERE username = ?", 
-		req.Username).Scan(&user.ID, &user.Username, &user.Password)
+
+	roles, err := h.authorizer.UserRoles(user, req.TenantID)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user roles"})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	if h.challengeMFA(c, user.ID, req.TenantID) {
 		return
 	}
 
-	rows, err := h.db.Query(`
-		SELECT r.name FROM roles r
-		JOIN user_roles ur ON r.id = ur.role_id
-		WHERE ur.user_id = ?
-	`, user.ID)
+	h.respondLogin(c, user, roles, req.TenantID, nil)
+}
+
+// challengeMFA responds and reports true unless the user may sign in
+// without a second factor: with an MFA challenge if they have an
+// authenticator or a role requiring one, or with an error.
+func (h *AuthHandler) challengeMFA(c *gin.Context, userID, tenantID int) bool {
+	enabled, required, err := h.mfa.Status(userID, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor authentication"})
+		return true
+	}
+	if !enabled && !required {
+		return false
+	}
+
+	token, err := h.mfa.Challenge(userID, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor authentication"})
+		return true
+	}
+	c.JSON(http.StatusOK, MFAChallengeResponse{
+		MFARequired:        true,
+		MFAToken:           token,
+		EnrollmentRequired: !enabled,
+		ExpiresIn:          int(authn.ChallengeTTL.Seconds()),
+	})
+	return true
+}
+
+// LoginMFA completes a login that needs a second factor: a code from the
+// user's authenticator or one of their recovery codes. A user who enrolled
+// with EnrollLoginMFA confirms their authenticator here.
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, recoveryCodes, err := h.mfa.Answer(req.MFAToken, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrChallengeNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		case errors.Is(err, apperrors.ErrInvalidMFACode):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		case errors.Is(err, apperrors.ErrMFALocked):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid authentication codes, try again later"})
+		default:
+			log.Printf("Failed to verify authentication code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authentication code"})
+		}
+		return
+	}
+
+	user, ok := h.challengeUser(c, challenge)
+	if !ok {
+		return
+	}
+
+	if !h.checkTenantAccess(c, user.ID, challenge.TenantID) {
+		return
+	}
+
+	roles, err := h.authorizer.UserRoles(user, challenge.TenantID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user roles"})
 		return
 	}
-	defer rows.Close()
 
-	var roles []string
-	for rows.Next() {
-		var role string
-		if err := rows.Scan(&role); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process user roles"})
+	h.respondLogin(c, user, roles, challenge.TenantID, recoveryCodes)
+}
+
+// EnrollLoginMFA sets up an authenticator for a user whose roles require
+// one, before their first login completes.
+func (h *AuthHandler) EnrollLoginMFA(c *gin.Context) {
+	var req MFAEnrollLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, err := h.mfa.Pending(req.MFAToken)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrChallengeNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
 			return
 		}
-		roles = append(roles, role)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch MFA challenge"})
+		return
 	}
 
-	accessToken, refreshToken, err := utils.GenerateJWT(user.ID, user.Username, roles)
+	user, ok := h.challengeUser(c, challenge)
+	if !ok {
+		return
+	}
+
+	secret, uri, err := h.mfa.Enroll(user.ID, user.Username)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		if errors.Is(err, apperrors.ErrTOTPEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Authenticator already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll authenticator"})
 		return
 	}
 
-	c.JSON(http.StatusOK, LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		User: UserInfo{
-			ID:       user.ID,
-			Username: user.Username,
-			Roles:    roles,
-		},
-	})
+	c.JSON(http.StatusOK, TOTPEnrollmentResponse{Secret: secret, URI: uri})
 }
 
+// RefreshToken exchanges a refresh token for a new pair. Every refresh
+// token can be used once; presenting one again means it was stolen, or the
+// thief already used it, so its whole family is revoked.
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	refreshToken := c.GetHeader("X-Refresh-Token")
 	if refreshToken == "" {
@@ -103,20 +228,215 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	claims, err := utils.ValidateJWT(refreshToken)
+	claims, err := utils.ValidateJWT(refreshToken, utils.RefreshToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	accessToken, newRefreshToken, err := utils.GenerateJWT(claims.UserID, claims.Username, claims.Roles)
+	record, err := h.refreshTokens.GetRefreshToken(utils.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, apperrors.ErrTokenNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refresh token"})
+		return
+	}
+	if !record.RevokedAt.IsZero() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token revoked"})
+		return
+	}
+
+	unused, err := h.refreshTokens.UseRefreshToken(record.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use refresh token"})
+		return
+	}
+	if !unused {
+		log.Printf("refresh token reuse for user %d, revoking token family %s", record.UserID, record.FamilyID)
+		if err := h.refreshTokens.RevokeRefreshTokenFamily(record.UserID, record.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh tokens"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected"})
+		return
+	}
+
+	// The claims may be days old; the user may have been deleted, disabled
+	// or given other roles since.
+	user, err := h.users.GetUser(claims.UserID)
+	if err != nil && !errors.Is(err, apperrors.ErrUserNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	if err != nil || user.Disabled {
+		if err := h.refreshTokens.RevokeRefreshTokenFamily(record.UserID, record.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh tokens"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or disabled"})
+		return
+	}
+
+	if !h.checkTenantAccess(c, user.ID, claims.TenantID) {
+		return
+	}
+
+	roles, err := h.authorizer.UserRoles(user, claims.TenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user roles"})
+		return
+	}
+
+	permissions, policyVersion, err := h.tokens.Issue(user.ID, claims.TenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user permissions"})
+		return
+	}
+
+	accessToken, newRefreshToken, err := h.issueTokens(utils.JWTClaim{
+		UserID:        user.ID,
+		Username:      user.Username,
+		Roles:         roles,
+		TenantID:      claims.TenantID,
+		Permissions:   permissions,
+		PolicyVersion: policyVersion,
+		SessionID:     claims.SessionID,
+	}, record.FamilyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 		return
 	}
 
+	if err := h.sessions.TouchSession(claims.SessionID, c.ClientIP(), time.Now().Add(utils.RefreshTokenTTL)); err != nil {
+		log.Printf("Failed to update session %d: %v", claims.SessionID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"access_token":  accessToken,
 		"refresh_token": newRefreshToken,
 	})
-} 
\ No newline at end of file
+}
+
+// authenticate checks a username and password, failing with
+// ErrInvalidCredentials or ErrUserDisabled.
+func (h *AuthHandler) authenticate(username, password string) (*store.User, error) {
+	return h.authenticator.Authenticate(username, password)
+}
+
+// challengeUser responds with an error and reports false unless the user
+// of the challenge still exists and is enabled.
+func (h *AuthHandler) challengeUser(c *gin.Context, challenge *store.MFAChallenge) (*store.User, bool) {
+	user, err := h.users.GetUser(challenge.UserID)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return nil, false
+	}
+	if user.Disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is disabled"})
+		return nil, false
+	}
+	return user, true
+}
+
+// respondLogin opens a session and responds with its tokens.
+func (h *AuthHandler) respondLogin(c *gin.Context, user *store.User, roles []string, tenantID int, recoveryCodes []string) {
+	accessToken, refreshToken, err := h.startSession(c, user, roles, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		User: UserInfo{
+			ID:       user.ID,
+			Username: user.Username,
+			Roles:    roles,
+			TenantID: tenantID,
+		},
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// startSession opens a session for a signed-in user and returns its access
+// and refresh tokens.
+func (h *AuthHandler) startSession(c *gin.Context, user *store.User, roles []string, tenantID int) (string, string, error) {
+	permissions, policyVersion, err := h.tokens.Issue(user.ID, tenantID)
+	if err != nil {
+		return "", "", err
+	}
+
+	familyID, err := utils.RandomID()
+	if err != nil {
+		return "", "", err
+	}
+
+	sessionID, err := h.sessions.CreateSession(store.Session{
+		UserID:    user.ID,
+		TenantID:  tenantID,
+		FamilyID:  familyID,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return h.issueTokens(utils.JWTClaim{
+		UserID:        user.ID,
+		Username:      user.Username,
+		Roles:         roles,
+		TenantID:      tenantID,
+		Permissions:   permissions,
+		PolicyVersion: policyVersion,
+		SessionID:     sessionID,
+	}, familyID)
+}
+
+// checkTenantAccess responds with an error and reports false unless the
+// user holds a role in the tenant. A tenantID of 0 needs no access.
+func (h *AuthHandler) checkTenantAccess(c *gin.Context, userID, tenantID int) bool {
+	if tenantID == 0 {
+		return true
+	}
+
+	tenantRoles, _, err := h.tenants.GetUserTenantRoles(tenantID, userID)
+	if err != nil && !errors.Is(err, apperrors.ErrTenantNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tenant roles"})
+		return false
+	}
+	if len(tenantRoles) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User has no access to this tenant"})
+		return false
+	}
+	return true
+}
+
+// issueTokens signs a token pair and records the refresh token in the
+// family.
+func (h *AuthHandler) issueTokens(claims utils.JWTClaim, familyID string) (string, string, error) {
+	accessToken, refreshToken, err := utils.GenerateJWT(claims, familyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = h.refreshTokens.CreateRefreshToken(store.RefreshToken{
+		UserID:    claims.UserID,
+		TenantID:  claims.TenantID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rbac/authn"
+	"rbac/authz"
+	"rbac/store"
+	"rbac/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestAuthRouter serves login and refresh for alice, whose password is
+// "secret1", signing tokens with a fresh key.
+func newTestAuthRouter(t *testing.T) (*gin.Engine, *store.MemoryStore, int) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	key, _, err := utils.GenerateSigningKey("HS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.SetKeyring(utils.NewKeyring(key))
+	t.Cleanup(func() { utils.SetKeyring(nil) })
+
+	s := store.NewMemoryStore()
+	if _, err := s.CreateRole(store.Role{Name: "user"}); err != nil {
+		t.Fatal(err)
+	}
+	password, err := bcrypt.GenerateFromPassword([]byte("secret1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := s.CreateUser(store.User{Username: "alice", Password: string(password), Roles: []string{"user"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizer := authz.NewAuthorizer(s, s, s, s, s, nil)
+	h := NewAuthHandler(s, s, s, s, authn.NewLocal(s), authorizer, nil, authn.NewMFA(s, authorizer, "RBAC"))
+	router := gin.New()
+	router.POST("/login", h.Login)
+	router.POST("/refresh", h.RefreshToken)
+	return router, s, userID
+}
+
+func serve(router *gin.Engine, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func loginAlice(t *testing.T, router *gin.Engine) LoginResponse {
+	t.Helper()
+	w := serve(router, http.MethodPost, "/login", `{"username":"alice","password":"secret1"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	var response LoginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func refresh(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	return serve(router, http.MethodPost, "/refresh", "", map[string]string{"X-Refresh-Token": token})
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	router, s, _ := newTestAuthRouter(t)
+	login := loginAlice(t, router)
+	tokens := map[string]string{"login": login.RefreshToken}
+
+	steps := []struct {
+		name       string
+		use        string
+		wantStatus int
+		wantError  string
+		save       string
+	}{
+		{"login token rotates", "login", http.StatusOK, "", "first"},
+		{"rotated token rotates", "first", http.StatusOK, "", "second"},
+		{"used token is reuse", "login", http.StatusUnauthorized, "Refresh token reuse detected", ""},
+		{"family is revoked after reuse", "second", http.StatusUnauthorized, "Refresh token revoked", ""},
+		{"used token stays refused", "first", http.StatusUnauthorized, "Refresh token revoked", ""},
+	}
+
+	for _, step := range steps {
+		w := refresh(router, tokens[step.use])
+		if w.Code != step.wantStatus {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, w.Code, step.wantStatus, w.Body)
+		}
+
+		var response map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if response["error"] != step.wantError {
+			t.Errorf("%s: error %q, want %q", step.name, response["error"], step.wantError)
+		}
+		if step.save != "" {
+			if response["refresh_token"] == "" || response["refresh_token"] == tokens[step.use] {
+				t.Fatalf("%s: refresh token not rotated", step.name)
+			}
+			if _, err := utils.ValidateJWT(response["access_token"], utils.AccessToken); err != nil {
+				t.Fatalf("%s: access token: %v", step.name, err)
+			}
+			tokens[step.save] = response["refresh_token"]
+		}
+	}
+
+	claims, err := utils.ValidateJWT(login.AccessToken, utils.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := s.GetSession(claims.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.RevokedAt.IsZero() {
+		t.Error("session not revoked after refresh token reuse")
+	}
+}
+
+func TestRefreshTokenRefused(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      func(t *testing.T, router *gin.Engine, s *store.MemoryStore, userID int) string
+		wantStatus int
+	}{
+		{
+			name:       "missing token",
+			token:      func(*testing.T, *gin.Engine, *store.MemoryStore, int) string { return "" },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "malformed token",
+			token:      func(*testing.T, *gin.Engine, *store.MemoryStore, int) string { return "not-a-token" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "access token",
+			token: func(t *testing.T, router *gin.Engine, _ *store.MemoryStore, _ int) string {
+				return loginAlice(t, router).AccessToken
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "token never stored",
+			token: func(t *testing.T, _ *gin.Engine, _ *store.MemoryStore, userID int) string {
+				_, refreshToken, err := utils.GenerateJWT(utils.JWTClaim{UserID: userID}, "unknown")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return refreshToken
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "disabled user",
+			token: func(t *testing.T, router *gin.Engine, s *store.MemoryStore, userID int) string {
+				token := loginAlice(t, router).RefreshToken
+				if err := s.SetUserDisabled(userID, true); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, s, userID := newTestAuthRouter(t)
+			if w := refresh(router, tt.token(t, router, s, userID)); w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rbac/authz"
+	apperrors "rbac/errors"
+	"rbac/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthzHandler struct {
+	authorizer *authz.Authorizer
+}
+
+type ExplainRequest struct {
+	UserID     int             `json:"user_id" binding:"required"`
+	Permission string          `json:"permission" binding:"required"`
+	TenantID   int             `json:"tenant_id"`
+	Resource   *ResourceParams `json:"resource"`
+	IP         string          `json:"ip"`
+}
+
+type ResourceParams struct {
+	Type string `json:"type" binding:"required"`
+	ID   string `json:"id" binding:"required"`
+}
+
+type CheckRequest struct {
+	Permissions []string        `json:"permissions"`
+	Resources   []ResourceCheck `json:"resources" binding:"dive"`
+}
+
+type ResourceCheck struct {
+	Type        string   `json:"type" binding:"required"`
+	ID          string   `json:"id" binding:"required"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type CheckResponse struct {
+	Permissions map[string]bool       `json:"permissions"`
+	Resources   []ResourceCheckResult `json:"resources"`
+}
+
+type ResourceCheckResult struct {
+	Type        string          `json:"type"`
+	ID          string          `json:"id"`
+	Permissions map[string]bool `json:"permissions"`
+}
+
+// maxChecks bounds the permissions evaluated by one CheckPermissions call.
+const maxChecks = 200
+
+func NewAuthzHandler(authorizer *authz.Authorizer) *AuthzHandler {
+	return &AuthzHandler{authorizer: authorizer}
+}
+
+func (h *AuthzHandler) GetDecision(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	permission := c.Query("permission")
+	if permission == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission is required"})
+		return
+	}
+
+	tenantID := 0
+	if param := c.Query("tenant_id"); param != "" {
+		tenantID, err = strconv.Atoi(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+			return
+		}
+	}
+
+	var resource *authz.Resource
+	if resourceType := c.Query("resource_type"); resourceType != "" {
+		resource = &authz.Resource{Type: resourceType, ID: c.Query("resource_id")}
+	}
+
+	decision, err := h.authorizer.Decide(authz.Request{
+		UserID:     userID,
+		TenantID:   tenantID,
+		Permission: permission,
+		Resource:   resource,
+		Env:        authz.Env{IP: c.Query("ip"), Time: time.Now()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate permission"})
+		return
+	}
+
+	c.JSON(http.StatusOK, decision)
+}
+
+func (h *AuthzHandler) Explain(c *gin.Context) {
+	var req ExplainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var resource *authz.Resource
+	if req.Resource != nil {
+		resource = &authz.Resource{Type: req.Resource.Type, ID: req.Resource.ID}
+	}
+
+	explanation, err := h.authorizer.Explain(authz.Request{
+		UserID:     req.UserID,
+		TenantID:   req.TenantID,
+		Permission: req.Permission,
+		Resource:   resource,
+		Env:        authz.Env{IP: req.IP, Time: time.Now()},
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, apperrors.ErrTenantNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate permission"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, explanation)
+}
+
+// CheckPermissions answers for the caller, with the same evaluation as
+// AuthMiddleware.RequirePermission, whether they hold each permission
+// unscoped and on each listed resource.
+func (h *AuthzHandler) CheckPermissions(c *gin.Context) {
+	var req CheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	base := authz.Request{
+		UserID:   c.GetInt("user_id"),
+		TenantID: c.GetInt("tenant_id"),
+		Env:      middleware.RequestEnv(c),
+	}
+
+	var reqs []authz.Request
+	for _, permission := range req.Permissions {
+		r := base
+		r.Permission = permission
+		reqs = append(reqs, r)
+	}
+	for _, resource := range req.Resources {
+		for _, permission := range resource.Permissions {
+			r := base
+			r.Permission = permission
+			r.Resource = &authz.Resource{Type: resource.Type, ID: resource.ID}
+			reqs = append(reqs, r)
+		}
+	}
+	if len(reqs) > maxChecks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many checks"})
+		return
+	}
+
+	allowed, err := h.authorizer.AuthorizeAll(reqs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate permissions"})
+		return
+	}
+
+	response := CheckResponse{
+		Permissions: make(map[string]bool),
+		Resources:   []ResourceCheckResult{},
+	}
+	i := 0
+	for _, permission := range req.Permissions {
+		response.Permissions[permission] = allowed[i]
+		i++
+	}
+	for _, resource := range req.Resources {
+		result := ResourceCheckResult{Type: resource.Type, ID: resource.ID, Permissions: make(map[string]bool)}
+		for _, permission := range resource.Permissions {
+			result.Permissions[permission] = allowed[i]
+			i++
+		}
+		response.Resources = append(response.Resources, result)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *AuthzHandler) GetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.authorizer.CacheStats())
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rbac/authz"
+	"rbac/middleware"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+var checkedPermissions = []string{"view_post", "edit_post", "delete_post", "publish_post"}
+
+// newTestCheckRouter serves the check endpoint and, for every permission,
+// routes guarded by RequirePermission and RequireResourcePermission on
+// posts, all for alice logged in to tenant, or to none when it is empty.
+// alice may view_post, is granted and denied edit_post, may delete_post
+// from 10.0.0.0/8, may publish_post within tenant acme and on post 42
+// through a binding.
+func newTestCheckRouter(t *testing.T, tenant string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s := store.NewMemoryStore()
+	for _, name := range checkedPermissions {
+		if _, err := s.CreatePermission(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acme, err := s.CreateTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []store.Role{
+		{Name: "viewer", Permissions: []string{"view_post"}},
+		{Name: "writer", Permissions: []string{"edit_post"}},
+		{Name: "blocked", DeniedPermissions: []string{"edit_post"}},
+		{
+			Name:                 "office",
+			Permissions:          []string{"delete_post"},
+			PermissionConditions: map[string]string{"delete_post": `ip_in(request.ip, "10.0.0.0/8")`},
+		},
+		{Name: "owner", Permissions: []string{"publish_post"}},
+		{Name: "publisher", TenantID: acme, Permissions: []string{"publish_post"}},
+	} {
+		if _, err := s.CreateRole(role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice, err := s.CreateUser(store.User{Username: "alice", Roles: []string{"viewer", "writer", "blocked", "office"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUserTenantRoles(acme, alice, []string{"publisher"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateResourceBinding(store.ResourceBinding{UserID: alice, Role: "owner", ResourceType: "post", ResourceID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tenantID := 0
+	if tenant == "acme" {
+		tenantID = acme
+	}
+	authorizer := authz.NewAuthorizer(s, s, s, s, s, nil)
+	m := middleware.NewAuthMiddleware(authorizer, nil, s)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", alice)
+		c.Set("tenant_id", tenantID)
+	})
+	router.POST("/authz/check", NewAuthzHandler(authorizer).CheckPermissions)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	for _, permission := range checkedPermissions {
+		router.GET("/require/"+permission, m.RequirePermission(permission), ok)
+		router.GET("/require/"+permission+"/posts/:id", m.RequireResourcePermission(permission, "post", "id"), ok)
+	}
+	return router
+}
+
+func serveFrom(router *gin.Engine, ip, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":40000"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCheckPermissions(t *testing.T) {
+	tests := []struct {
+		name   string
+		tenant string
+		ip     string
+		// want lists the permissions allowed unscoped and on posts 42 and 7.
+		want, want42, want7 []string
+	}{
+		{
+			name:   "outside tenants",
+			ip:     "192.0.2.1",
+			want:   []string{"view_post"},
+			want42: []string{"view_post", "publish_post"},
+			want7:  []string{"view_post"},
+		},
+		{
+			name:   "condition met",
+			ip:     "10.1.2.3",
+			want:   []string{"view_post", "delete_post"},
+			want42: []string{"view_post", "delete_post", "publish_post"},
+			want7:  []string{"view_post", "delete_post"},
+		},
+		{
+			name:   "within tenant",
+			tenant: "acme",
+			ip:     "192.0.2.1",
+			want:   []string{"view_post", "publish_post"},
+			want42: []string{"view_post", "publish_post"},
+			want7:  []string{"view_post", "publish_post"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestCheckRouter(t, tt.tenant)
+			permissions, _ := json.Marshal(checkedPermissions)
+			body := fmt.Sprintf(`{"permissions":%s,"resources":[{"type":"post","id":"42","permissions":%s},{"type":"post","id":"7","permissions":%s}]}`,
+				permissions, permissions, permissions)
+			w := serveFrom(router, tt.ip, http.MethodPost, "/authz/check", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var response CheckResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Resources) != 2 || response.Resources[0].ID != "42" || response.Resources[1].ID != "7" {
+				t.Fatalf("resources %+v, want posts 42 and 7 in order", response.Resources)
+			}
+
+			for _, check := range []struct {
+				scope   string
+				results map[string]bool
+				want    []string
+				path    string
+			}{
+				{"unscoped", response.Permissions, tt.want, ""},
+				{"post 42", response.Resources[0].Permissions, tt.want42, "/posts/42"},
+				{"post 7", response.Resources[1].Permissions, tt.want7, "/posts/7"},
+			} {
+				for _, permission := range checkedPermissions {
+					allowed, ok := check.results[permission]
+					if !ok {
+						t.Errorf("%s: no result for %s", check.scope, permission)
+					}
+					want := false
+					for _, p := range check.want {
+						want = want || p == permission
+					}
+					if allowed != want {
+						t.Errorf("%s: %s allowed %v, want %v", check.scope, permission, allowed, want)
+					}
+
+					// The guarded route decides the same way.
+					w := serveFrom(router, tt.ip, http.MethodGet, "/require/"+permission+check.path, "")
+					if routeAllowed := w.Code == http.StatusOK; routeAllowed != allowed {
+						t.Errorf("%s: %s checked %v, but the guarded route answered %d", check.scope, permission, allowed, w.Code)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCheckPermissionsLimit(t *testing.T) {
+	permissions := func(n int) string {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf(`"perm_%d"`, i)
+		}
+		return "[" + strings.Join(names, ",") + "]"
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"at the limit", `{"permissions":` + permissions(maxChecks) + `}`, http.StatusOK},
+		{"over the limit", `{"permissions":` + permissions(maxChecks+1) + `}`, http.StatusBadRequest},
+		{
+			name:       "over the limit across resources",
+			body:       `{"permissions":` + permissions(maxChecks/2) + `,"resources":[{"type":"post","id":"1","permissions":` + permissions(maxChecks/2+1) + `}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestCheckRouter(t, "")
+			if w := serveFrom(router, "192.0.2.1", http.MethodPost, "/authz/check", tt.body); w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rbac/authz"
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BindingHandler struct {
+	bindings store.BindingStore
+}
+
+type BindingResponse struct {
+	ID           int    `json:"id"`
+	UserID       int    `json:"user_id"`
+	Role         string `json:"role"`
+	TenantID     int    `json:"tenant_id,omitempty"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Condition    string `json:"condition,omitempty"`
+}
+
+type CreateBindingRequest struct {
+	UserID       int    `json:"user_id" binding:"required"`
+	Role         string `json:"role" binding:"required"`
+	TenantID     int    `json:"tenant_id"`
+	ResourceType string `json:"resource_type" binding:"required"`
+	ResourceID   string `json:"resource_id" binding:"required"`
+	Condition    string `json:"condition"`
+}
+
+func NewBindingHandler(bindings store.BindingStore) *BindingHandler {
+	return &BindingHandler{bindings: bindings}
+}
+
+func (h *BindingHandler) GetBindings(c *gin.Context) {
+	var bindings []store.ResourceBinding
+	var err error
+	if param := c.Query("user_id"); param != "" {
+		userID, convErr := strconv.Atoi(param)
+		if convErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		bindings, err = h.bindings.GetUserResourceBindings(userID)
+	} else {
+		bindings, err = h.bindings.GetResourceBindings()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bindings"})
+		return
+	}
+
+	var response []BindingResponse
+	for _, binding := range bindings {
+		response = append(response, BindingResponse{
+			ID:           binding.ID,
+			UserID:       binding.UserID,
+			Role:         binding.Role,
+			TenantID:     binding.TenantID,
+			ResourceType: binding.ResourceType,
+			ResourceID:   binding.ResourceID,
+			Condition:    binding.Condition,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *BindingHandler) CreateBinding(c *gin.Context) {
+	var req CreateBindingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := authz.ValidateCondition(req.Condition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bindingID, err := h.bindings.CreateResourceBinding(store.ResourceBinding{
+		UserID:       req.UserID,
+		Role:         req.Role,
+		TenantID:     req.TenantID,
+		ResourceType: req.ResourceType,
+		ResourceID:   req.ResourceID,
+		Condition:    req.Condition,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrUserNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+		case errors.Is(err, apperrors.ErrTenantNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tenant not found"})
+		case errors.Is(err, apperrors.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create binding"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": bindingID, "message": "Binding created successfully"})
+}
+
+func (h *BindingHandler) DeleteBinding(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid binding ID"})
+		return
+	}
+
+	if err := h.bindings.DeleteResourceBinding(id); err != nil {
+		if errors.Is(err, apperrors.ErrBindingNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Binding not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete binding"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Binding deleted successfully"})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	apperrors "rbac/errors"
+	"rbac/store"
+	"rbac/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ClientHandler struct {
+	clients store.OAuthStore
+}
+
+type ClientResponse struct {
+	ID           int      `json:"id"`
+	ClientID     string   `json:"client_id"`
+	Name         string   `json:"name"`
+	Public       bool     `json:"public"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// CreateClientRequest registers an application. Public clients, such as
+// single-page and mobile apps, get no secret and rely on PKCE alone.
+type CreateClientRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1"`
+	Public       bool     `json:"public"`
+}
+
+func NewClientHandler(clients store.OAuthStore) *ClientHandler {
+	return &ClientHandler{clients: clients}
+}
+
+func (h *ClientHandler) GetClients(c *gin.Context) {
+	clients, err := h.clients.GetOAuthClients()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch clients"})
+		return
+	}
+
+	response := []ClientResponse{}
+	for _, client := range clients {
+		response = append(response, ClientResponse{
+			ID:           client.ID,
+			ClientID:     client.ClientID,
+			Name:         client.Name,
+			Public:       client.SecretHash == "",
+			RedirectURIs: client.RedirectURIs,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateClient returns the client secret; only its hash is kept, so it
+// cannot be shown again.
+func (h *ClientHandler) CreateClient(c *gin.Context) {
+	var req CreateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, redirectURI := range req.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	clientID, err := utils.RandomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create client"})
+		return
+	}
+
+	var secret, secretHash string
+	if !req.Public {
+		if secret, err = utils.RandomID(); err == nil {
+			var hash []byte
+			hash, err = bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+			secretHash = string(hash)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create client"})
+			return
+		}
+	}
+
+	id, err := h.clients.CreateOAuthClient(store.OAuthClient{
+		ClientID:     clientID,
+		Name:         req.Name,
+		SecretHash:   secretHash,
+		RedirectURIs: req.RedirectURIs,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create client"})
+		return
+	}
+
+	response := gin.H{"id": id, "client_id": clientID, "message": "Client created successfully"}
+	if secret != "" {
+		response["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+func (h *ClientHandler) DeleteClient(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return
+	}
+
+	if err := h.clients.DeleteOAuthClient(id); err != nil {
+		if errors.Is(err, apperrors.ErrClientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Client deleted successfully"})
+}
+
+func validateRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("invalid redirect URI: %q", redirectURI)
+	}
+	return nil
+}
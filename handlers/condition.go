@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"fmt"
+
+	"rbac/authz"
+)
+
+// validateConditions checks that every condition compiles and belongs to
+// one of the names it is attached to.
+func validateConditions(conditions map[string]string, names []string) error {
+	for name, source := range conditions {
+		if !contains(names, name) {
+			return fmt.Errorf("condition given for unassigned %q", name)
+		}
+		if err := authz.ValidateCondition(source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GroupHandler struct {
+	groups store.GroupStore
+}
+
+type GroupResponse struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+type GroupMemberResponse struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+type CreateGroupRequest struct {
+	Name  string   `json:"name" binding:"required"`
+	Roles []string `json:"roles"`
+}
+
+type UpdateGroupRequest struct {
+	Name  string   `json:"name" binding:"required"`
+	Roles []string `json:"roles"`
+}
+
+type AddGroupMemberRequest struct {
+	UserID int `json:"user_id" binding:"required"`
+}
+
+func NewGroupHandler(groups store.GroupStore) *GroupHandler {
+	return &GroupHandler{groups: groups}
+}
+
+func (h *GroupHandler) GetGroups(c *gin.Context) {
+	groups, err := h.groups.GetGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
+		return
+	}
+
+	var response []GroupResponse
+	for _, group := range groups {
+		response = append(response, toGroupResponse(group))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *GroupHandler) GetGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	group, err := h.groups.GetGroup(id)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrGroupNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toGroupResponse(*group))
+}
+
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	var req CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groupID, err := h.groups.CreateGroup(store.Group{Name: req.Name, Roles: req.Roles})
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrDuplicateGroup):
+			c.JSON(http.StatusConflict, gin.H{"error": "Group already exists"})
+		case errors.Is(err, apperrors.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": groupID, "message": "Group created successfully"})
+}
+
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.groups.UpdateGroup(store.Group{ID: id, Name: req.Name, Roles: req.Roles}); err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrGroupNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		case errors.Is(err, apperrors.ErrDuplicateGroup):
+			c.JSON(http.StatusConflict, gin.H{"error": "Group already exists"})
+		case errors.Is(err, apperrors.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group updated successfully"})
+}
+
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	if err := h.groups.DeleteGroup(id); err != nil {
+		if errors.Is(err, apperrors.ErrGroupNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
+}
+
+func (h *GroupHandler) GetGroupMembers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	members, err := h.groups.GetGroupMembers(id)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrGroupNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group members"})
+		return
+	}
+
+	var response []GroupMemberResponse
+	for _, member := range members {
+		response = append(response, GroupMemberResponse{ID: member.ID, Username: member.Username})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *GroupHandler) AddGroupMember(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req AddGroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.groups.AddGroupMember(id, req.UserID); err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrGroupNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		case errors.Is(err, apperrors.ErrUserNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add group member"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group member added successfully"})
+}
+
+func (h *GroupHandler) RemoveGroupMember(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.groups.RemoveGroupMember(id, userID); err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrGroupNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		case errors.Is(err, apperrors.ErrNotGroupMember):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of the group"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove group member"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group member removed successfully"})
+}
+
+func toGroupResponse(group store.Group) GroupResponse {
+	return GroupResponse{
+		ID:    group.ID,
+		Name:  group.Name,
+		Roles: group.Roles,
+	}
+}
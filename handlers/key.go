@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"rbac/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KeyHandler struct {
+	keys *utils.Keyring
+}
+
+func NewKeyHandler(keys *utils.Keyring) *KeyHandler {
+	return &KeyHandler{keys: keys}
+}
+
+// GetJWKS publishes the public keys that verify our tokens, so other
+// services need no shared secret.
+func (h *KeyHandler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
+
+func (h *KeyHandler) GetKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, h.keys.Status())
+}
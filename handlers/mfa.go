@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"rbac/authn"
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAHandler lets users manage their authenticator app and recovery codes,
+// and administrators reset them.
+type MFAHandler struct {
+	users store.UserStore
+	store store.MFAStore
+	mfa   *authn.MFA
+}
+
+type TOTPStatusResponse struct {
+	Enabled           bool `json:"enabled"`
+	Pending           bool `json:"pending,omitempty"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TOTPEnrollmentResponse holds the secret of a new authenticator and the
+// otpauth URI to show as a QR code.
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func NewMFAHandler(users store.UserStore, mfaStore store.MFAStore, mfa *authn.MFA) *MFAHandler {
+	return &MFAHandler{users: users, store: mfaStore, mfa: mfa}
+}
+
+func (h *MFAHandler) GetMyTOTP(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	totp, err := h.store.GetTOTP(userID)
+	if err != nil && !errors.Is(err, apperrors.ErrTOTPNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch authenticator"})
+		return
+	}
+
+	var response TOTPStatusResponse
+	if err == nil {
+		response.Enabled = totp.Confirmed
+		response.Pending = !totp.Confirmed
+	}
+	if response.Enabled {
+		if response.RecoveryCodesLeft, err = h.store.CountRecoveryCodes(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count recovery codes"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// EnrollMyTOTP starts setting up an authenticator; it is used for logins
+// once ConfirmMyTOTP has checked a code from it.
+func (h *MFAHandler) EnrollMyTOTP(c *gin.Context) {
+	secret, uri, err := h.mfa.Enroll(c.GetInt("user_id"), c.GetString("username"))
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrTOTPEnabled):
+			c.JSON(http.StatusConflict, gin.H{"error": "Authenticator already enabled"})
+		case errors.Is(err, apperrors.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			log.Printf("Failed to enroll authenticator: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll authenticator"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPEnrollmentResponse{Secret: secret, URI: uri})
+}
+
+// ConfirmMyTOTP enables the authenticator and returns recovery codes,
+// which are shown this once.
+func (h *MFAHandler) ConfirmMyTOTP(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.mfa.Confirm(c.GetInt("user_id"), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrTOTPNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No authenticator enrolled"})
+		case errors.Is(err, apperrors.ErrTOTPEnabled):
+			c.JSON(http.StatusConflict, gin.H{"error": "Authenticator already enabled"})
+		case errors.Is(err, apperrors.ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		case errors.Is(err, apperrors.ErrMFALocked):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid authentication codes, try again later"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm authenticator"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMyTOTP removes the authenticator and recovery codes; it takes a
+// current code so that a stolen access token cannot.
+func (h *MFAHandler) DisableMyTOTP(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	if !h.verify(c, userID, req.Code) {
+		return
+	}
+
+	if err := h.store.DeleteTOTP(userID); err != nil && !errors.Is(err, apperrors.ErrTOTPNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable authenticator"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Authenticator disabled successfully"})
+}
+
+// RegenerateMyRecoveryCodes replaces the recovery codes, given a current
+// code.
+func (h *MFAHandler) RegenerateMyRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	if !h.verify(c, userID, req.Code) {
+		return
+	}
+
+	codes, err := h.mfa.RegenerateRecoveryCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// ResetUserMFA removes a user's authenticator, e.g. after they lost it,
+// and lifts a lockout after too many invalid codes, also for users without
+// an authenticator. If their roles require a second factor they enroll
+// again at their next login.
+func (h *MFAHandler) ResetUserMFA(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if _, err := h.users.GetUser(id); err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	if err := h.store.ResetMFAAttempts(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset authenticator"})
+		return
+	}
+	if err := h.store.DeleteTOTP(id); err != nil && !errors.Is(err, apperrors.ErrTOTPNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset authenticator"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Authenticator reset successfully"})
+}
+
+// verify responds with an error and reports false unless code is a current
+// code or an unused recovery code of the user.
+func (h *MFAHandler) verify(c *gin.Context, userID int, code string) bool {
+	err := h.mfa.Verify(userID, code)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, apperrors.ErrTOTPNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No authenticator enabled"})
+	case errors.Is(err, apperrors.ErrInvalidMFACode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+	case errors.Is(err, apperrors.ErrMFALocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid authentication codes, try again later"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authentication code"})
+	}
+	return false
+}
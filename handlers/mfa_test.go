@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"rbac/authn"
+	"rbac/authz"
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResetUserMFA(t *testing.T) {
+	tests := []struct {
+		name       string
+		enrolled   bool
+		unknown    bool
+		wantStatus int
+	}{
+		{name: "enrolled and locked out", enrolled: true, wantStatus: http.StatusOK},
+		{name: "locked out without authenticator", wantStatus: http.StatusOK},
+		{name: "unknown user", unknown: true, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			s := store.NewMemoryStore()
+			userID, err := s.CreateUser(store.User{Username: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.enrolled {
+				if err := s.CreateTOTP(store.TOTP{UserID: userID, Secret: "JBSWY3DPEHPK3PXP"}); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.ConfirmTOTP(userID, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := s.AddMFAAttempt(userID); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.LockMFA(userID, time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			authorizer := authz.NewAuthorizer(s, s, s, s, s, nil)
+			h := NewMFAHandler(s, s, authn.NewMFA(s, authorizer, "RBAC"))
+			router := gin.New()
+			router.DELETE("/users/:id/mfa", h.ResetUserMFA)
+
+			target := userID
+			if tt.unknown {
+				target = 999
+			}
+			w := serve(router, http.MethodDelete, "/users/"+strconv.Itoa(target)+"/mfa", "", nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.unknown {
+				return
+			}
+
+			lockout, err := s.GetMFALockout(userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !lockout.LockedUntil.IsZero() {
+				t.Errorf("still locked out until %v", lockout.LockedUntil)
+			}
+			if _, err := s.GetTOTP(userID); !errors.Is(err, apperrors.ErrTOTPNotFound) {
+				t.Errorf("authenticator after reset: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"rbac/authn"
+	"rbac/authz"
+	"rbac/store"
+	"rbac/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testIssuer   = "https://id.example.com"
+	wikiCallback = "https://wiki.example.com/callback"
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// newTestOIDCRouter serves the OpenID Connect provider for alice, whose
+// password is "secret1". The client wiki has the secret "wiki-secret" and
+// two redirect URIs; the public client cli has one.
+func newTestOIDCRouter(t *testing.T) (*gin.Engine, *utils.SigningKey) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	key, _, err := utils.GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.SetKeyring(utils.NewKeyring(key))
+	t.Cleanup(func() { utils.SetKeyring(nil) })
+
+	s := store.NewMemoryStore()
+	password, err := bcrypt.GenerateFromPassword([]byte("secret1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser(store.User{Username: "alice", Password: string(password)}); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := bcrypt.GenerateFromPassword([]byte("wiki-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range []store.OAuthClient{
+		{ClientID: "wiki", Name: "Wiki", SecretHash: string(secret), RedirectURIs: []string{wikiCallback, "https://wiki.example.com/other"}},
+		{ClientID: "cli", Name: "CLI", RedirectURIs: []string{"http://127.0.0.1:8765/callback"}},
+	} {
+		if _, err := s.CreateOAuthClient(client); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	authorizer := authz.NewAuthorizer(s, s, s, s, s, nil)
+	h := NewOIDCHandler(NewAuthHandler(s, s, s, s, authn.NewLocal(s), authorizer, nil, authn.NewMFA(s, authorizer, "RBAC")), s, testIssuer)
+	router := gin.New()
+	router.GET("/oauth/authorize", h.Authorize)
+	router.POST("/oauth/authorize", h.SubmitLogin)
+	router.POST("/oauth/token", h.Token)
+	return router, key
+}
+
+// authorizeQuery is a valid authorization request of wiki.
+func authorizeQuery() url.Values {
+	challenge := sha256.Sum256([]byte(testVerifier))
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"wiki"},
+		"redirect_uri":          {wikiCallback},
+		"scope":                 {"openid profile"},
+		"state":                 {"af0ifjsldkj"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {utils.EncodeBase64(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func postForm(router *gin.Engine, path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+var csrfField = regexp.MustCompile(`name="csrf_token" value="([^"]*)"`)
+
+// showLogin opens the login page for query and returns the CSRF cookie it
+// set and the token in its form.
+func showLogin(t *testing.T, router *gin.Engine, query url.Values) (*http.Cookie, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("authorize: status %d: %s", w.Code, w.Body)
+	}
+	match := csrfField.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatalf("authorize: no CSRF token in the login page: %s", w.Body)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcCSRFCookie {
+			return cookie, match[1]
+		}
+	}
+	t.Fatal("authorize: no CSRF cookie set")
+	return nil, ""
+}
+
+// signIn signs alice in to wiki and returns the authorization code.
+func signIn(t *testing.T, router *gin.Engine) string {
+	t.Helper()
+	query := authorizeQuery()
+	cookie, token := showLogin(t, router, query)
+	form := authorizeQuery()
+	form.Set("username", "alice")
+	form.Set("password", "secret1")
+	form.Set("csrf_token", token)
+	w := postForm(router, "/oauth/authorize", form, cookie)
+	if w.Code != http.StatusFound {
+		t.Fatalf("sign in: status %d: %s", w.Code, w.Body)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Get("state") != query.Get("state") {
+		t.Fatalf("sign in: redirected to %s, want state %s", location, query.Get("state"))
+	}
+	return location.Query().Get("code")
+}
+
+func TestOIDCAuthorizeRedirectURI(t *testing.T) {
+	tests := []struct {
+		name        string
+		clientID    string
+		redirectURI string
+		wantStatus  int
+	}{
+		{"registered", "wiki", wikiCallback, http.StatusOK},
+		{"another registered", "wiki", "https://wiki.example.com/other", http.StatusOK},
+		{"default of a single registered", "cli", "", http.StatusOK},
+		{"no default of several registered", "wiki", "", http.StatusBadRequest},
+		{"unregistered", "wiki", "https://evil.example.com/callback", http.StatusBadRequest},
+		{"registered of another client", "cli", wikiCallback, http.StatusBadRequest},
+		{"extra path", "wiki", wikiCallback + "/more", http.StatusBadRequest},
+		{"extra query", "wiki", wikiCallback + "?next=https://evil.example.com", http.StatusBadRequest},
+		{"different case", "wiki", "https://WIKI.example.com/callback", http.StatusBadRequest},
+		{"different scheme", "wiki", "http://wiki.example.com/callback", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newTestOIDCRouter(t)
+			query := authorizeQuery()
+			query.Set("client_id", tt.clientID)
+			query.Set("redirect_uri", tt.redirectURI)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK && !strings.Contains(w.Body.String(), "Invalid redirect URI") {
+				t.Errorf("body does not show the invalid redirect URI: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestOIDCSubmitLoginCSRF(t *testing.T) {
+	tests := []struct {
+		name       string
+		csrf       func(cookie *http.Cookie, token string) (*http.Cookie, string)
+		wantStatus int
+	}{
+		{
+			name:       "token of the cookie",
+			csrf:       func(cookie *http.Cookie, token string) (*http.Cookie, string) { return cookie, token },
+			wantStatus: http.StatusFound,
+		},
+		{
+			name:       "no cookie",
+			csrf:       func(_ *http.Cookie, token string) (*http.Cookie, string) { return nil, token },
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no token",
+			csrf:       func(cookie *http.Cookie, _ string) (*http.Cookie, string) { return cookie, "" },
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "token of another cookie",
+			csrf: func(cookie *http.Cookie, _ string) (*http.Cookie, string) {
+				return cookie, "0123456789abcdef0123456789abcdef"
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "empty cookie and token",
+			csrf: func(*http.Cookie, string) (*http.Cookie, string) {
+				return &http.Cookie{Name: oidcCSRFCookie, Value: ""}, ""
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newTestOIDCRouter(t)
+			cookie, token := tt.csrf(showLogin(t, router, authorizeQuery()))
+			form := authorizeQuery()
+			form.Set("username", "alice")
+			form.Set("password", "secret1")
+			form.Set("csrf_token", token)
+			w := postForm(router, "/oauth/authorize", form, cookie)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if location := w.Header().Get("Location"); tt.wantStatus != http.StatusFound && location != "" {
+				t.Errorf("redirected to %s", location)
+			}
+		})
+	}
+}
+
+// tokenRequest redeems a code, authenticating the client with HTTP basic
+// authentication if clientID is set.
+type tokenRequest struct {
+	form     url.Values
+	clientID string
+	secret   string
+}
+
+func (r *tokenRequest) send(router *gin.Engine) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(r.form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if r.clientID != "" {
+		req.SetBasicAuth(r.clientID, r.secret)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// request changes the valid token request of wiki for the code.
+		request    func(req *tokenRequest)
+		wantStatus int
+		wantError  string
+		wantDesc   string
+	}{
+		{
+			name:       "valid",
+			request:    func(*tokenRequest) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "credentials in the form",
+			request: func(req *tokenRequest) {
+				req.form.Set("client_id", req.clientID)
+				req.form.Set("client_secret", req.secret)
+				req.clientID, req.secret = "", ""
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wrong client secret",
+			request:    func(req *tokenRequest) { req.secret = "guess" },
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid_client",
+		},
+		{
+			name:       "no client secret",
+			request:    func(req *tokenRequest) { req.secret = "" },
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid_client",
+		},
+		{
+			name: "code of another client",
+			request: func(req *tokenRequest) {
+				req.clientID, req.secret = "", ""
+				req.form.Set("client_id", "cli")
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+			wantDesc:   "Invalid or expired authorization code",
+		},
+		{
+			name:       "unknown code",
+			request:    func(req *tokenRequest) { req.form.Set("code", "not-a-code") },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+			wantDesc:   "Invalid or expired authorization code",
+		},
+		{
+			name:       "other registered redirect URI",
+			request:    func(req *tokenRequest) { req.form.Set("redirect_uri", "https://wiki.example.com/other") },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+			wantDesc:   "Redirect URI does not match",
+		},
+		{
+			name:       "no redirect URI",
+			request:    func(req *tokenRequest) { req.form.Del("redirect_uri") },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+			wantDesc:   "Redirect URI does not match",
+		},
+		{
+			name:       "wrong code verifier",
+			request:    func(req *tokenRequest) { req.form.Set("code_verifier", testVerifier+"x") },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+			wantDesc:   "Invalid code verifier",
+		},
+		{
+			name:       "no code verifier",
+			request:    func(req *tokenRequest) { req.form.Del("code_verifier") },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+			wantDesc:   "Invalid code verifier",
+		},
+		{
+			name: "challenge as verifier",
+			request: func(req *tokenRequest) {
+				req.form.Set("code_verifier", authorizeQuery().Get("code_challenge"))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+			wantDesc:   "Invalid code verifier",
+		},
+		{
+			name:       "unsupported grant type",
+			request:    func(req *tokenRequest) { req.form.Set("grant_type", "password") },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "unsupported_grant_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, key := newTestOIDCRouter(t)
+			req := &tokenRequest{
+				form: url.Values{
+					"grant_type":    {"authorization_code"},
+					"code":          {signIn(t, router)},
+					"redirect_uri":  {wikiCallback},
+					"code_verifier": {testVerifier},
+				},
+				clientID: "wiki",
+				secret:   "wiki-secret",
+			}
+			tt.request(req)
+
+			w := req.send(router)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				var response map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				if response["error"] != tt.wantError || response["error_description"] != tt.wantDesc {
+					t.Errorf("error %q (%q), want %q (%q)", response["error"], response["error_description"], tt.wantError, tt.wantDesc)
+				}
+				return
+			}
+
+			var response TokenResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			claims := &utils.IDTokenClaims{}
+			_, err := jwt.ParseWithClaims(response.IDToken, claims, func(*jwt.Token) (interface{}, error) { return key.Public, nil },
+				jwt.WithValidMethods([]string{"ES256"}), jwt.WithIssuer(testIssuer), jwt.WithAudience("wiki"))
+			if err != nil {
+				t.Fatalf("ID token: %v", err)
+			}
+			if claims.Nonce != "n-0S6_WzA2Mj" || claims.PreferredUsername != "alice" {
+				t.Errorf("ID token nonce %q, preferred_username %q", claims.Nonce, claims.PreferredUsername)
+			}
+
+			// A code is redeemed once.
+			if w := req.send(router); w.Code != http.StatusBadRequest {
+				t.Errorf("redeeming the code again: status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
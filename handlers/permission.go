@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PermissionHandler struct {
+	permissions store.PermissionStore
+}
+
+type PermissionResponse struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type PermissionRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func NewPermissionHandler(permissions store.PermissionStore) *PermissionHandler {
+	return &PermissionHandler{permissions: permissions}
+}
+
+func (h *PermissionHandler) GetPermissions(c *gin.Context) {
+	permissions, err := h.permissions.GetPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+
+	var response []PermissionResponse
+	for _, perm := range permissions {
+		response = append(response, PermissionResponse{ID: perm.ID, Name: perm.Name})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *PermissionHandler) GetPermission(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission ID"})
+		return
+	}
+
+	perm, err := h.permissions.GetPermission(id)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrPermissionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Permission not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permission"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PermissionResponse{ID: perm.ID, Name: perm.Name})
+}
+
+func (h *PermissionHandler) CreatePermission(c *gin.Context) {
+	var req PermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permID, err := h.permissions.CreatePermission(req.Name)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrDuplicatePermission) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Permission already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create permission"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": permID, "message": "Permission created successfully"})
+}
+
+func (h *PermissionHandler) UpdatePermission(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission ID"})
+		return
+	}
+
+	var req PermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.permissions.UpdatePermission(id, req.Name); err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrPermissionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Permission not found"})
+		case errors.Is(err, apperrors.ErrDuplicatePermission):
+			c.JSON(http.StatusConflict, gin.H{"error": "Permission already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permission"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permission updated successfully"})
+}
+
+func (h *PermissionHandler) DeletePermission(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission ID"})
+		return
+	}
+
+	cascade, err := strconv.ParseBool(c.DefaultQuery("cascade", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cascade value"})
+		return
+	}
+
+	if err := h.permissions.DeletePermission(id, cascade); err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrPermissionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Permission not found"})
+		case errors.Is(err, apperrors.ErrPermissionInUse):
+			roles, _ := h.permissions.GetPermissionRoles(id)
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Permission is still assigned to roles",
+				"roles": roles,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete permission"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permission deleted successfully"})
+}
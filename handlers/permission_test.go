@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeletePermission(t *testing.T) {
+	tests := []struct {
+		name        string
+		permission  string
+		query       string
+		wantStatus  int
+		wantRoles   []string
+		wantDeleted bool
+	}{
+		{name: "in use", permission: "edit_post", wantStatus: http.StatusConflict, wantRoles: []string{"editor", "intern"}},
+		{name: "in use, cascade off", permission: "edit_post", query: "?cascade=false", wantStatus: http.StatusConflict, wantRoles: []string{"editor", "intern"}},
+		{name: "in use, cascade", permission: "edit_post", query: "?cascade=true", wantStatus: http.StatusOK, wantDeleted: true},
+		{name: "unused", permission: "archive_post", wantStatus: http.StatusOK, wantDeleted: true},
+		{name: "unknown", permission: "", wantStatus: http.StatusNotFound},
+		{name: "invalid cascade", permission: "edit_post", query: "?cascade=maybe", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			s := store.NewMemoryStore()
+			ids := map[string]int{}
+			for _, name := range []string{"view_post", "edit_post", "archive_post"} {
+				id, err := s.CreatePermission(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids[name] = id
+			}
+			editor, err := s.CreateRole(store.Role{Name: "editor", Permissions: []string{"view_post", "edit_post"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			intern, err := s.CreateRole(store.Role{Name: "intern", Permissions: []string{"view_post"}, DeniedPermissions: []string{"edit_post"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			router := gin.New()
+			router.DELETE("/permissions/:id", NewPermissionHandler(s).DeletePermission)
+
+			id, ok := ids[tt.permission]
+			if !ok {
+				id = 999
+			}
+			w := serve(router, http.MethodDelete, "/permissions/"+strconv.Itoa(id)+tt.query, "", nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			if tt.wantStatus == http.StatusConflict {
+				var response struct {
+					Error string   `json:"error"`
+					Roles []string `json:"roles"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				slices.Sort(response.Roles)
+				if response.Error == "" || !slices.Equal(response.Roles, tt.wantRoles) {
+					t.Errorf("conflict %q with roles %v, want roles %v", response.Error, response.Roles, tt.wantRoles)
+				}
+			}
+
+			if ok {
+				_, err := s.GetPermission(id)
+				if deleted := errors.Is(err, apperrors.ErrPermissionNotFound); deleted != tt.wantDeleted {
+					t.Errorf("permission deleted: %v, want %v", deleted, tt.wantDeleted)
+				}
+			}
+
+			// The roles keep their other grants and only lose the deleted
+			// permission.
+			wantEditor, wantIntern := []string{"edit_post", "view_post"}, []string{"edit_post"}
+			if tt.wantDeleted && tt.permission == "edit_post" {
+				wantEditor, wantIntern = []string{"view_post"}, nil
+			}
+			for _, check := range []struct {
+				id    int
+				grant func(*store.Role) []string
+				want  []string
+			}{
+				{editor, func(r *store.Role) []string { return r.Permissions }, wantEditor},
+				{intern, func(r *store.Role) []string { return r.DeniedPermissions }, wantIntern},
+			} {
+				role, err := s.GetRole(check.id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := slices.Clone(check.grant(role))
+				slices.Sort(got)
+				if !slices.Equal(got, check.want) {
+					t.Errorf("role %s grants %v, want %v", role.Name, got, check.want)
+				}
+			}
+		})
+	}
+}
@@ -1,63 +1,85 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"rbac/authz"
+	apperrors "rbac/errors"
+	"rbac/store"
+
 	"github.com/gin-gonic/gin"
 )
 
 type RoleHandler struct {
-	db *sql.DB
+	roles store.RoleStore
 }
 
 type RoleResponse struct {
-	ID          int      `json:"id"`
-	Name        string   `json:"name"`
-	Permissions []string `json:"permissions"`
+	ID                   int      `json:"id"`
+	Name                 string   `json:"name"`
+	TenantID             int      `json:"tenant_id,omitempty"`
+	Parents              []string `json:"parents"`
+	Permissions          []string `json:"permissions"`
+	InheritedPermissions []string `json:"inherited_permissions"`
+	DeniedPermissions    []string `json:"denied_permissions,omitempty"`
+	RequireMFA           bool     `json:"require_mfa,omitempty"`
+
+	PermissionConditions map[string]string `json:"permission_conditions,omitempty"`
 }
 
 type CreateRoleRequest struct {
-	Name        string   `json:"name" binding:"required"`
-	Permissions []string `json:"permissions" binding:"required"`
+	Name                 string            `json:"name" binding:"required"`
+	TenantID             int               `json:"tenant_id"`
+	Permissions          []string          `json:"permissions" binding:"required"`
+	DeniedPermissions    []string          `json:"denied_permissions"`
+	PermissionConditions map[string]string `json:"permission_conditions"`
+	Parents              []string          `json:"parents"`
+	RequireMFA           bool              `json:"require_mfa"`
 }
 
 type UpdateRoleRequest struct {
-	Name        string   `json:"name" binding:"required"`
-	Permissions []string `json:"permissions"`
+	Name                 string            `json:"name" binding:"required"`
+	Permissions          []string          `json:"permissions"`
+	DeniedPermissions    []string          `json:"denied_permissions"`
+	PermissionConditions map[string]string `json:"permission_conditions"`
+	Parents              []string          `json:"parents"`
+	RequireMFA           *bool             `json:"require_mfa"`
 }
 
-func NewRoleHandler(db *sql.DB) *RoleHandler {
-	return &RoleHandler{db: db}
+func NewRoleHandler(roles store.RoleStore) *RoleHandler {
+	return &RoleHandler{roles: roles}
 }
 
 func (h *RoleHandler) GetRoles(c *gin.Context) {
-	rows, err := h.db.Query("SELECT id, name FROM roles")
+	tenantID := -1
+	if param := c.Query("tenant_id"); param != "" {
+		id, err := strconv.Atoi(param)
+		if err != nil || id < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+			return
+		}
+		tenantID = id
+	}
+
+	roles, err := h.roles.GetRoles()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
 		return
 	}
-	defer rows.Close()
 
-	var roles []RoleResponse
-	for rows.Next() {
-		var role RoleResponse
-		if err := rows.Scan(&role.ID, &role.Name); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process roles"})
-			return
-		}
+	graph := authz.NewRoleGraph(roles)
 
-		permissions, err := h.getRolePermissions(role.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role permissions"})
-			return
+	var response []RoleResponse
+	for _, role := range roles {
+		if tenantID >= 0 && role.TenantID != tenantID {
+			continue
 		}
-		role.Permissions = permissions
-		roles = append(roles, role)
+		response = append(response, toRoleResponse(role, graph))
 	}
 
-	c.JSON(http.StatusOK, roles)
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *RoleHandler) GetRole(c *gin.Context) {
@@ -67,11 +89,9 @@ func (h *RoleHandler) GetRole(c *gin.Context) {
 		return
 	}
 
-	var role RoleResponse
-	err = h.db.QueryRow("SELECT id, name FROM roles WHERE id = ?", id).
-		Scan(&role.ID, &role.Name)
+	role, err := h.roles.GetRole(id)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, apperrors.ErrRoleNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
 			return
 		}
@@ -79,14 +99,13 @@ func (h *RoleHandler) GetRole(c *gin.Context) {
 		return
 	}
 
-	permissions, err := h.getRolePermissions(id)
+	roles, err := h.roles.GetRoles()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role permissions"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role hierarchy"})
 		return
 	}
-	role.Permissions = permissions
 
-	c.JSON(http.StatusOK, role)
+	c.JSON(http.StatusOK, toRoleResponse(*role, authz.NewRoleGraph(roles)))
 }
 
 func (h *RoleHandler) CreateRole(c *gin.Context) {
@@ -96,43 +115,33 @@ func (h *RoleHandler) CreateRole(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
-		return
-	}
-	defer tx.Rollback()
-
-	result, err := tx.Exec("INSERT INTO roles (name) VALUES (?)", req.Name)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
-		return
-	}
-
-	roleID, err := result.LastInsertId()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get role ID"})
+	if err := validateConditions(req.PermissionConditions, append(req.Permissions, req.DeniedPermissions...)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	for _, permName := range req.Permissions {
-		var permID int
-		err := tx.QueryRow("SELECT id FROM permissions WHERE name = ?", permName).Scan(&permID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission: " + permName})
-			return
-		}
-
-		_, err = tx.Exec("INSERT INTO role_permissions (role_id, permission_id) VALUES (?, ?)",
-			roleID, permID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign permission"})
-			return
+	roleID, err := h.roles.CreateRole(store.Role{
+		Name:                 req.Name,
+		TenantID:             req.TenantID,
+		Permissions:          req.Permissions,
+		DeniedPermissions:    req.DeniedPermissions,
+		PermissionConditions: req.PermissionConditions,
+		Parents:              req.Parents,
+		RequireMFA:           req.RequireMFA,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrDuplicateRole):
+			c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		case errors.Is(err, apperrors.ErrTenantNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tenant not found"})
+		case errors.Is(err, apperrors.ErrRoleCycle):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent roles would create an inheritance cycle"})
+		case errors.Is(err, apperrors.ErrInvalidPermission), errors.Is(err, apperrors.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
 		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
@@ -152,46 +161,33 @@ func (h *RoleHandler) UpdateRole(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+	if err := validateConditions(req.PermissionConditions, append(req.Permissions, req.DeniedPermissions...)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer tx.Rollback()
 
-
-	_, err = tx.Exec("UPDATE roles SET name = ? WHERE id = ?", req.Name, id)
+	err = h.roles.UpdateRole(store.Role{
+		ID:                   id,
+		Name:                 req.Name,
+		Permissions:          req.Permissions,
+		DeniedPermissions:    req.DeniedPermissions,
+		PermissionConditions: req.PermissionConditions,
+		Parents:              req.Parents,
+		SetRequireMFA:        req.RequireMFA,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
-		return
-	}
-
-	if req.Permissions != nil {
-		_, err = tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", id)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role permissions"})
-			return
-		}
-
-		for _, permName := range req.Permissions {
-			var permID int
-			err := tx.QueryRow("SELECT id FROM permissions WHERE name = ?", permName).Scan(&permID)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission: " + permName})
-				return
-			}
-
-			_, err = tx.Exec("INSERT INTO role_permissions (role_id, permission_id) VALUES (?, ?)",
-				id, permID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign permission"})
-				return
-			}
+		switch {
+		case errors.Is(err, apperrors.ErrRoleNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		case errors.Is(err, apperrors.ErrDuplicateRole):
+			c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		case errors.Is(err, apperrors.ErrRoleCycle):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent roles would create an inheritance cycle"})
+		case errors.Is(err, apperrors.ErrInvalidPermission), errors.Is(err, apperrors.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
 		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
@@ -205,68 +201,28 @@ func (h *RoleHandler) DeleteRole(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
-		return
-	}
-	defer tx.Rollback()
-
-	_, err = tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role permissions"})
-		return
-	}
-
-	_, err = tx.Exec("DELETE FROM user_roles WHERE role_id = ?", id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user roles"})
-		return
-	}
-
-	result, err := tx.Exec("DELETE FROM roles WHERE id = ?", id)
-	if err != nil {
+	if err := h.roles.DeleteRole(id); err != nil {
+		if errors.Is(err, apperrors.ErrRoleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
 		return
 	}
 
-	affected, err := result.RowsAffected()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
-		return
-	}
-
-	if affected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
-		return
-	}
-
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
 }
 
-func (h *RoleHandler) getRolePermissions(roleID int) ([]string, error) {
-	rows, err := h.db.Query(`
-		SELECT p.name FROM permissions p
-		JOIN role_permissions rp ON p.id = rp.permission_id
-		WHERE rp.role_id = ?
-	`, roleID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var permissions []string
-	for rows.Next() {
-		var perm string
-		if err := rows.Scan(&perm); err != nil {
-			return nil, err
-		}
-		permissions = append(permissions, perm)
+func toRoleResponse(role store.Role, graph *authz.RoleGraph) RoleResponse {
+	return RoleResponse{
+		ID:                   role.ID,
+		Name:                 role.Name,
+		TenantID:             role.TenantID,
+		Parents:              role.Parents,
+		Permissions:          role.Permissions,
+		InheritedPermissions: graph.InheritedPermissions(role.ID),
+		DeniedPermissions:    role.DeniedPermissions,
+		RequireMFA:           role.RequireMFA,
+		PermissionConditions: role.PermissionConditions,
 	}
-	return permissions, nil
-} 
\ No newline at end of file
+}
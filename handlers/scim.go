@@ -0,0 +1,920 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"rbac/authn"
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	scimUserSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema  = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimContentType = "application/scim+json"
+
+	scimDefaultCount = 100
+	scimMaxCount     = 1000
+)
+
+// SCIMHandler serves SCIM 2.0 provisioning (RFC 7643, RFC 7644) to
+// identity providers. Users are the users table; groups are the global
+// roles, and their members the users assigned them outside tenants.
+// Passwords are only taken when a user is created.
+type SCIMHandler struct {
+	users     store.UserStore
+	roles     store.RoleStore
+	tokenHash [sha256.Size]byte
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+type scimReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type scimUser struct {
+	Schemas  []string        `json:"schemas"`
+	ID       string          `json:"id"`
+	UserName string          `json:"userName"`
+	Active   bool            `json:"active"`
+	Groups   []scimReference `json:"groups,omitempty"`
+	Meta     scimMeta        `json:"meta"`
+}
+
+type scimGroup struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id"`
+	DisplayName string          `json:"displayName"`
+	Members     []scimReference `json:"members,omitempty"`
+	Meta        scimMeta        `json:"meta"`
+}
+
+type scimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+type scimUserRequest struct {
+	UserName string `json:"userName"`
+	Password string `json:"password"`
+	Active   *bool  `json:"active"`
+}
+
+type scimGroupRequest struct {
+	DisplayName string          `json:"displayName"`
+	Members     []scimReference `json:"members"`
+}
+
+type scimPatchRequest struct {
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// scimError is a failed request; Type is the scimType of RFC 7644 section
+// 3.12, if one applies.
+type scimError struct {
+	Status int
+	Type   string
+	Detail string
+}
+
+func (e *scimError) Error() string {
+	return e.Detail
+}
+
+func NewSCIMHandler(users store.UserStore, roles store.RoleStore, token string) *SCIMHandler {
+	return &SCIMHandler{users: users, roles: roles, tokenHash: sha256.Sum256([]byte(token))}
+}
+
+// Authenticate admits requests bearing the provisioning token.
+func (h *SCIMHandler) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		tokenHash := sha256.Sum256([]byte(token))
+		if !ok || subtle.ConstantTimeCompare(tokenHash[:], h.tokenHash[:]) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			respondSCIMError(c, &scimError{Status: http.StatusUnauthorized, Detail: "Invalid or missing bearer token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (h *SCIMHandler) GetServiceProviderConfig(c *gin.Context) {
+	respondSCIM(c, http.StatusOK, gin.H{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The token configured in SCIM_TOKEN",
+		}},
+		"meta": scimMeta{ResourceType: "ServiceProviderConfig", Location: scimBaseURL(c) + "/ServiceProviderConfig"},
+	})
+}
+
+func (h *SCIMHandler) GetUsers(c *gin.Context) {
+	filter, startIndex, count, err := scimListParams(c)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	roleIDs, err := h.globalRoleIDs()
+	if err != nil {
+		respondSCIMFailure(c, "fetch roles", err)
+		return
+	}
+
+	users, total, err := h.listUsers(filter, startIndex, count)
+	if err != nil {
+		respondSCIMFailure(c, "fetch users", err)
+		return
+	}
+
+	resources := []interface{}{}
+	for _, user := range users {
+		resources = append(resources, h.toSCIMUser(c, user, roleIDs))
+	}
+	respondSCIMList(c, total, startIndex, resources)
+}
+
+// listUsers returns a page of the users passing filter and how many do.
+// Without a filter the store pages the users, and one on userName eq,
+// which provisioning clients send before creating a user, looks the users
+// up by name ignoring case, as SCIM compares userName; other filters are
+// matched against every user.
+func (h *SCIMHandler) listUsers(filter scimFilter, startIndex, count int) ([]store.User, int, error) {
+	if len(filter) == 0 {
+		total, err := h.users.CountUsers()
+		if err != nil {
+			return nil, 0, err
+		}
+		users, err := h.users.GetUsers(count, startIndex-1)
+		return users, total, err
+	}
+
+	var matched []store.User
+	if username, ok := filter.equals("userName"); ok {
+		users, err := h.users.GetUsersByUsernameFold(username)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, user := range users {
+			if filter.matches(scimUserAttribute(user)) {
+				matched = append(matched, user)
+			}
+		}
+		return scimPage(matched, startIndex, count), len(matched), nil
+	}
+
+	const pageSize = 500
+	for offset := 0; ; offset += pageSize {
+		users, err := h.users.GetUsers(pageSize, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, user := range users {
+			if filter.matches(scimUserAttribute(user)) {
+				matched = append(matched, user)
+			}
+		}
+		if len(users) < pageSize {
+			break
+		}
+	}
+	return scimPage(matched, startIndex, count), len(matched), nil
+}
+
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.user(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	h.respondUser(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var req scimUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+	if req.UserName == "" {
+		respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "userName is required"})
+		return
+	}
+
+	password := authn.NoPassword
+	if req.Password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			respondSCIMFailure(c, "hash password", err)
+			return
+		}
+		password = string(hashedPassword)
+	}
+
+	userID, err := h.users.CreateUser(store.User{
+		Username: req.UserName,
+		Password: password,
+		Disabled: req.Active != nil && !*req.Active,
+	})
+	if err != nil {
+		respondSCIMError(c, scimUserError("create user", err))
+		return
+	}
+
+	user, err := h.users.GetUser(userID)
+	if err != nil {
+		respondSCIMFailure(c, "fetch user", err)
+		return
+	}
+	h.respondUser(c, http.StatusCreated, user)
+}
+
+// ReplaceUser sets the userName and active state; a password is ignored.
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	user, err := h.user(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	var req scimUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+	if req.UserName == "" {
+		respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "userName is required"})
+		return
+	}
+
+	active := !user.Disabled
+	if req.Active != nil {
+		active = *req.Active
+	}
+	if err := h.updateUser(user, req.UserName, active); err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	h.refreshUser(c, user.ID)
+}
+
+// PatchUser applies add, replace and remove operations to userName and
+// active. Other attributes, passwords included, are ignored.
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	user, err := h.user(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	operations, err := bindSCIMPatch(c)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	username, active := user.Username, !user.Disabled
+	for _, operation := range operations {
+		values, err := operation.values()
+		if err != nil {
+			respondSCIMError(c, err)
+			return
+		}
+		for attribute, value := range values {
+			switch strings.ToLower(attribute) {
+			case "username":
+				if operation.Op == "remove" {
+					respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "mutability", Detail: "userName cannot be removed"})
+					return
+				}
+				if err := json.Unmarshal(value, &username); err != nil || username == "" {
+					respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "userName must be a non-empty string"})
+					return
+				}
+			case "active":
+				if operation.Op == "remove" {
+					active = false
+					continue
+				}
+				if active, err = scimBool(value); err != nil {
+					respondSCIMError(c, err)
+					return
+				}
+			}
+		}
+	}
+
+	if err := h.updateUser(user, username, active); err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	h.refreshUser(c, user.ID)
+}
+
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	user, err := h.user(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	if err := h.users.DeleteUser(user.ID); err != nil {
+		respondSCIMError(c, scimUserError("delete user", err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) GetGroups(c *gin.Context) {
+	filter, startIndex, count, err := scimListParams(c)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	roles, err := h.roles.GetRoles()
+	if err != nil {
+		respondSCIMFailure(c, "fetch roles", err)
+		return
+	}
+
+	var matched []store.Role
+	for _, role := range roles {
+		if role.TenantID == 0 && filter.matches(scimGroupAttribute(role)) {
+			matched = append(matched, role)
+		}
+	}
+
+	resources := []interface{}{}
+	for _, role := range scimPage(matched, startIndex, count) {
+		group, err := h.toSCIMGroup(c, role)
+		if err != nil {
+			respondSCIMFailure(c, "fetch role members", err)
+			return
+		}
+		resources = append(resources, group)
+	}
+	respondSCIMList(c, len(matched), startIndex, resources)
+}
+
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	role, err := h.role(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	h.respondGroup(c, http.StatusOK, role)
+}
+
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	var req scimGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+	if req.DisplayName == "" {
+		respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "displayName is required"})
+		return
+	}
+	members, err := scimMemberIDs(req.Members)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	roleID, err := h.roles.CreateRoleWithMembers(store.Role{Name: req.DisplayName}, members)
+	if err != nil {
+		respondSCIMError(c, scimRoleError("create role", err))
+		return
+	}
+	h.respondGroup(c, http.StatusCreated, &store.Role{ID: roleID, Name: req.DisplayName})
+}
+
+// ReplaceGroup renames the role and makes the members exactly its users.
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	role, err := h.role(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	var req scimGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: err.Error()})
+		return
+	}
+	if req.DisplayName == "" {
+		respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "displayName is required"})
+		return
+	}
+	members, err := scimMemberIDs(req.Members)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	if err := h.updateGroup(role, req.DisplayName, members); err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	h.respondGroup(c, http.StatusOK, role)
+}
+
+// PatchGroup applies operations to displayName and members; members can be
+// added, replaced, and removed by a filter like members[value eq "4"], by
+// a list of values or all at once.
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	role, err := h.role(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	operations, err := bindSCIMPatch(c)
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+
+	current, err := h.roles.GetRoleUsers(role.ID)
+	if err != nil {
+		respondSCIMFailure(c, "fetch role members", err)
+		return
+	}
+	var members []int
+	for _, user := range current {
+		members = append(members, user.ID)
+	}
+
+	name := role.Name
+	for _, operation := range operations {
+		if operation.Op == "remove" && strings.HasPrefix(strings.ToLower(operation.Path), "members[") {
+			removed, err := scimMemberFilter(operation.Path)
+			if err != nil {
+				respondSCIMError(c, err)
+				return
+			}
+			members = slices.DeleteFunc(members, func(id int) bool { return id == removed })
+			continue
+		}
+
+		values, err := operation.values()
+		if err != nil {
+			respondSCIMError(c, err)
+			return
+		}
+		for attribute, value := range values {
+			switch strings.ToLower(attribute) {
+			case "displayname":
+				if operation.Op == "remove" {
+					respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "mutability", Detail: "displayName cannot be removed"})
+					return
+				}
+				if err := json.Unmarshal(value, &name); err != nil || name == "" {
+					respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "displayName must be a non-empty string"})
+					return
+				}
+			case "members":
+				var references []scimReference
+				if len(value) > 0 {
+					if err := json.Unmarshal(value, &references); err != nil {
+						respondSCIMError(c, &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "members must be a list of references"})
+						return
+					}
+				}
+				ids, err := scimMemberIDs(references)
+				if err != nil {
+					respondSCIMError(c, err)
+					return
+				}
+
+				switch {
+				case operation.Op == "replace":
+					members = ids
+				case operation.Op == "add":
+					members = append(members, ids...)
+				case len(value) == 0:
+					members = nil
+				default:
+					members = slices.DeleteFunc(members, func(id int) bool { return slices.Contains(ids, id) })
+				}
+			}
+		}
+	}
+
+	if err := h.updateGroup(role, name, members); err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	h.respondGroup(c, http.StatusOK, role)
+}
+
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	role, err := h.role(c.Param("id"))
+	if err != nil {
+		respondSCIMError(c, err)
+		return
+	}
+	if err := h.roles.DeleteRole(role.ID); err != nil {
+		respondSCIMError(c, scimRoleError("delete role", err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) user(id string) (*store.User, error) {
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, &scimError{Status: http.StatusNotFound, Detail: "User not found"}
+	}
+	user, err := h.users.GetUser(userID)
+	if err != nil {
+		return nil, scimUserError("fetch user", err)
+	}
+	return user, nil
+}
+
+// role returns the global role id; tenant roles are not groups.
+func (h *SCIMHandler) role(id string) (*store.Role, error) {
+	roleID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, &scimError{Status: http.StatusNotFound, Detail: "Group not found"}
+	}
+	role, err := h.roles.GetRole(roleID)
+	if err == nil && role.TenantID != 0 {
+		err = apperrors.ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, scimRoleError("fetch role", err)
+	}
+	return role, nil
+}
+
+func (h *SCIMHandler) updateUser(user *store.User, username string, active bool) error {
+	if username == user.Username && active != user.Disabled {
+		return nil
+	}
+	update := store.User{ID: user.ID, Username: username}
+	if active == user.Disabled {
+		disabled := !active
+		update.SetDisabled = &disabled
+	}
+	if err := h.users.UpdateUser(update); err != nil {
+		return scimUserError("update user", err)
+	}
+	return nil
+}
+
+// updateGroup renames the role and assigns it to exactly the users
+// members in one store call, so a request failing on either changes
+// nothing.
+func (h *SCIMHandler) updateGroup(role *store.Role, name string, members []int) error {
+	if err := h.roles.SetRoleMembers(role.ID, name, members); err != nil {
+		return scimRoleError("update role", err)
+	}
+	role.Name = name
+	return nil
+}
+
+func (h *SCIMHandler) globalRoleIDs() (map[string]int, error) {
+	roles, err := h.roles.GetRoles()
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int)
+	for _, role := range roles {
+		if role.TenantID == 0 {
+			ids[role.Name] = role.ID
+		}
+	}
+	return ids, nil
+}
+
+func (h *SCIMHandler) refreshUser(c *gin.Context, id int) {
+	user, err := h.users.GetUser(id)
+	if err != nil {
+		respondSCIMError(c, scimUserError("fetch user", err))
+		return
+	}
+	h.respondUser(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) respondUser(c *gin.Context, status int, user *store.User) {
+	roleIDs, err := h.globalRoleIDs()
+	if err != nil {
+		respondSCIMFailure(c, "fetch roles", err)
+		return
+	}
+	resource := h.toSCIMUser(c, *user, roleIDs)
+	if status == http.StatusCreated {
+		c.Header("Location", resource.Meta.Location)
+	}
+	respondSCIM(c, status, resource)
+}
+
+func (h *SCIMHandler) respondGroup(c *gin.Context, status int, role *store.Role) {
+	resource, err := h.toSCIMGroup(c, *role)
+	if err != nil {
+		respondSCIMFailure(c, "fetch role members", err)
+		return
+	}
+	if status == http.StatusCreated {
+		c.Header("Location", resource.Meta.Location)
+	}
+	respondSCIM(c, status, resource)
+}
+
+func (h *SCIMHandler) toSCIMUser(c *gin.Context, user store.User, roleIDs map[string]int) scimUser {
+	base := scimBaseURL(c)
+	resource := scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       strconv.Itoa(user.ID),
+		UserName: user.Username,
+		Active:   !user.Disabled,
+		Meta:     scimMeta{ResourceType: "User", Location: fmt.Sprintf("%s/Users/%d", base, user.ID)},
+	}
+	for _, name := range user.Roles {
+		if id, ok := roleIDs[name]; ok {
+			resource.Groups = append(resource.Groups, scimReference{
+				Value:   strconv.Itoa(id),
+				Display: name,
+				Ref:     fmt.Sprintf("%s/Groups/%d", base, id),
+			})
+		}
+	}
+	return resource
+}
+
+func (h *SCIMHandler) toSCIMGroup(c *gin.Context, role store.Role) (scimGroup, error) {
+	base := scimBaseURL(c)
+	resource := scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          strconv.Itoa(role.ID),
+		DisplayName: role.Name,
+		Meta:        scimMeta{ResourceType: "Group", Location: fmt.Sprintf("%s/Groups/%d", base, role.ID)},
+	}
+	if scimExcluded(c, "members") {
+		return resource, nil
+	}
+
+	users, err := h.roles.GetRoleUsers(role.ID)
+	if err != nil {
+		return resource, err
+	}
+	for _, user := range users {
+		resource.Members = append(resource.Members, scimReference{
+			Value:   strconv.Itoa(user.ID),
+			Display: user.Username,
+			Ref:     fmt.Sprintf("%s/Users/%d", base, user.ID),
+		})
+	}
+	return resource, nil
+}
+
+// values returns the attributes an operation sets, by name: the value
+// itself for an operation with a path, or the members of an object value
+// for one without.
+func (o scimPatchOperation) values() (map[string]json.RawMessage, error) {
+	if o.Path != "" {
+		return map[string]json.RawMessage{o.Path: o.Value}, nil
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(o.Value, &values); err != nil {
+		return nil, &scimError{Status: http.StatusBadRequest, Type: "noTarget", Detail: "An operation without path needs an object value"}
+	}
+	return values, nil
+}
+
+func bindSCIMPatch(c *gin.Context) ([]scimPatchOperation, error) {
+	var req scimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, &scimError{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: err.Error()}
+	}
+	for i := range req.Operations {
+		operation := &req.Operations[i]
+		operation.Op = strings.ToLower(operation.Op)
+		if operation.Op != "add" && operation.Op != "replace" && operation.Op != "remove" {
+			return nil, &scimError{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: fmt.Sprintf("Unsupported operation %q", operation.Op)}
+		}
+	}
+	return req.Operations, nil
+}
+
+// scimMemberFilter returns the user ID of a path like members[value eq "4"].
+func scimMemberFilter(path string) (int, error) {
+	invalid := &scimError{Status: http.StatusBadRequest, Type: "invalidPath", Detail: fmt.Sprintf("Unsupported path %q", path)}
+	inner, ok := strings.CutSuffix(path[len("members["):], "]")
+	if !ok {
+		return 0, invalid
+	}
+	filter, err := parseSCIMFilter(inner)
+	if err != nil || len(filter) != 1 || !strings.EqualFold(filter[0].attribute, "value") || filter[0].operator != "eq" {
+		return 0, invalid
+	}
+	value, _ := filter[0].value.(string)
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalid
+	}
+	return id, nil
+}
+
+func scimMemberIDs(references []scimReference) ([]int, error) {
+	var ids []int
+	for _, reference := range references {
+		id, err := strconv.Atoi(reference.Value)
+		if err != nil {
+			return nil, &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: fmt.Sprintf("Invalid member %q", reference.Value)}
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// scimBool accepts the strings "True" and "False" as well, which some
+// identity providers send.
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "active must be a boolean"}
+}
+
+func scimUserAttribute(user store.User) func(string) interface{} {
+	return func(name string) interface{} {
+		switch strings.ToLower(name) {
+		case "id":
+			return strconv.Itoa(user.ID)
+		case "username":
+			return user.Username
+		case "active":
+			return !user.Disabled
+		}
+		return nil
+	}
+}
+
+func scimGroupAttribute(role store.Role) func(string) interface{} {
+	return func(name string) interface{} {
+		switch strings.ToLower(name) {
+		case "id":
+			return strconv.Itoa(role.ID)
+		case "displayname":
+			return role.Name
+		}
+		return nil
+	}
+}
+
+// scimListParams reads the filter and the 1-based page of a list request.
+func scimListParams(c *gin.Context) (scimFilter, int, int, error) {
+	var filter scimFilter
+	if value := c.Query("filter"); value != "" {
+		var err error
+		if filter, err = parseSCIMFilter(value); err != nil {
+			return nil, 0, 0, &scimError{Status: http.StatusBadRequest, Type: "invalidFilter", Detail: err.Error()}
+		}
+	}
+
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(scimDefaultCount)))
+	if err != nil || count < 0 {
+		count = scimDefaultCount
+	}
+	return filter, startIndex, min(count, scimMaxCount), nil
+}
+
+func scimPage[T any](items []T, startIndex, count int) []T {
+	start := min(startIndex-1, len(items))
+	return items[start:min(start+count, len(items))]
+}
+
+func scimExcluded(c *gin.Context, attribute string) bool {
+	for _, excluded := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(excluded), attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+func scimBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/scim/v2"
+}
+
+func scimUserError(action string, err error) error {
+	switch {
+	case errors.Is(err, apperrors.ErrUserNotFound):
+		return &scimError{Status: http.StatusNotFound, Detail: "User not found"}
+	case errors.Is(err, apperrors.ErrDuplicateUsername):
+		return &scimError{Status: http.StatusConflict, Type: "uniqueness", Detail: "Username already exists"}
+	}
+	log.Printf("SCIM: failed to %s: %v", action, err)
+	return &scimError{Status: http.StatusInternalServerError, Detail: "Failed to " + action}
+}
+
+func scimRoleError(action string, err error) error {
+	switch {
+	case errors.Is(err, apperrors.ErrRoleNotFound):
+		return &scimError{Status: http.StatusNotFound, Detail: "Group not found"}
+	case errors.Is(err, apperrors.ErrDuplicateRole):
+		return &scimError{Status: http.StatusConflict, Type: "uniqueness", Detail: "Role already exists"}
+	case errors.Is(err, apperrors.ErrUserNotFound):
+		return &scimError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: "Members include an unknown user"}
+	}
+	log.Printf("SCIM: failed to %s: %v", action, err)
+	return &scimError{Status: http.StatusInternalServerError, Detail: "Failed to " + action}
+}
+
+func respondSCIM(c *gin.Context, status int, v interface{}) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, v)
+}
+
+func respondSCIMList(c *gin.Context, total, startIndex int, resources []interface{}) {
+	respondSCIM(c, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func respondSCIMFailure(c *gin.Context, action string, err error) {
+	log.Printf("SCIM: failed to %s: %v", action, err)
+	respondSCIMError(c, &scimError{Status: http.StatusInternalServerError, Detail: "Failed to " + action})
+}
+
+func respondSCIMError(c *gin.Context, err error) {
+	var scimErr *scimError
+	if !errors.As(err, &scimErr) {
+		respondSCIMFailure(c, "handle request", err)
+		return
+	}
+	body := gin.H{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(scimErr.Status),
+		"detail":  scimErr.Detail,
+	}
+	if scimErr.Type != "" {
+		body["scimType"] = scimErr.Type
+	}
+	respondSCIM(c, scimErr.Status, body)
+}
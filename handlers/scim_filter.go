@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// scimFilter is a parsed SCIM filter. Only comparisons joined by "and" are
+// supported, e.g. userName eq "gina" and active eq true; strings compare
+// case-insensitively.
+type scimFilter []scimComparison
+
+type scimComparison struct {
+	attribute string
+	operator  string
+	value     interface{}
+}
+
+var scimOperators = map[string]bool{"eq": true, "ne": true, "co": true, "sw": true, "ew": true, "pr": true}
+
+func parseSCIMFilter(filter string) (scimFilter, error) {
+	tokens, err := scimTokens(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed scimFilter
+	for len(tokens) > 0 {
+		if len(parsed) > 0 {
+			if !strings.EqualFold(tokens[0], "and") {
+				return nil, fmt.Errorf("unsupported filter: expected \"and\" before %q", tokens[0])
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 2 {
+			return nil, fmt.Errorf("incomplete filter")
+		}
+
+		comparison := scimComparison{attribute: tokens[0], operator: strings.ToLower(tokens[1])}
+		if !scimOperators[comparison.operator] {
+			return nil, fmt.Errorf("unsupported operator %q", tokens[1])
+		}
+		tokens = tokens[2:]
+		if comparison.operator != "pr" {
+			if len(tokens) == 0 {
+				return nil, fmt.Errorf("missing value for %s", comparison.attribute)
+			}
+			comparison.value, err = scimValue(tokens[0])
+			if err != nil {
+				return nil, err
+			}
+			tokens = tokens[1:]
+		}
+		parsed = append(parsed, comparison)
+	}
+	return parsed, nil
+}
+
+// matches reports whether the resource passes the filter; attribute
+// returns a resource's attribute by name, case-insensitively, and nil if it
+// has none.
+func (f scimFilter) matches(attribute func(name string) interface{}) bool {
+	for _, comparison := range f {
+		if !comparison.matches(attribute(comparison.attribute)) {
+			return false
+		}
+	}
+	return true
+}
+
+// equals returns the string the filter requires the attribute to equal,
+// if it does.
+func (f scimFilter) equals(attribute string) (string, bool) {
+	for _, comparison := range f {
+		value, ok := comparison.value.(string)
+		if ok && comparison.operator == "eq" && strings.EqualFold(comparison.attribute, attribute) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func (c scimComparison) matches(actual interface{}) bool {
+	if c.operator == "pr" {
+		return actual != nil && actual != ""
+	}
+
+	switch actual := actual.(type) {
+	case bool:
+		expected, ok := c.value.(bool)
+		switch c.operator {
+		case "eq":
+			return ok && actual == expected
+		case "ne":
+			return !ok || actual != expected
+		}
+		return false
+	case string:
+		expected, ok := c.value.(string)
+		if !ok {
+			return c.operator == "ne"
+		}
+		actual, expected = strings.ToLower(actual), strings.ToLower(expected)
+		switch c.operator {
+		case "eq":
+			return actual == expected
+		case "ne":
+			return actual != expected
+		case "co":
+			return strings.Contains(actual, expected)
+		case "sw":
+			return strings.HasPrefix(actual, expected)
+		case "ew":
+			return strings.HasSuffix(actual, expected)
+		}
+	}
+	return c.operator == "ne"
+}
+
+// scimTokens splits a filter at spaces outside quoted strings.
+func scimTokens(filter string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+	inString, escaped := false, false
+	for _, r := range filter {
+		switch {
+		case escaped:
+			escaped = false
+			token.WriteRune(r)
+		case inString && r == '\\':
+			escaped = true
+			token.WriteRune(r)
+		case r == '"':
+			inString = !inString
+			token.WriteRune(r)
+		case !inString && (r == '(' || r == ')' || r == '['):
+			return nil, fmt.Errorf("unsupported filter: grouping is not supported")
+		case !inString && r == ' ':
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if inString {
+		return nil, fmt.Errorf("unterminated string in filter")
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+	return tokens, nil
+}
+
+func scimValue(token string) (interface{}, error) {
+	switch strings.ToLower(token) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if strings.HasPrefix(token, `"`) {
+		value, err := strconv.Unquote(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s in filter", token)
+		}
+		return value, nil
+	}
+	if _, err := strconv.ParseFloat(token, 64); err == nil {
+		return token, nil
+	}
+	return nil, fmt.Errorf("invalid value %q in filter", token)
+}
@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestSCIMRouter serves SCIM user lists, group creation and PATCH over
+// a store where alice and bob are
+// members of the group staff and carol of none. The group managers has no
+// members.
+func newTestSCIMRouter(t *testing.T) (*gin.Engine, *store.MemoryStore, map[string]int, int) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s := store.NewMemoryStore()
+	roleID, err := s.CreateRole(store.Role{Name: "staff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateRole(store.Role{Name: "managers"}); err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]int{}
+	for _, user := range []store.User{
+		{Username: "alice", Roles: []string{"staff"}},
+		{Username: "bob", Roles: []string{"staff"}},
+		{Username: "carol"},
+	} {
+		id, err := s.CreateUser(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[user.Username] = id
+	}
+
+	h := NewSCIMHandler(s, s, "scim-token")
+	router := gin.New()
+	scim := router.Group("/scim/v2")
+	scim.Use(h.Authenticate())
+	scim.GET("/Users", h.GetUsers)
+	scim.PATCH("/Users/:id", h.PatchUser)
+	scim.POST("/Groups", h.CreateGroup)
+	scim.PATCH("/Groups/:id", h.PatchGroup)
+	return router, s, users, roleID
+}
+
+func patchSCIM(router *gin.Engine, path string, operations ...string) (int, map[string]interface{}) {
+	body := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[` + strings.Join(operations, ",") + `]}`
+	w := serve(router, http.MethodPatch, path, body, map[string]string{"Authorization": "Bearer scim-token"})
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestSCIMGetUsers(t *testing.T) {
+	router, s, users, _ := newTestSCIMRouter(t)
+	if err := s.SetUserDisabled(users["carol"], true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantTotal int
+		wantUsers []string
+	}{
+		{"all", "", 3, []string{"alice", "bob", "carol"}},
+		{"page", "startIndex=2&count=1", 3, []string{"bob"}},
+		{"last page", "startIndex=3&count=2", 3, []string{"carol"}},
+		{"past the end", "startIndex=4", 3, nil},
+		{"count only", "count=0", 3, nil},
+		{"userName eq", `filter=userName eq "bob"`, 1, []string{"bob"}},
+		{"userName eq other case", `filter=userName eq "BOB"`, 1, []string{"bob"}},
+		{"userName eq unknown", `filter=userName eq "dave"`, 0, nil},
+		{"userName eq and active", `filter=userName eq "carol" and active eq true`, 0, nil},
+		{"userName eq past the end", `filter=userName eq "bob"&startIndex=2`, 1, nil},
+		{"other filter", `filter=userName sw "A"`, 1, []string{"alice"}},
+		{"other filter paged", `filter=active eq true&startIndex=2&count=5`, 2, []string{"bob"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{}
+			for _, param := range strings.Split(tt.query, "&") {
+				if name, value, ok := strings.Cut(param, "="); ok {
+					query.Set(name, value)
+				}
+			}
+			w := serve(router, http.MethodGet, "/scim/v2/Users?"+query.Encode(), "", map[string]string{"Authorization": "Bearer scim-token"})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var response struct {
+				TotalResults int `json:"totalResults"`
+				Resources    []struct {
+					UserName string `json:"userName"`
+				} `json:"Resources"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, resource := range response.Resources {
+				names = append(names, resource.UserName)
+			}
+			if response.TotalResults != tt.wantTotal || !slices.Equal(names, tt.wantUsers) {
+				t.Errorf("totalResults %d, users %v; want %d, %v", response.TotalResults, names, tt.wantTotal, tt.wantUsers)
+			}
+		})
+	}
+}
+
+func TestSCIMPatchUser(t *testing.T) {
+	tests := []struct {
+		name         string
+		operations   []string
+		wantStatus   int
+		wantScimType string
+		wantUsername string
+		wantActive   bool
+	}{
+		{
+			name:         "replace userName",
+			operations:   []string{`{"op":"replace","path":"userName","value":"alice.smith"}`},
+			wantStatus:   http.StatusOK,
+			wantUsername: "alice.smith",
+			wantActive:   true,
+		},
+		{
+			name:         "deactivate by path",
+			operations:   []string{`{"op":"Replace","path":"active","value":false}`},
+			wantStatus:   http.StatusOK,
+			wantUsername: "alice",
+		},
+		{
+			name:         "deactivate without path",
+			operations:   []string{`{"op":"replace","value":{"active":"False"}}`},
+			wantStatus:   http.StatusOK,
+			wantUsername: "alice",
+		},
+		{
+			name:         "remove active",
+			operations:   []string{`{"op":"remove","path":"active"}`},
+			wantStatus:   http.StatusOK,
+			wantUsername: "alice",
+		},
+		{
+			name: "later operation wins",
+			operations: []string{
+				`{"op":"replace","path":"active","value":false}`,
+				`{"op":"add","value":{"active":true,"userName":"alice2"}}`,
+			},
+			wantStatus:   http.StatusOK,
+			wantUsername: "alice2",
+			wantActive:   true,
+		},
+		{
+			name:         "remove userName",
+			operations:   []string{`{"op":"remove","path":"userName"}`},
+			wantStatus:   http.StatusBadRequest,
+			wantScimType: "mutability",
+			wantUsername: "alice",
+			wantActive:   true,
+		},
+		{
+			name:         "empty userName",
+			operations:   []string{`{"op":"replace","path":"userName","value":""}`},
+			wantStatus:   http.StatusBadRequest,
+			wantScimType: "invalidValue",
+			wantUsername: "alice",
+			wantActive:   true,
+		},
+		{
+			name:         "invalid active",
+			operations:   []string{`{"op":"replace","path":"active","value":"maybe"}`},
+			wantStatus:   http.StatusBadRequest,
+			wantScimType: "invalidValue",
+			wantUsername: "alice",
+			wantActive:   true,
+		},
+		{
+			name:         "unsupported operation",
+			operations:   []string{`{"op":"move","path":"active","value":false}`},
+			wantStatus:   http.StatusBadRequest,
+			wantScimType: "invalidSyntax",
+			wantUsername: "alice",
+			wantActive:   true,
+		},
+		{
+			name:         "no path and no object",
+			operations:   []string{`{"op":"replace","value":false}`},
+			wantStatus:   http.StatusBadRequest,
+			wantScimType: "noTarget",
+			wantUsername: "alice",
+			wantActive:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, s, users, _ := newTestSCIMRouter(t)
+			status, response := patchSCIM(router, fmt.Sprintf("/scim/v2/Users/%d", users["alice"]), tt.operations...)
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %v", status, tt.wantStatus, response)
+			}
+			if status == http.StatusOK {
+				if response["userName"] != tt.wantUsername || response["active"] != tt.wantActive {
+					t.Errorf("response = %v, want userName %q, active %v", response, tt.wantUsername, tt.wantActive)
+				}
+			} else if response["scimType"] != tt.wantScimType {
+				t.Errorf("scimType = %v, want %q", response["scimType"], tt.wantScimType)
+			}
+
+			user, err := s.GetUser(users["alice"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Username != tt.wantUsername || user.Disabled == tt.wantActive {
+				t.Errorf("stored user %q, disabled %v; want %q, active %v", user.Username, user.Disabled, tt.wantUsername, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestSCIMPatchGroup(t *testing.T) {
+	tests := []struct {
+		name         string
+		operations   func(users map[string]int) []string
+		wantStatus   int
+		wantScimType string
+		wantName     string
+		wantMembers  []string
+	}{
+		{
+			name: "add members",
+			operations: func(users map[string]int) []string {
+				return []string{fmt.Sprintf(`{"op":"add","path":"members","value":[{"value":"%d"}]}`, users["carol"])}
+			},
+			wantStatus:  http.StatusOK,
+			wantName:    "staff",
+			wantMembers: []string{"alice", "bob", "carol"},
+		},
+		{
+			name: "replace members",
+			operations: func(users map[string]int) []string {
+				return []string{fmt.Sprintf(`{"op":"replace","path":"members","value":[{"value":"%d"}]}`, users["carol"])}
+			},
+			wantStatus:  http.StatusOK,
+			wantName:    "staff",
+			wantMembers: []string{"carol"},
+		},
+		{
+			name: "remove member by filter",
+			operations: func(users map[string]int) []string {
+				return []string{fmt.Sprintf(`{"op":"remove","path":"members[value eq \"%d\"]"}`, users["alice"])}
+			},
+			wantStatus:  http.StatusOK,
+			wantName:    "staff",
+			wantMembers: []string{"bob"},
+		},
+		{
+			name: "remove listed members",
+			operations: func(users map[string]int) []string {
+				return []string{fmt.Sprintf(`{"op":"remove","path":"members","value":[{"value":"%d"}]}`, users["bob"])}
+			},
+			wantStatus:  http.StatusOK,
+			wantName:    "staff",
+			wantMembers: []string{"alice"},
+		},
+		{
+			name: "remove all members",
+			operations: func(map[string]int) []string {
+				return []string{`{"op":"remove","path":"members"}`}
+			},
+			wantStatus: http.StatusOK,
+			wantName:   "staff",
+		},
+		{
+			name: "rename without path",
+			operations: func(map[string]int) []string {
+				return []string{`{"op":"replace","value":{"displayName":"employees"}}`}
+			},
+			wantStatus:  http.StatusOK,
+			wantName:    "employees",
+			wantMembers: []string{"alice", "bob"},
+		},
+		{
+			name: "operations apply in order",
+			operations: func(users map[string]int) []string {
+				return []string{
+					`{"op":"remove","path":"members"}`,
+					fmt.Sprintf(`{"op":"add","path":"members","value":[{"value":"%d"}]}`, users["bob"]),
+				}
+			},
+			wantStatus:  http.StatusOK,
+			wantName:    "staff",
+			wantMembers: []string{"bob"},
+		},
+		{
+			name: "remove displayName",
+			operations: func(map[string]int) []string {
+				return []string{`{"op":"remove","path":"displayName"}`}
+			},
+			wantStatus:   http.StatusBadRequest,
+			wantScimType: "mutability",
+			wantName:     "staff",
+			wantMembers:  []string{"alice", "bob"},
+		},
+		{
+			name: "unsupported member filter",
+			operations: func(map[string]int) []string {
+				return []string{`{"op":"remove","path":"members[display eq \"alice\"]"}`}
+			},
+			wantStatus:   http.StatusBadRequest,
+			wantScimType: "invalidPath",
+			wantName:     "staff",
+			wantMembers:  []string{"alice", "bob"},
+		},
+		{
+			name: "unknown member changes nothing",
+			operations: func(users map[string]int) []string {
+				return []string{
+					`{"op":"replace","path":"displayName","value":"employees"}`,
+					fmt.Sprintf(`{"op":"add","path":"members","value":[{"value":"%d"},{"value":"999"}]}`, users["carol"]),
+				}
+			},
+			wantStatus:   http.StatusBadRequest,
+			wantScimType: "invalidValue",
+			wantName:     "staff",
+			wantMembers:  []string{"alice", "bob"},
+		},
+		{
+			name: "taken displayName changes nothing",
+			operations: func(users map[string]int) []string {
+				return []string{
+					`{"op":"replace","path":"displayName","value":"managers"}`,
+					fmt.Sprintf(`{"op":"replace","path":"members","value":[{"value":"%d"}]}`, users["carol"]),
+				}
+			},
+			wantStatus:   http.StatusConflict,
+			wantScimType: "uniqueness",
+			wantName:     "staff",
+			wantMembers:  []string{"alice", "bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, s, users, roleID := newTestSCIMRouter(t)
+			status, response := patchSCIM(router, fmt.Sprintf("/scim/v2/Groups/%d", roleID), tt.operations(users)...)
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %v", status, tt.wantStatus, response)
+			}
+			if status == http.StatusOK && response["displayName"] != tt.wantName {
+				t.Errorf("displayName = %v, want %q", response["displayName"], tt.wantName)
+			}
+			if status != http.StatusOK && response["scimType"] != tt.wantScimType {
+				t.Errorf("scimType = %v, want %q", response["scimType"], tt.wantScimType)
+			}
+
+			role, err := s.GetRole(roleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if role.Name != tt.wantName {
+				t.Errorf("stored name %q, want %q", role.Name, tt.wantName)
+			}
+			members, err := s.GetRoleUsers(roleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, member := range members {
+				names = append(names, member.Username)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.wantMembers) {
+				t.Errorf("members = %v, want %v", names, tt.wantMembers)
+			}
+		})
+	}
+}
+
+func TestSCIMCreateGroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		members     func(users map[string]int) []int
+		wantStatus  int
+		wantMembers []string
+	}{
+		{
+			name:        "with members",
+			members:     func(users map[string]int) []int { return []int{users["alice"], users["carol"]} },
+			wantStatus:  http.StatusCreated,
+			wantMembers: []string{"alice", "carol"},
+		},
+		{
+			name:       "unknown member",
+			members:    func(users map[string]int) []int { return []int{users["alice"], 999} },
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, s, users, _ := newTestSCIMRouter(t)
+			var members []string
+			for _, id := range tt.members(users) {
+				members = append(members, fmt.Sprintf(`{"value":"%d"}`, id))
+			}
+			body := `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:Group"],"displayName":"ops","members":[` + strings.Join(members, ",") + `]}`
+			w := serve(router, http.MethodPost, "/scim/v2/Groups", body, map[string]string{"Authorization": "Bearer scim-token"})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			roles, err := s.GetRoles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var created *store.Role
+			for _, role := range roles {
+				if role.Name == "ops" {
+					created = &role
+				}
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if created != nil {
+					t.Fatalf("refused group left role %d behind", created.ID)
+				}
+				return
+			}
+			if created == nil {
+				t.Fatal("role not created")
+			}
+			roleUsers, err := s.GetRoleUsers(created.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, user := range roleUsers {
+				got = append(got, user.Username)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.wantMembers) {
+				t.Errorf("members %v, want %v", got, tt.wantMembers)
+			}
+		})
+	}
+}
+
+// unreliableUserStore fails every write but CreateUser, so a user can only
+// be provisioned in a single store call.
+type unreliableUserStore struct {
+	*store.MemoryStore
+}
+
+func (s unreliableUserStore) UpdateUser(store.User) error {
+	return errors.New("connection lost")
+}
+
+func (s unreliableUserStore) SetUserDisabled(int, bool) error {
+	return errors.New("connection lost")
+}
+
+func TestSCIMCreateUser(t *testing.T) {
+	tests := []struct {
+		name         string
+		active       string
+		wantDisabled bool
+	}{
+		{"active", `true`, false},
+		{"inactive", `false`, true},
+		{"active omitted", ``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			s := store.NewMemoryStore()
+			h := NewSCIMHandler(unreliableUserStore{s}, s, "scim-token")
+			router := gin.New()
+			router.POST("/scim/v2/Users", h.Authenticate(), h.CreateUser)
+
+			body := `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"dave"`
+			if tt.active != "" {
+				body += `,"active":` + tt.active
+			}
+			body += `}`
+			w := serve(router, http.MethodPost, "/scim/v2/Users", body, map[string]string{"Authorization": "Bearer scim-token"})
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response["active"] != !tt.wantDisabled {
+				t.Errorf("active %v in response, want %v", response["active"], !tt.wantDisabled)
+			}
+
+			user, err := s.GetUserByUsername("dave")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Disabled != tt.wantDisabled {
+				t.Errorf("disabled %v, want %v", user.Disabled, tt.wantDisabled)
+			}
+		})
+	}
+}
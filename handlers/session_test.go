@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"rbac/authz"
+	"rbac/middleware"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestSessionRouter adds the session endpoints to the auth router, wired
+// as the server wires them: revocations go through an InvalidatingStore and
+// requests are authenticated against a SessionCache.
+func newTestSessionRouter(t *testing.T) (*gin.Engine, *store.MemoryStore, int) {
+	t.Helper()
+	router, s, userID := newTestAuthRouter(t)
+
+	feed := authz.NewChangeFeed(s, nil, nil, time.Minute)
+	// Run starts the feed and returns, as its context is already done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	feed.Run(ctx)
+	writes := authz.NewInvalidatingStore(s, feed)
+
+	m := middleware.NewAuthMiddleware(authz.NewAuthorizer(s, s, s, s, s, nil), nil, authz.NewSessionCache(writes, feed))
+	h := NewSessionHandler(writes)
+	protected := router.Group("", m.Authenticate())
+	protected.POST("/logout", h.Logout)
+	protected.GET("/me/sessions", h.GetMySessions)
+	protected.DELETE("/me/sessions/:id", h.DeleteMySession)
+	router.DELETE("/users/:id/sessions", h.RevokeUserSessions)
+	return router, s, userID
+}
+
+func bearer(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func mySessions(t *testing.T, router *gin.Engine, token string) []SessionResponse {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/me/sessions", "", bearer(token))
+	if w.Code != http.StatusOK {
+		t.Fatalf("sessions: status %d: %s", w.Code, w.Body)
+	}
+	var sessions []SessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil {
+		t.Fatal(err)
+	}
+	return sessions
+}
+
+func TestLogout(t *testing.T) {
+	router, _, _ := newTestSessionRouter(t)
+	current := loginAlice(t, router)
+	other := loginAlice(t, router)
+	mySessions(t, router, current.AccessToken)
+
+	if w := serve(router, http.MethodPost, "/logout", "", bearer(current.AccessToken)); w.Code != http.StatusOK {
+		t.Fatalf("logout: status %d: %s", w.Code, w.Body)
+	}
+	if w := serve(router, http.MethodGet, "/me/sessions", "", bearer(current.AccessToken)); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token after logout: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := refresh(router, current.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token after logout: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	sessions := mySessions(t, router, other.AccessToken)
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("sessions after logout %+v, want only the other login", sessions)
+	}
+}
+
+func TestDeleteMySession(t *testing.T) {
+	router, s, _ := newTestSessionRouter(t)
+	current := loginAlice(t, router)
+	other := loginAlice(t, router)
+	mySessions(t, router, other.AccessToken)
+
+	bobID, err := s.CreateUser(store.User{Username: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobSession, err := s.CreateSession(store.Session{UserID: bobID, FamilyID: "bob", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var otherID int
+	for _, session := range mySessions(t, router, current.AccessToken) {
+		if !session.Current {
+			otherID = session.ID
+		}
+	}
+	if otherID == 0 {
+		t.Fatal("other session not listed")
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{"invalid ID", "abc", http.StatusBadRequest},
+		{"unknown session", "999", http.StatusNotFound},
+		{"another user's session", strconv.Itoa(bobSession), http.StatusNotFound},
+		{"own session", strconv.Itoa(otherID), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serve(router, http.MethodDelete, "/me/sessions/"+tt.id, "", bearer(current.AccessToken)); w.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.wantStatus, w.Body)
+		}
+	}
+
+	if w := serve(router, http.MethodGet, "/me/sessions", "", bearer(other.AccessToken)); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if sessions := mySessions(t, router, current.AccessToken); len(sessions) != 1 {
+		t.Errorf("%d sessions left, want 1", len(sessions))
+	}
+	session, err := s.GetSession(bobSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.RevokedAt.IsZero() {
+		t.Error("another user's session revoked")
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	router, _, userID := newTestSessionRouter(t)
+	first := loginAlice(t, router)
+	second := loginAlice(t, router)
+	mySessions(t, router, first.AccessToken)
+	mySessions(t, router, second.AccessToken)
+
+	if w := serve(router, http.MethodDelete, "/users/999/sessions", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serve(router, http.MethodDelete, "/users/"+strconv.Itoa(userID)+"/sessions", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	for _, login := range []LoginResponse{first, second} {
+		if w := serve(router, http.MethodGet, "/me/sessions", "", bearer(login.AccessToken)); w.Code != http.StatusUnauthorized {
+			t.Errorf("access token after revocation: status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+		if w := refresh(router, login.RefreshToken); w.Code != http.StatusUnauthorized {
+			t.Errorf("refresh token after revocation: status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+}
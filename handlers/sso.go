@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rbac/authn"
+	apperrors "rbac/errors"
+	"rbac/sso"
+	"rbac/store"
+	"rbac/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SSOHandler signs users in through external identity providers. Users
+// are created on their first sign-in, and their roles follow the
+// provider's role mappings on every sign-in.
+type SSOHandler struct {
+	auth       *AuthHandler
+	identities store.IdentityStore
+	providers  []*sso.Provider
+}
+
+type ProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+// loginStateTTL is how long a user has to sign in at the provider.
+const loginStateTTL = 10 * time.Minute
+
+// ssoStateCookie binds a sign-in to the browser that started it.
+const ssoStateCookie = "sso_state"
+
+func NewSSOHandler(auth *AuthHandler, identities store.IdentityStore, providers []*sso.Provider) *SSOHandler {
+	return &SSOHandler{auth: auth, identities: identities, providers: providers}
+}
+
+func (h *SSOHandler) GetProviders(c *gin.Context) {
+	response := []ProviderResponse{}
+	for _, provider := range h.providers {
+		response = append(response, ProviderResponse{
+			Name:        provider.Name,
+			DisplayName: provider.DisplayName,
+			LoginURL:    "/api/sso/" + provider.Name,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Login sends the user to the provider to sign in, optionally into the
+// tenant given by tenant_id.
+func (h *SSOHandler) Login(c *gin.Context) {
+	provider := h.provider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+		return
+	}
+
+	tenantID := 0
+	if param := c.Query("tenant_id"); param != "" {
+		var err error
+		tenantID, err = strconv.Atoi(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+			return
+		}
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := utils.RandomID()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign in"})
+			return
+		}
+		secrets[i] = secret
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("Failed to reach identity provider %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	err = h.identities.CreateLoginState(store.LoginState{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		TenantID:     tenantID,
+		ExpiresAt:    time.Now().Add(loginStateTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign in"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, state, int(loginStateTTL.Seconds()), "/api/sso", "",
+		strings.HasPrefix(provider.RedirectURI, "https:"), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes a sign-in when the provider sends the user back, and
+// responds like Login.
+func (h *SSOHandler) Callback(c *gin.Context) {
+	provider := h.provider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+		return
+	}
+
+	stateParam := c.Query("state")
+	cookie, _ := c.Cookie(ssoStateCookie)
+	c.SetCookie(ssoStateCookie, "", -1, "/api/sso", "", strings.HasPrefix(provider.RedirectURI, "https:"), true)
+	if stateParam == "" || cookie != stateParam {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	state, err := h.identities.UseLoginState(utils.HashToken(stateParam))
+	if err != nil && !errors.Is(err, apperrors.ErrLoginStateNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login state"})
+		return
+	}
+	if err != nil || state.Provider != provider.Name || time.Now().After(state.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	if idpError := c.Query("error"); idpError != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in was refused by the identity provider: " + idpError})
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("Sign in through %s failed: %v", provider.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in through the identity provider failed"})
+		return
+	}
+
+	granted, managed := claims.MapRoles(provider.RoleMappings)
+	user, err := authn.Provision(h.auth.users, h.identities,
+		store.Identity{Provider: provider.Name, Subject: claims.Subject()},
+		claims.String(provider.UsernameClaim), granted, managed)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrDuplicateUsername):
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		case errors.Is(err, apperrors.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "User is disabled"})
+		case errors.Is(err, apperrors.ErrMissingUsername):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider returned no username"})
+		default:
+			log.Printf("Failed to provision user from %s: %v", provider.Name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision user"})
+		}
+		return
+	}
+
+	if !h.auth.checkTenantAccess(c, user.ID, state.TenantID) {
+		return
+	}
+
+	roles, err := h.auth.authorizer.UserRoles(user, state.TenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user roles"})
+		return
+	}
+
+	if h.auth.challengeMFA(c, user.ID, state.TenantID) {
+		return
+	}
+
+	h.auth.respondLogin(c, user, roles, state.TenantID, nil)
+}
+
+func (h *SSOHandler) provider(name string) *sso.Provider {
+	for _, provider := range h.providers {
+		if provider.Name == name {
+			return provider
+		}
+	}
+	return nil
+}
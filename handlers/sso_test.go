@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"rbac/authn"
+	"rbac/authz"
+	"rbac/config"
+	"rbac/sso"
+	"rbac/store"
+	"rbac/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestSSORouter serves sign-in through an identity provider that
+// answers every code with an ID token for subject with the groups claim
+// groups. Members of "ops" are given the role ops, which requires MFA.
+func newTestSSORouter(t *testing.T, subject string, groups []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	key, _, err := utils.GenerateSigningKey("HS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.SetKeyring(utils.NewKeyring(key))
+	t.Cleanup(func() { utils.SetKeyring(nil) })
+
+	idpKey, _, err := utils.GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idp *httptest.Server
+	var nonce string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		nonce = r.URL.Query().Get("nonce")
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(utils.NewKeyring(idpKey).JWKS())
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		token := jwt.NewWithClaims(idpKey.Method, jwt.MapClaims{
+			"iss":                idp.URL,
+			"aud":                "rbac",
+			"sub":                subject,
+			"nonce":              nonce,
+			"preferred_username": subject,
+			"groups":             groups,
+			"iat":                time.Now().Unix(),
+			"exp":                time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = idpKey.ID
+		idToken, err := token.SignedString(idpKey.Private)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+	})
+	idp = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	s := store.NewMemoryStore()
+	if _, err := s.CreateRole(store.Role{Name: "ops", RequireMFA: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	authorizer := authz.NewAuthorizer(s, s, s, s, s, nil)
+	auth := NewAuthHandler(s, s, s, s, authn.NewLocal(s), authorizer, nil, authn.NewMFA(s, authorizer, "RBAC"))
+	provider := sso.NewProvider(config.ProviderConfig{
+		Name:          "corp",
+		Issuer:        idp.URL,
+		ClientID:      "rbac",
+		ClientSecret:  "rbac-secret",
+		RedirectURI:   "http://localhost/api/sso/corp/callback",
+		UsernameClaim: "preferred_username",
+		RoleMappings:  []config.RoleMapping{{Claim: "groups", Value: "ops", Role: "ops"}},
+	})
+	h := NewSSOHandler(auth, s, []*sso.Provider{provider})
+	router := gin.New()
+	router.GET("/api/sso/:provider", h.Login)
+	router.GET("/api/sso/:provider/callback", h.Callback)
+	return router
+}
+
+// signInThroughIdP starts a sign-in, lets the identity provider see the
+// authorization request and returns the callback's response.
+func signInThroughIdP(t *testing.T, router *gin.Engine) *httptest.ResponseRecorder {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/api/sso/corp", "", nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	cookie := w.Result().Cookies()[0]
+	query := url.Values{"code": {"code"}, "state": {authURL.Query().Get("state")}}
+	return serve(router, http.MethodGet, "/api/sso/corp/callback?"+query.Encode(), "",
+		map[string]string{"Cookie": cookie.Name + "=" + cookie.Value})
+}
+
+func TestSSOCallbackMFA(t *testing.T) {
+	tests := []struct {
+		name           string
+		groups         []string
+		wantMFA        bool
+		wantEnrollment bool
+	}{
+		{name: "no MFA role", groups: []string{"staff"}},
+		{name: "MFA role", groups: []string{"ops"}, wantMFA: true, wantEnrollment: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestSSORouter(t, "alice", tt.groups)
+			w := signInThroughIdP(t, router)
+			if w.Code != http.StatusOK {
+				t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+			}
+
+			var response struct {
+				MFAChallengeResponse
+				AccessToken string `json:"access_token"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.MFARequired != tt.wantMFA || response.EnrollmentRequired != tt.wantEnrollment {
+				t.Errorf("mfa_required %v, enrollment_required %v, want %v, %v",
+					response.MFARequired, response.EnrollmentRequired, tt.wantMFA, tt.wantEnrollment)
+			}
+			if gotTokens := response.AccessToken != ""; gotTokens == tt.wantMFA {
+				t.Errorf("issued tokens: %v, want %v", gotTokens, !tt.wantMFA)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	apperrors "rbac/errors"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TenantHandler struct {
+	tenants store.TenantStore
+}
+
+type TenantResponse struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type TenantRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type TenantUserResponse struct {
+	ID             int               `json:"id"`
+	Username       string            `json:"username"`
+	Roles          []string          `json:"roles"`
+	RoleConditions map[string]string `json:"role_conditions,omitempty"`
+}
+
+type TenantRolesRequest struct {
+	Roles          []string          `json:"roles"`
+	RoleConditions map[string]string `json:"role_conditions"`
+}
+
+func NewTenantHandler(tenants store.TenantStore) *TenantHandler {
+	return &TenantHandler{tenants: tenants}
+}
+
+func (h *TenantHandler) GetTenants(c *gin.Context) {
+	tenants, err := h.tenants.GetTenants()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tenants"})
+		return
+	}
+
+	var response []TenantResponse
+	for _, tenant := range tenants {
+		response = append(response, TenantResponse{ID: tenant.ID, Name: tenant.Name})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *TenantHandler) GetTenant(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+		return
+	}
+
+	tenant, err := h.tenants.GetTenant(id)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrTenantNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tenant"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TenantResponse{ID: tenant.ID, Name: tenant.Name})
+}
+
+func (h *TenantHandler) CreateTenant(c *gin.Context) {
+	var req TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID, err := h.tenants.CreateTenant(req.Name)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrDuplicateTenant) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tenant already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tenant"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": tenantID, "message": "Tenant created successfully"})
+}
+
+func (h *TenantHandler) UpdateTenant(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+		return
+	}
+
+	var req TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.tenants.UpdateTenant(store.Tenant{ID: id, Name: req.Name}); err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrTenantNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		case errors.Is(err, apperrors.ErrDuplicateTenant):
+			c.JSON(http.StatusConflict, gin.H{"error": "Tenant already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tenant"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tenant updated successfully"})
+}
+
+func (h *TenantHandler) DeleteTenant(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+		return
+	}
+
+	if err := h.tenants.DeleteTenant(id); err != nil {
+		if errors.Is(err, apperrors.ErrTenantNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tenant"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tenant deleted successfully"})
+}
+
+func (h *TenantHandler) GetTenantUsers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+		return
+	}
+
+	users, err := h.tenants.GetTenantUsers(id)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrTenantNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tenant users"})
+		return
+	}
+
+	var response []TenantUserResponse
+	for _, user := range users {
+		response = append(response, TenantUserResponse{
+			ID:             user.ID,
+			Username:       user.Username,
+			Roles:          user.Roles,
+			RoleConditions: user.RoleConditions,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *TenantHandler) GetUserTenantRoles(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	roles, conditions, err := h.tenants.GetUserTenantRoles(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrTenantNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		case errors.Is(err, apperrors.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tenant roles"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles, "role_conditions": conditions})
+}
+
+func (h *TenantHandler) SetUserTenantRoles(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant ID"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req TenantRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateConditions(req.RoleConditions, req.Roles); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.tenants.SetUserTenantRoles(id, userID, req.Roles, req.RoleConditions); err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrTenantNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		case errors.Is(err, apperrors.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, apperrors.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tenant roles"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tenant roles updated successfully"})
+}
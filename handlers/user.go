@@ -1,41 +1,52 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
+	apperrors "rbac/errors"
+	"rbac/store"
+
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserHandler struct {
-	db *sql.DB
+	users store.UserStore
 }
 
+// Roles cannot be chosen at registration: a request naming any is refused,
+// and roles are assigned afterwards with UpdateUser.
 type CreateUserRequest struct {
 	Username string   `json:"username" binding:"required"`
 	Password string   `json:"password" binding:"required,min=6"`
-	Roles    []string `json:"roles" binding:"required"`
+	Roles    []string `json:"roles"`
 }
 
 type UserResponse struct {
-	ID       int      `json:"id"`
-	Username string   `json:"username"`
-	Roles    []string `json:"roles"`
+	ID             int               `json:"id"`
+	Username       string            `json:"username"`
+	Disabled       bool              `json:"disabled,omitempty"`
+	Roles          []string          `json:"roles"`
+	RoleConditions map[string]string `json:"role_conditions,omitempty"`
+	Attributes     map[string]string `json:"attributes,omitempty"`
 }
 
 type UpdateUserRequest struct {
-	Username string   `json:"username" binding:"required"`
-	Roles    []string `json:"roles"`
+	Username       string            `json:"username" binding:"required"`
+	Roles          []string          `json:"roles"`
+	RoleConditions map[string]string `json:"role_conditions"`
+	Attributes     map[string]string `json:"attributes"`
+	Disabled       *bool             `json:"disabled"`
 }
 
 type UpdateUserRolesRequest struct {
 	Roles []string `json:"roles" binding:"required"`
 }
 
-func NewUserHandler(db *sql.DB) *UserHandler {
-	return &UserHandler{db: db}
+func NewUserHandler(users store.UserStore) *UserHandler {
+	return &UserHandler{users: users}
 }
 
 func (h *UserHandler) CreateUser(c *gin.Context) {
@@ -45,12 +56,10 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	if len(req.Roles) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Roles are assigned by an administrator"})
 		return
 	}
-	defer tx.Rollback()
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -58,45 +67,24 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	var userID int64
-	result, err := tx.Exec("INSERT INTO users (username, password) VALUES (?, ?)",
-		req.Username, hashedPassword)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
-		return
-	}
-
-	userID, err = result.LastInsertId()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID"})
-		return
-	}
-
-	for _, roleName := range req.Roles {
-		var roleID int
-		err := tx.QueryRow("SELECT id FROM roles WHERE name = ?", roleName).Scan(&roleID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role: " + roleName})
-			return
-		}
-
-		_, err = tx.Exec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)",
-			userID, roleID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
-			return
+	userID, err := h.users.CreateUser(store.User{
+		Username: req.Username,
+		Password: string(hashedPassword),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrDuplicateUsername):
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
 	response := UserResponse{
-		ID:       int(userID),
+		ID:       userID,
 		Username: req.Username,
-		Roles:    req.Roles,
+		Roles:    []string{},
 	}
 
 	c.JSON(http.StatusCreated, response)
@@ -105,37 +93,26 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 func (h *UserHandler) GetUsers(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
 	offset := (page - 1) * limit
 
-	rows, err := h.db.Query(`
-		SELECT DISTINCT u.id, u.username
-		FROM users u
-		LIMIT ? OFFSET ?
-	`, limit, offset)
+	users, err := h.users.GetUsers(limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
-	defer rows.Close()
 
-	var users []UserResponse
-	for rows.Next() {
-		var user UserResponse
-		if err := rows.Scan(&user.ID, &user.Username); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process users"})
-			return
-		}
-		
-		roles, err := h.getUserRoles(user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user roles"})
-			return
-		}
-		user.Roles = roles
-		users = append(users, user)
+	var response []UserResponse
+	for _, user := range users {
+		response = append(response, toUserResponse(user))
 	}
 
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
@@ -145,11 +122,9 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	var user UserResponse
-	err = h.db.QueryRow("SELECT id, username FROM users WHERE id = ?", id).
-		Scan(&user.ID, &user.Username)
+	user, err := h.users.GetUser(id)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
@@ -157,14 +132,7 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	roles, err := h.getUserRoles(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user roles"})
-		return
-	}
-	user.Roles = roles
-
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, toUserResponse(*user))
 }
 
 func (h *UserHandler) UpdateUser(c *gin.Context) {
@@ -180,44 +148,30 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+	if err := validateConditions(req.RoleConditions, req.Roles); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer tx.Rollback()
 
-	_, err = tx.Exec("UPDATE users SET username = ? WHERE id = ?", req.Username, id)
+	err = h.users.UpdateUser(store.User{
+		ID:             id,
+		Username:       req.Username,
+		Roles:          req.Roles,
+		RoleConditions: req.RoleConditions,
+		Attributes:     req.Attributes,
+		SetDisabled:    req.Disabled,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
-		return
-	}
-
-	if req.Roles != nil {
-		_, err = tx.Exec("DELETE FROM user_roles WHERE user_id = ?", id)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user roles"})
-			return
-		}
-
-		for _, roleName := range req.Roles {
-			var roleID int
-			err := tx.QueryRow("SELECT id FROM roles WHERE name = ?", roleName).Scan(&roleID)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role: " + roleName})
-				return
-			}
-
-			_, err = tx.Exec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", id, roleID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
-				return
-			}
+		switch {
+		case errors.Is(err, apperrors.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, apperrors.ErrDuplicateUsername):
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		case errors.Is(err, apperrors.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
@@ -231,62 +185,25 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
-		return
-	}
-	defer tx.Rollback()
-
-	_, err = tx.Exec("DELETE FROM user_roles WHERE user_id = ?", id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user roles"})
-		return
-	}
-
-	result, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
-	if err != nil {
+	if err := h.users.DeleteUser(id); err != nil {
+		if errors.Is(err, apperrors.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
 
-	affected, err := result.RowsAffected()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
-		return
-	}
-
-	if affected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
-func (h *UserHandler) getUserRoles(userID int) ([]string, error) {
-	rows, err := h.db.Query(`
-		SELECT r.name FROM roles r
-		JOIN user_roles ur ON r.id = ur.role_id
-		WHERE ur.user_id = ?
-	`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var roles []string
-	for rows.Next() {
-		var role string
-		if err := rows.Scan(&role); err != nil {
-			return nil, err
-		}
-		roles = append(roles, role)
+func toUserResponse(user store.User) UserResponse {
+	return UserResponse{
+		ID:             user.ID,
+		Username:       user.Username,
+		Disabled:       user.Disabled,
+		Roles:          user.Roles,
+		RoleConditions: user.RoleConditions,
+		Attributes:     user.Attributes,
 	}
-	return roles, nil
-} 
\ No newline at end of file
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateUserRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := store.NewMemoryStore()
+	if _, err := s.CreateRole(store.Role{Name: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.POST("/users", NewUserHandler(s).CreateUser)
+
+	w := serve(router, http.MethodPost, "/users", `{"username":"mallory","password":"secret1","roles":["admin"]}`, nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("with roles: status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	if _, err := s.GetUserByUsername("mallory"); err == nil {
+		t.Fatal("refused registration created the user")
+	}
+
+	w = serve(router, http.MethodPost, "/users", `{"username":"mallory","password":"secret1"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("without roles: status %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	user, err := s.GetUserByUsername("mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Roles) != 0 {
+		t.Errorf("registered with roles %v", user.Roles)
+	}
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
+	"rbac/authn"
+	"rbac/authz"
 	"rbac/config"
 	"rbac/handlers"
 	"rbac/middleware"
+	"rbac/migrations"
+	"rbac/sso"
+	"rbac/store"
+	"rbac/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 type User struct {
@@ -29,73 +40,316 @@ type Permission struct {
 }
 
 
-func getDB() (*sql.DB, error) {
-	dbConfig, err := config.LoadDBConfig()
+func getDB(dbConfig *config.DBConfig) (*sql.DB, store.Dialect, error) {
+	dialect, err := store.ParseDialect(dbConfig.Driver)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load database config: %w", err)
+		return nil, "", err
 	}
 
-	db, err := sql.Open("mysql", dbConfig.GetDSN())
+	db, err := sql.Open(dialect.DriverName(), dbConfig.GetDSN())
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		return nil, "", fmt.Errorf("failed to connect to database: %w", err)
 	}
 
 	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, "", fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return db, nil
+	return db, dialect, nil
 }
 
 
 func setupPublicRoutes(api *gin.RouterGroup, userHandler *handlers.UserHandler, authHandler *handlers.AuthHandler) {
 	api.POST("/users", userHandler.CreateUser)
 	api.POST("/login", authHandler.Login)
+	api.POST("/login/mfa", authHandler.LoginMFA)
+	api.POST("/login/mfa/totp", authHandler.EnrollLoginMFA)
 	api.POST("/refresh", authHandler.RefreshToken)
 
 }
 
 
-func setupProtectedRoutes(protected *gin.RouterGroup, userHandler *handlers.UserHandler, roleHandler *handlers.RoleHandler, authMiddleware *middleware.AuthMiddleware) {
+func setupProtectedRoutes(protected *gin.RouterGroup, userHandler *handlers.UserHandler, roleHandler *handlers.RoleHandler, permissionHandler *handlers.PermissionHandler, groupHandler *handlers.GroupHandler, tenantHandler *handlers.TenantHandler, bindingHandler *handlers.BindingHandler, authzHandler *handlers.AuthzHandler, sessionHandler *handlers.SessionHandler, mfaHandler *handlers.MFAHandler, keyHandler *handlers.KeyHandler, authMiddleware *middleware.AuthMiddleware) {
+
+	manageUsers := authMiddleware.RequireGlobalPermission(authz.ManageUsersPermission)
+	manageRoles := authMiddleware.RequireGlobalPermission(authz.ManageRolesPermission)
 
 	users := protected.Group("/users")
 	{
 		users.GET("", userHandler.GetUsers)
 		users.GET("/:id", userHandler.GetUser)
-		users.PUT("/:id", userHandler.UpdateUser)
-		users.DELETE("/:id", userHandler.DeleteUser)
+		users.PUT("/:id", manageUsers, userHandler.UpdateUser)
+		users.DELETE("/:id", manageUsers, userHandler.DeleteUser)
+		users.DELETE("/:id/sessions", manageUsers, sessionHandler.RevokeUserSessions)
+		users.DELETE("/:id/mfa", manageUsers, mfaHandler.ResetUserMFA)
+	}
+
+
+	protected.POST("/logout", sessionHandler.Logout)
+
+	me := protected.Group("/me")
+	{
+		me.GET("/sessions", sessionHandler.GetMySessions)
+		me.DELETE("/sessions/:id", sessionHandler.DeleteMySession)
+		me.GET("/mfa/totp", mfaHandler.GetMyTOTP)
+		me.POST("/mfa/totp", mfaHandler.EnrollMyTOTP)
+		me.POST("/mfa/totp/verify", mfaHandler.ConfirmMyTOTP)
+		me.DELETE("/mfa/totp", mfaHandler.DisableMyTOTP)
+		me.POST("/mfa/recovery-codes", mfaHandler.RegenerateMyRecoveryCodes)
 	}
 
 
 	roles := protected.Group("/roles")
 	{
 		roles.GET("", roleHandler.GetRoles)
-		roles.POST("", roleHandler.CreateRole)
+		roles.POST("", manageRoles, roleHandler.CreateRole)
 		roles.GET("/:id", roleHandler.GetRole)
-		roles.PUT("/:id", roleHandler.UpdateRole)
-		roles.DELETE("/:id", roleHandler.DeleteRole)
+		roles.PUT("/:id", manageRoles, roleHandler.UpdateRole)
+		roles.DELETE("/:id", manageRoles, roleHandler.DeleteRole)
+	}
+
+	permissions := protected.Group("/permissions")
+	{
+		permissions.GET("", permissionHandler.GetPermissions)
+		permissions.POST("", manageRoles, permissionHandler.CreatePermission)
+		permissions.GET("/:id", permissionHandler.GetPermission)
+		permissions.PUT("/:id", manageRoles, permissionHandler.UpdatePermission)
+		permissions.DELETE("/:id", manageRoles, permissionHandler.DeletePermission)
+	}
+
+
+	groups := protected.Group("/groups")
+	{
+		groups.GET("", groupHandler.GetGroups)
+		groups.POST("", manageRoles, groupHandler.CreateGroup)
+		groups.GET("/:id", groupHandler.GetGroup)
+		groups.PUT("/:id", manageRoles, groupHandler.UpdateGroup)
+		groups.DELETE("/:id", manageRoles, groupHandler.DeleteGroup)
+		groups.GET("/:id/members", groupHandler.GetGroupMembers)
+		groups.POST("/:id/members", manageRoles, groupHandler.AddGroupMember)
+		groups.DELETE("/:id/members/:user_id", manageRoles, groupHandler.RemoveGroupMember)
+	}
+
+
+	manageTenant := authMiddleware.RequireTenantPermission(authz.ManageRolesPermission, "id")
+
+	tenants := protected.Group("/tenants")
+	{
+		tenants.GET("", tenantHandler.GetTenants)
+		tenants.POST("", manageTenant, tenantHandler.CreateTenant)
+		tenants.GET("/:id", tenantHandler.GetTenant)
+		tenants.PUT("/:id", manageTenant, tenantHandler.UpdateTenant)
+		tenants.DELETE("/:id", manageTenant, tenantHandler.DeleteTenant)
+		tenants.GET("/:id/users", manageTenant, tenantHandler.GetTenantUsers)
+		tenants.GET("/:id/users/:user_id/roles", manageTenant, tenantHandler.GetUserTenantRoles)
+		tenants.PUT("/:id/users/:user_id/roles", manageTenant, tenantHandler.SetUserTenantRoles)
+	}
+
+
+	bindings := protected.Group("/bindings")
+	{
+		bindings.GET("", manageRoles, bindingHandler.GetBindings)
+		bindings.POST("", manageRoles, bindingHandler.CreateBinding)
+		bindings.DELETE("/:id", manageRoles, bindingHandler.DeleteBinding)
+	}
+
+
+	authzGroup := protected.Group("/authz")
+	{
+		authzGroup.GET("/decision", authMiddleware.RequireGlobalPermission(authz.DebugPermission), authzHandler.GetDecision)
+		authzGroup.POST("/explain", authMiddleware.RequireGlobalPermission(authz.DebugPermission), authzHandler.Explain)
+		authzGroup.POST("/check", authzHandler.CheckPermissions)
+		authzGroup.GET("/cache", authMiddleware.RequireGlobalPermission(authz.DebugPermission), authzHandler.GetCacheStats)
 	}
 
 
+	protected.GET("/keys", authMiddleware.RequireGlobalPermission(authz.ViewKeysPermission), keyHandler.GetKeys)
+
+
 	protected.GET("/protected", authMiddleware.RequirePermission("view_post"), func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "Protected content"})
 	})
+
+	protected.GET("/protected/posts/:id", authMiddleware.RequireResourcePermission("view_post", "post", "id"), func(c *gin.Context) {
+		c.JSON(200, gin.H{"message": "Protected post " + c.Param("id")})
+	})
 }
 
 
-func setupRouter(db *sql.DB) *gin.Engine {
+// pruneExpired deletes expired sessions, refresh tokens, authorization
+// codes, SSO login states and MFA challenges once an hour.
+func pruneExpired(s store.Store) {
+	for range time.Tick(time.Hour) {
+		if err := s.DeleteExpiredRefreshTokens(time.Now()); err != nil {
+			log.Printf("Failed to prune refresh tokens: %v", err)
+		}
+		if err := s.DeleteExpiredSessions(time.Now()); err != nil {
+			log.Printf("Failed to prune sessions: %v", err)
+		}
+		if err := s.DeleteExpiredAuthorizationCodes(time.Now()); err != nil {
+			log.Printf("Failed to prune authorization codes: %v", err)
+		}
+		if err := s.DeleteExpiredLoginStates(time.Now()); err != nil {
+			log.Printf("Failed to prune SSO login states: %v", err)
+		}
+		if err := s.DeleteExpiredMFAChallenges(time.Now()); err != nil {
+			log.Printf("Failed to prune MFA challenges: %v", err)
+		}
+	}
+}
+
+
+// loadKeyring loads the signing keys from the key directory, or else from
+// the single configured key and the previous ones.
+func loadKeyring(jwtConfig *config.JWTConfig) (*utils.Keyring, error) {
+	if jwtConfig.KeyDir != "" {
+		return utils.LoadKeyring(jwtConfig.KeyDir)
+	}
+
+	active, err := utils.LoadSigningKey(jwtConfig.SigningMethod, jwtConfig.SecretKey, jwtConfig.PrivateKeyFile, jwtConfig.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []*utils.SigningKey
+	for _, secret := range jwtConfig.PreviousSecretKeys {
+		key, err := utils.LoadSigningKey("HS256", secret, "", "")
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+	for _, file := range jwtConfig.PreviousKeyFiles {
+		key, err := utils.LoadKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+	return utils.NewKeyring(active, previous...), nil
+}
+
+
+func setupOIDCRoutes(router *gin.Engine, protected *gin.RouterGroup, oidcHandler *handlers.OIDCHandler, clientHandler *handlers.ClientHandler, authMiddleware *middleware.AuthMiddleware) {
+	router.GET("/.well-known/openid-configuration", oidcHandler.GetConfiguration)
+
+	oauth := router.Group("/oauth")
+	{
+		oauth.GET("/authorize", oidcHandler.Authorize)
+		oauth.POST("/authorize", oidcHandler.SubmitLogin)
+		oauth.POST("/token", oidcHandler.Token)
+		oauth.GET("/userinfo", oidcHandler.UserInfo)
+		oauth.POST("/userinfo", oidcHandler.UserInfo)
+	}
+
+	clients := protected.Group("/oauth/clients", authMiddleware.RequireGlobalPermission(authz.ManageClientsPermission))
+	{
+		clients.GET("", clientHandler.GetClients)
+		clients.POST("", clientHandler.CreateClient)
+		clients.DELETE("/:id", clientHandler.DeleteClient)
+	}
+}
+
+
+func setupSSORoutes(api *gin.RouterGroup, ssoHandler *handlers.SSOHandler) {
+	api.GET("/sso/providers", ssoHandler.GetProviders)
+	api.GET("/sso/:provider", ssoHandler.Login)
+	api.GET("/sso/:provider/callback", ssoHandler.Callback)
+}
+
+
+func setupSCIMRoutes(router *gin.Engine, scimHandler *handlers.SCIMHandler) {
+	scim := router.Group("/scim/v2")
+	scim.Use(scimHandler.Authenticate())
+	{
+		scim.GET("/ServiceProviderConfig", scimHandler.GetServiceProviderConfig)
+
+		scim.GET("/Users", scimHandler.GetUsers)
+		scim.POST("/Users", scimHandler.CreateUser)
+		scim.GET("/Users/:id", scimHandler.GetUser)
+		scim.PUT("/Users/:id", scimHandler.ReplaceUser)
+		scim.PATCH("/Users/:id", scimHandler.PatchUser)
+		scim.DELETE("/Users/:id", scimHandler.DeleteUser)
+
+		scim.GET("/Groups", scimHandler.GetGroups)
+		scim.POST("/Groups", scimHandler.CreateGroup)
+		scim.GET("/Groups/:id", scimHandler.GetGroup)
+		scim.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+		scim.PATCH("/Groups/:id", scimHandler.PatchGroup)
+		scim.DELETE("/Groups/:id", scimHandler.DeleteGroup)
+	}
+}
+
+
+// newAuthenticator checks passwords in the users table and then, if it is
+// configured, in the LDAP directory.
+func newAuthenticator(s store.Store, ldapConfig *config.LDAPConfig) (authn.Authenticator, error) {
+	chain := authn.Chain{authn.NewLocal(s)}
+	if ldapConfig.URL != "" {
+		directory, err := authn.NewLDAP(ldapConfig, s, s)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, directory)
+	}
+	return chain, nil
+}
+
+
+func setupRouter(db *sql.DB, dialect store.Dialect, authzConfig *config.AuthzConfig, oidcConfig *config.OIDCConfig, ssoConfig *config.SSOConfig, ldapConfig *config.LDAPConfig, scimConfig *config.SCIMConfig, mfaConfig *config.MFAConfig, keyring *utils.Keyring) (*gin.Engine, error) {
 
 	gin.SetMode(gin.ReleaseMode)
 
 
 	router := gin.Default()
+	if err := router.SetTrustedProxies(authzConfig.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("failed to set trusted proxies: %w", err)
+	}
 
 
-	userHandler := handlers.NewUserHandler(db)
-	roleHandler := handlers.NewRoleHandler(db)
-	authHandler := handlers.NewAuthHandler(db)
-	authMiddleware := middleware.NewAuthMiddleware(db)
+	sqlStore := store.NewSQLStore(db, dialect)
+	cache := authz.NewCache(authzConfig.CacheTTL, authzConfig.CacheSize)
+	authorizer := authz.NewAuthorizer(sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, cache)
+	changeFeed := authz.NewChangeFeed(sqlStore, cache, nil, authzConfig.ChangePollInterval)
+	go changeFeed.Run(context.Background())
+	go pruneExpired(sqlStore)
+	s := authz.NewInvalidatingStore(sqlStore, changeFeed)
 
+	var tokenPolicy *authz.TokenPolicy
+	if authzConfig.TokenPermissions {
+		tokenPolicy = authz.NewTokenPolicy(authorizer, changeFeed)
+	}
+
+	authenticator, err := newAuthenticator(s, ldapConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up LDAP: %w", err)
+	}
+
+	mfa := authn.NewMFA(s, authorizer, mfaConfig.Issuer)
+
+	userHandler := handlers.NewUserHandler(s)
+	roleHandler := handlers.NewRoleHandler(s)
+	permissionHandler := handlers.NewPermissionHandler(s)
+	groupHandler := handlers.NewGroupHandler(s)
+	tenantHandler := handlers.NewTenantHandler(s)
+	bindingHandler := handlers.NewBindingHandler(s)
+	authzHandler := handlers.NewAuthzHandler(authorizer)
+	authHandler := handlers.NewAuthHandler(s, s, s, s, authenticator, authorizer, tokenPolicy, mfa)
+	sessionHandler := handlers.NewSessionHandler(s)
+	mfaHandler := handlers.NewMFAHandler(s, s, mfa)
+	keyHandler := handlers.NewKeyHandler(keyring)
+	oidcHandler := handlers.NewOIDCHandler(authHandler, s, oidcConfig.Issuer)
+	clientHandler := handlers.NewClientHandler(s)
+	var providers []*sso.Provider
+	for _, providerConfig := range ssoConfig.Providers {
+		providers = append(providers, sso.NewProvider(providerConfig))
+	}
+	ssoHandler := handlers.NewSSOHandler(authHandler, s, providers)
+	scimHandler := handlers.NewSCIMHandler(s, s, scimConfig.Token)
+	authMiddleware := middleware.NewAuthMiddleware(authorizer, tokenPolicy, authz.NewSessionCache(s, changeFeed))
+
+
+	router.GET("/.well-known/jwks.json", keyHandler.GetJWKS)
 
 	api := router.Group("/api")
 	{
@@ -103,25 +357,222 @@ func setupRouter(db *sql.DB) *gin.Engine {
 		
 		protected := api.Group("")
 		protected.Use(authMiddleware.Authenticate())
-		setupProtectedRoutes(protected, userHandler, roleHandler, authMiddleware)
+		setupProtectedRoutes(protected, userHandler, roleHandler, permissionHandler, groupHandler, tenantHandler, bindingHandler, authzHandler, sessionHandler, mfaHandler, keyHandler, authMiddleware)
+
+		if oidcConfig.Issuer != "" {
+			setupOIDCRoutes(router, protected, oidcHandler, clientHandler, authMiddleware)
+		}
+
+		if len(providers) > 0 {
+			setupSSORoutes(api, ssoHandler)
+		}
+	}
+
+	if scimConfig.Token != "" {
+		setupSCIMRoutes(router, scimHandler)
 	}
 
-	return router
+	return router, nil
 }
 
 
 func initializeApp() (*gin.Engine, *sql.DB, error) {
-	db, err := getDB()
+	dbConfig, err := config.LoadDBConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load database config: %w", err)
+	}
+
+	db, dialect, err := getDB(dbConfig)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	router := setupRouter(db)
+	if dbConfig.AutoMigrate {
+		migrator, err := migrations.NewMigrator(db, dialect)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load migrations: %w", err)
+		}
+
+		applied, err := migrator.Up()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+	}
+
+	jwtConfig, err := config.LoadJWTConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load JWT config: %w", err)
+	}
+
+	keyring, err := loadKeyring(jwtConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	utils.SetKeyring(keyring)
+	go keyring.Run(context.Background(), jwtConfig.KeyReloadInterval)
+
+	authzConfig, err := config.LoadAuthzConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load authorization config: %w", err)
+	}
+
+	oidcConfig, err := config.LoadOIDCConfig(jwtConfig.SigningMethod)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load OIDC config: %w", err)
+	}
+
+	ssoConfig, err := config.LoadSSOConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load SSO config: %w", err)
+	}
+
+	ldapConfig, err := config.LoadLDAPConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load LDAP config: %w", err)
+	}
+
+	scimConfig, err := config.LoadSCIMConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load SCIM config: %w", err)
+	}
+
+	mfaConfig, err := config.LoadMFAConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load MFA config: %w", err)
+	}
+
+	router, err := setupRouter(db, dialect, authzConfig, oidcConfig, ssoConfig, ldapConfig, scimConfig, mfaConfig, keyring)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	return router, db, nil
 }
 
+func runMigrate(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s migrate up|down|status", os.Args[0])
+	}
+
+	dbConfig, err := config.LoadDBConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load database config: %w", err)
+	}
+
+	db, dialect, err := getDB(dbConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		reverted, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		if reverted == nil {
+			fmt.Println("no migrations to roll back")
+			return nil
+		}
+		fmt.Printf("rolled back %04d_%s\n", reverted.Version, reverted.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+	return nil
+}
+
+// runKeys manages the key directory; rotate is meant to be run on a
+// schedule, e.g. from cron.
+func runKeys(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s keys rotate|status", os.Args[0])
+	}
+
+	if err := config.LoadEnv(); err != nil {
+		return err
+	}
+	jwtConfig, err := config.LoadJWTConfig()
+	if err != nil {
+		return err
+	}
+	if jwtConfig.KeyDir == "" {
+		return fmt.Errorf("JWT_KEY_DIR is not set")
+	}
+
+	switch args[0] {
+	case "rotate":
+		key, err := utils.RotateKeys(jwtConfig.KeyDir, jwtConfig.SigningMethod, jwtConfig.KeyActivationDelay)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("added %s key %s, active from %s\n", key.Algorithm, key.ID, key.ActivatesAt.Format(time.RFC3339))
+	case "status":
+		keyring, err := utils.LoadKeyring(jwtConfig.KeyDir)
+		if err != nil {
+			return err
+		}
+		for _, key := range keyring.Status() {
+			fmt.Printf("%s\t%s\t%s", key.ID, key.Algorithm, key.Status)
+			if key.ExpiresAt != nil {
+				fmt.Printf(" until %s", key.ExpiresAt.Format(time.RFC3339))
+			} else if key.Status == utils.KeyPending {
+				fmt.Printf(" from %s", key.ActivatesAt.Format(time.RFC3339))
+			}
+			fmt.Println()
+		}
+	default:
+		return fmt.Errorf("unknown keys command: %s", args[0])
+	}
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		if err := runKeys(os.Args[2:]); err != nil {
+			log.Fatalf("Key command failed: %v", err)
+		}
+		return
+	}
+
 	router, db, err := initializeApp()
 	if err != nil {
 		log.Fatalf("Failed to initialize application: %v", err)
@@ -1,19 +1,31 @@
 package middleware
 
 import (
-	"database/sql"
+	"errors"
+	"log"
+	"rbac/authz"
+	apperrors "rbac/errors"
+	"rbac/store"
 	"rbac/utils"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthMiddleware struct {
-	db *sql.DB
+	authorizer *authz.Authorizer
+	tokens     *authz.TokenPolicy
+	sessions   store.SessionStore
 }
 
-func NewAuthMiddleware(db *sql.DB) *AuthMiddleware {
-	return &AuthMiddleware{db: db}
+// sessionTouchInterval limits how often requests update a session's last
+// use.
+const sessionTouchInterval = time.Minute
+
+func NewAuthMiddleware(authorizer *authz.Authorizer, tokens *authz.TokenPolicy, sessions store.SessionStore) *AuthMiddleware {
+	return &AuthMiddleware{authorizer: authorizer, tokens: tokens, sessions: sessions}
 }
 
 func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
@@ -30,15 +42,34 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := utils.ValidateJWT(parts[1])
+		claims, err := utils.ValidateJWT(parts[1], utils.AccessToken)
 		if err != nil {
 			c.AbortWithStatusJSON(401, gin.H{"error": "Invalid or expired token"})
 			return
 		}
 
+		session, err := m.sessions.GetSession(claims.SessionID)
+		if err != nil && !errors.Is(err, apperrors.ErrSessionNotFound) {
+			c.AbortWithStatusJSON(500, gin.H{"error": "Failed to fetch session"})
+			return
+		}
+		if err != nil || !session.RevokedAt.IsZero() || time.Now().After(session.ExpiresAt) {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Session expired or revoked"})
+			return
+		}
+		if time.Since(session.LastUsedAt) >= sessionTouchInterval {
+			if err := m.sessions.TouchSession(session.ID, c.ClientIP(), time.Time{}); err != nil {
+				log.Printf("Failed to update session %d: %v", session.ID, err)
+			}
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("roles", claims.Roles)
+		c.Set("tenant_id", claims.TenantID)
+		c.Set("permissions", claims.Permissions)
+		c.Set("policy_version", claims.PolicyVersion)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
@@ -51,22 +82,120 @@ func (m *AuthMiddleware) RequirePermission(permission string) gin.HandlerFunc {
 			return
 		}
 
-		var hasPermission bool
-		err := m.db.QueryRow(`
-			SELECT EXISTS (
-				SELECT 1 FROM users u
-				JOIN user_roles ur ON u.id = ur.user_id
-				JOIN role_permissions rp ON ur.role_id = rp.role_id
-				JOIN permissions p ON rp.permission_id = p.id
-				WHERE u.id = ? AND p.name = ?
-			)
-		`, userID, permission).Scan(&hasPermission)
-
-		if err != nil || !hasPermission {
-			c.AbortWithStatusJSON(403, gin.H{"error": "Forbidden"})
+		m.authorize(c, userID.(int), c.GetInt("tenant_id"), permission)
+	}
+}
+
+// RequireGlobalPermission checks the permission outside tenants, for routes
+// that manage global state such as users and roles. Roles the caller holds
+// in the tenant they are logged in to do not count.
+func (m *AuthMiddleware) RequireGlobalPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		m.authorize(c, userID.(int), 0, permission)
+	}
+}
+
+// RequireTenantPermission checks the permission within the tenant whose ID
+// is taken from the route parameter param. The caller's roles in a tenant
+// only count when they are logged in to it; for any other tenant, and on
+// routes without the parameter, the permission has to be held globally.
+func (m *AuthMiddleware) RequireTenantPermission(permission, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
+		tenantID := c.GetInt("tenant_id")
+		if c.Param(param) != strconv.Itoa(tenantID) {
+			tenantID = 0
+		}
+		m.authorize(c, userID.(int), tenantID, permission)
+	}
+}
+
+// authorize continues with the request if the user holds the permission
+// within the tenant, and forbids it otherwise. The permissions embedded in
+// the token only answer for the tenant it was issued for.
+func (m *AuthMiddleware) authorize(c *gin.Context, userID, tenantID int, permission string) {
+	if tenantID == c.GetInt("tenant_id") && m.tokens.Allows(userID, c.GetInt("policy_version"), c.GetStringSlice("permissions"), permission) {
 		c.Next()
+		return
 	}
-} 
\ No newline at end of file
+
+	req := authz.Request{
+		UserID:     userID,
+		TenantID:   tenantID,
+		Permission: permission,
+		Env:        RequestEnv(c),
+	}
+	hasPermission, err := m.authorizer.Authorize(req)
+	if err != nil || !hasPermission {
+		m.forbid(c, req)
+		return
+	}
+
+	c.Next()
+}
+
+// RequireResourcePermission checks the permission on the resource of the
+// given type whose ID is taken from the route parameter param.
+func (m *AuthMiddleware) RequireResourcePermission(permission, resourceType, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		req := authz.Request{
+			UserID:     userID.(int),
+			TenantID:   c.GetInt("tenant_id"),
+			Permission: permission,
+			Resource:   &authz.Resource{Type: resourceType, ID: c.Param(param)},
+			Env:        RequestEnv(c),
+		}
+		allowed, err := m.authorizer.Authorize(req)
+		if err != nil || !allowed {
+			m.forbid(c, req)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// forbid rejects the request. Callers holding authz.DebugPermission who send
+// "X-Authz-Debug: true" also get the evaluation trace of req.
+func (m *AuthMiddleware) forbid(c *gin.Context, req authz.Request) {
+	body := gin.H{"error": "Forbidden"}
+	if c.GetHeader("X-Authz-Debug") == "true" {
+		debug := req
+		debug.Permission = authz.DebugPermission
+		debug.Resource = nil
+		if allowed, err := m.authorizer.Authorize(debug); err == nil && allowed {
+			if explanation, err := m.authorizer.Explain(req); err == nil {
+				body["trace"] = explanation
+			}
+		}
+	}
+	c.AbortWithStatusJSON(403, body)
+}
+
+// RequestEnv collects the request attributes conditions can refer to.
+func RequestEnv(c *gin.Context) authz.Env {
+	return authz.Env{
+		IP:      c.ClientIP(),
+		Method:  c.Request.Method,
+		Path:    c.Request.URL.Path,
+		Headers: c.Request.Header,
+		Time:    time.Now(),
+	}
+}
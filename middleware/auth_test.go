@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"rbac/authz"
+	"rbac/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireTenantPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := store.NewMemoryStore()
+	if _, err := s.CreatePermission(authz.ManageRolesPermission); err != nil {
+		t.Fatal(err)
+	}
+	acme, err := s.CreateTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	globex, err := s.CreateTenant("globex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateRole(store.Role{Name: "admin", Permissions: []string{authz.ManageRolesPermission}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateRole(store.Role{Name: "admin", TenantID: acme, Permissions: []string{authz.ManageRolesPermission}}); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := s.CreateUser(store.User{Username: "admin", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenantAdmin, err := s.CreateUser(store.User{Username: "tenant-admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUserTenantRoles(acme, tenantAdmin, []string{"admin"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewAuthMiddleware(authz.NewAuthorizer(s, s, s, s, s, nil), nil, s)
+
+	tests := []struct {
+		name        string
+		userID      int
+		tokenTenant int
+		path        string
+		want        int
+	}{
+		{"tenant admin in own tenant", tenantAdmin, acme, "/tenants/" + strconv.Itoa(acme), http.StatusOK},
+		{"tenant admin in other tenant", tenantAdmin, acme, "/tenants/" + strconv.Itoa(globex), http.StatusForbidden},
+		{"tenant admin outside tenants", tenantAdmin, acme, "/tenants", http.StatusForbidden},
+		{"tenant admin logged in globally", tenantAdmin, 0, "/tenants/" + strconv.Itoa(acme), http.StatusForbidden},
+		{"global admin in any tenant", admin, 0, "/tenants/" + strconv.Itoa(globex), http.StatusOK},
+		{"global admin outside tenants", admin, 0, "/tenants", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("user_id", tt.userID)
+				c.Set("tenant_id", tt.tokenTenant)
+			})
+			ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+			router.POST("/tenants", m.RequireTenantPermission(authz.ManageRolesPermission, "id"), ok)
+			router.POST("/tenants/:id", m.RequireTenantPermission(authz.ManageRolesPermission, "id"), ok)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireGlobalPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := store.NewMemoryStore()
+	if _, err := s.CreatePermission(authz.ManageRolesPermission); err != nil {
+		t.Fatal(err)
+	}
+	acme, err := s.CreateTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateRole(store.Role{Name: "admin", Permissions: []string{authz.ManageRolesPermission}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateRole(store.Role{Name: "tenant-admin", TenantID: acme, Permissions: []string{authz.ManageRolesPermission}}); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := s.CreateUser(store.User{Username: "admin", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenantAdmin, err := s.CreateUser(store.User{Username: "tenant-admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUserTenantRoles(acme, tenantAdmin, []string{"tenant-admin"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	authorizer := authz.NewAuthorizer(s, s, s, s, s, nil)
+	feed := authz.NewChangeFeed(s, nil, nil, time.Minute)
+	// Run starts the feed and returns, as its context is already done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	feed.Run(ctx)
+	tokens := authz.NewTokenPolicy(authorizer, feed)
+	m := NewAuthMiddleware(authorizer, tokens, s)
+
+	tests := []struct {
+		name        string
+		userID      int
+		tokenTenant int
+		want        int
+	}{
+		{"tenant admin logged in to the tenant", tenantAdmin, acme, http.StatusForbidden},
+		{"tenant admin logged in globally", tenantAdmin, 0, http.StatusForbidden},
+		{"global admin logged in globally", admin, 0, http.StatusOK},
+		{"global admin logged in to a tenant", admin, acme, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The token carries the permissions issued for its tenant.
+			permissions, version, err := tokens.Issue(tt.userID, tt.tokenTenant)
+			if err != nil {
+				t.Fatal(err)
+			}
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("user_id", tt.userID)
+				c.Set("tenant_id", tt.tokenTenant)
+				c.Set("permissions", permissions)
+				c.Set("policy_version", version)
+			})
+			router.PUT("/roles/:id", m.RequireGlobalPermission(authz.ManageRolesPermission), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/roles/1", nil))
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS permissions (
+  id {{serial}},
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+  id {{serial}},
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+  role_id INT NOT NULL,
+  permission_id INT NOT NULL,
+  PRIMARY KEY (role_id, permission_id),
+  FOREIGN KEY (role_id) REFERENCES roles (id),
+  FOREIGN KEY (permission_id) REFERENCES permissions (id)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+  id {{serial}},
+  username VARCHAR(50) NOT NULL UNIQUE,
+  password VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+  user_id INT NOT NULL,
+  role_id INT NOT NULL,
+  PRIMARY KEY (user_id, role_id),
+  FOREIGN KEY (user_id) REFERENCES users (id),
+  FOREIGN KEY (role_id) REFERENCES roles (id)
+);
+
+INSERT INTO permissions (name)
+SELECT seed.name FROM (
+  SELECT 'create_post' AS name
+  UNION ALL SELECT 'edit_post'
+  UNION ALL SELECT 'delete_post'
+  UNION ALL SELECT 'view_post'
+) seed
+WHERE NOT EXISTS (SELECT 1 FROM permissions p WHERE p.name = seed.name);
+
+INSERT INTO roles (name)
+SELECT seed.name FROM (
+  SELECT 'admin' AS name
+  UNION ALL SELECT 'user'
+  UNION ALL SELECT 'guest'
+) seed
+WHERE NOT EXISTS (SELECT 1 FROM roles r WHERE r.name = seed.name);
@@ -0,0 +1,7 @@
+CREATE TABLE role_parents (
+  role_id INT NOT NULL,
+  parent_id INT NOT NULL,
+  PRIMARY KEY (role_id, parent_id),
+  FOREIGN KEY (role_id) REFERENCES roles (id),
+  FOREIGN KEY (parent_id) REFERENCES roles (id)
+);
@@ -0,0 +1,21 @@
+CREATE TABLE `groups` (
+  id {{serial}},
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE group_members (
+  group_id INT NOT NULL,
+  user_id INT NOT NULL,
+  PRIMARY KEY (group_id, user_id),
+  FOREIGN KEY (group_id) REFERENCES `groups` (id),
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE group_roles (
+  group_id INT NOT NULL,
+  role_id INT NOT NULL,
+  PRIMARY KEY (group_id, role_id),
+  FOREIGN KEY (group_id) REFERENCES `groups` (id),
+  FOREIGN KEY (role_id) REFERENCES roles (id)
+);
@@ -0,0 +1,15 @@
+DROP TABLE tenant_user_roles;
+
+DELETE FROM role_permissions WHERE role_id IN (SELECT id FROM roles WHERE tenant_id IS NOT NULL);
+
+DELETE FROM role_parents WHERE role_id IN (SELECT id FROM roles WHERE tenant_id IS NOT NULL);
+
+DELETE FROM roles WHERE tenant_id IS NOT NULL;
+
+ALTER TABLE roles
+  DROP FOREIGN KEY roles_tenant_fk,
+  DROP INDEX roles_tenant_name,
+  DROP COLUMN tenant_id,
+  ADD UNIQUE KEY name (name);
+
+DROP TABLE tenants;
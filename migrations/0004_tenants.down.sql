@@ -0,0 +1,15 @@
+DROP TABLE tenant_user_roles;
+
+DELETE FROM role_permissions WHERE role_id IN (SELECT id FROM roles WHERE tenant_id IS NOT NULL);
+
+DELETE FROM role_parents WHERE role_id IN (SELECT id FROM roles WHERE tenant_id IS NOT NULL);
+
+DELETE FROM roles WHERE tenant_id IS NOT NULL;
+
+DROP INDEX roles_tenant_name;
+
+ALTER TABLE roles DROP COLUMN tenant_id;
+
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
+
+DROP TABLE tenants;
@@ -0,0 +1,21 @@
+DROP TABLE tenant_user_roles;
+
+DELETE FROM role_permissions WHERE role_id IN (SELECT id FROM roles WHERE tenant_id IS NOT NULL);
+
+DELETE FROM role_parents WHERE role_id IN (SELECT id FROM roles WHERE tenant_id IS NOT NULL);
+
+DELETE FROM roles WHERE tenant_id IS NOT NULL;
+
+CREATE TABLE roles_old (
+  id {{serial}},
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO roles_old (id, name, created_at) SELECT id, name, created_at FROM roles;
+
+DROP TABLE roles;
+
+ALTER TABLE roles_old RENAME TO roles;
+
+DROP TABLE tenants;
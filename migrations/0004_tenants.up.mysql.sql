@@ -0,0 +1,21 @@
+CREATE TABLE tenants (
+  id {{serial}},
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE roles
+  ADD COLUMN tenant_id INT NULL,
+  ADD CONSTRAINT roles_tenant_fk FOREIGN KEY (tenant_id) REFERENCES tenants (id),
+  DROP INDEX name,
+  ADD UNIQUE KEY roles_tenant_name (tenant_id, name);
+
+CREATE TABLE tenant_user_roles (
+  tenant_id INT NOT NULL,
+  user_id INT NOT NULL,
+  role_id INT NOT NULL,
+  PRIMARY KEY (tenant_id, user_id, role_id),
+  FOREIGN KEY (tenant_id) REFERENCES tenants (id),
+  FOREIGN KEY (user_id) REFERENCES users (id),
+  FOREIGN KEY (role_id) REFERENCES roles (id)
+);
@@ -0,0 +1,32 @@
+CREATE TABLE tenants (
+  id {{serial}},
+  name VARCHAR(50) NOT NULL UNIQUE,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- SQLite cannot drop the UNIQUE constraint on roles.name, so the table is
+-- rebuilt without it.
+CREATE TABLE roles_new (
+  id {{serial}},
+  name VARCHAR(50) NOT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  tenant_id INT NULL REFERENCES tenants (id)
+);
+
+INSERT INTO roles_new (id, name, created_at) SELECT id, name, created_at FROM roles;
+
+DROP TABLE roles;
+
+ALTER TABLE roles_new RENAME TO roles;
+
+CREATE UNIQUE INDEX roles_tenant_name ON roles (tenant_id, name);
+
+CREATE TABLE tenant_user_roles (
+  tenant_id INT NOT NULL,
+  user_id INT NOT NULL,
+  role_id INT NOT NULL,
+  PRIMARY KEY (tenant_id, user_id, role_id),
+  FOREIGN KEY (tenant_id) REFERENCES tenants (id),
+  FOREIGN KEY (user_id) REFERENCES users (id),
+  FOREIGN KEY (role_id) REFERENCES roles (id)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE resource_role_bindings (
+  id {{serial}},
+  user_id INT NOT NULL,
+  role_id INT NOT NULL,
+  tenant_id INT NULL,
+  resource_type VARCHAR(50) NOT NULL,
+  resource_id VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users (id),
+  FOREIGN KEY (role_id) REFERENCES roles (id),
+  FOREIGN KEY (tenant_id) REFERENCES tenants (id)
+);
+
+CREATE INDEX resource_role_bindings_user ON resource_role_bindings (user_id, resource_type);
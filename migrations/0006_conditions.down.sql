@@ -0,0 +1,9 @@
+ALTER TABLE resource_role_bindings DROP COLUMN condition_expr;
+
+ALTER TABLE role_permissions DROP COLUMN condition_expr;
+
+ALTER TABLE tenant_user_roles DROP COLUMN condition_expr;
+
+ALTER TABLE user_roles DROP COLUMN condition_expr;
+
+ALTER TABLE users DROP COLUMN attributes;
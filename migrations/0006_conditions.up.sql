@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN attributes TEXT NULL;
+
+ALTER TABLE user_roles ADD COLUMN condition_expr TEXT NULL;
+
+ALTER TABLE tenant_user_roles ADD COLUMN condition_expr TEXT NULL;
+
+ALTER TABLE role_permissions ADD COLUMN condition_expr TEXT NULL;
+
+ALTER TABLE resource_role_bindings ADD COLUMN condition_expr TEXT NULL;
@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE effect = 'deny';
+
+ALTER TABLE role_permissions DROP COLUMN effect;
@@ -0,0 +1 @@
+ALTER TABLE role_permissions ADD COLUMN effect VARCHAR(10) NOT NULL DEFAULT 'allow';
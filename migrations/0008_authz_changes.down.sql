@@ -0,0 +1 @@
+DROP TABLE authz_changes;
@@ -0,0 +1,7 @@
+CREATE TABLE authz_changes (
+  id {{serial}},
+  user_id INT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX authz_changes_created ON authz_changes (created_at);
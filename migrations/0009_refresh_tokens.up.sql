@@ -0,0 +1,16 @@
+CREATE TABLE refresh_tokens (
+  id {{serial}},
+  user_id INT NOT NULL,
+  tenant_id INT NULL,
+  family_id VARCHAR(64) NOT NULL,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP NULL,
+  revoked_at TIMESTAMP NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX refresh_tokens_family ON refresh_tokens (family_id);
+
+CREATE INDEX refresh_tokens_expires ON refresh_tokens (expires_at);
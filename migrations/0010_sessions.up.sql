@@ -0,0 +1,15 @@
+CREATE TABLE sessions (
+  id {{serial}},
+  user_id INT NOT NULL,
+  tenant_id INT NULL,
+  family_id VARCHAR(64) NOT NULL UNIQUE,
+  user_agent VARCHAR(255) NULL,
+  ip VARCHAR(64) NULL,
+  created_at TIMESTAMP NOT NULL,
+  last_used_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP NULL,
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX sessions_user ON sessions (user_id);
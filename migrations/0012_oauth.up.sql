@@ -0,0 +1,22 @@
+CREATE TABLE oauth_clients (
+  id {{serial}},
+  client_id VARCHAR(64) NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL,
+  secret_hash VARCHAR(255) NULL,
+  redirect_uris TEXT NOT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE oauth_codes (
+  id {{serial}},
+  code_hash VARCHAR(64) NOT NULL UNIQUE,
+  client_id VARCHAR(64) NOT NULL,
+  user_id INT NOT NULL,
+  redirect_uri TEXT NOT NULL,
+  scope VARCHAR(255) NOT NULL,
+  nonce VARCHAR(255) NULL,
+  code_challenge VARCHAR(128) NOT NULL,
+  auth_time TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE sso_states;
+
+DROP TABLE user_identities;
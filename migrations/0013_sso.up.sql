@@ -0,0 +1,19 @@
+CREATE TABLE user_identities (
+  id {{serial}},
+  user_id INT NOT NULL,
+  provider VARCHAR(64) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (provider, subject),
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE sso_states (
+  id {{serial}},
+  state_hash VARCHAR(64) NOT NULL UNIQUE,
+  provider VARCHAR(64) NOT NULL,
+  nonce VARCHAR(64) NOT NULL,
+  code_verifier VARCHAR(128) NOT NULL,
+  tenant_id INT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
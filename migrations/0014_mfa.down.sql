@@ -0,0 +1,7 @@
+DROP TABLE mfa_challenges;
+
+DROP TABLE recovery_codes;
+
+DROP TABLE user_totp;
+
+ALTER TABLE roles DROP COLUMN require_mfa;
@@ -0,0 +1,28 @@
+ALTER TABLE roles ADD COLUMN require_mfa BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE user_totp (
+  user_id INT NOT NULL PRIMARY KEY,
+  secret VARCHAR(64) NOT NULL,
+  confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+  last_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE recovery_codes (
+  id {{serial}},
+  user_id INT NOT NULL,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMP NULL,
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE mfa_challenges (
+  id {{serial}},
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  user_id INT NOT NULL,
+  tenant_id INT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
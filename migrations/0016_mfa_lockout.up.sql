@@ -0,0 +1,10 @@
+CREATE TABLE mfa_lockouts (
+  user_id INT NOT NULL PRIMARY KEY,
+  attempts INT NOT NULL DEFAULT 0,
+  locked_until TIMESTAMP NULL,
+  FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+-- Recovery codes are now stored as bcrypt hashes; the earlier unsalted
+-- ones no longer match, so users generate new codes.
+DELETE FROM recovery_codes;
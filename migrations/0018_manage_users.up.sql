@@ -0,0 +1,13 @@
+INSERT INTO permissions (name)
+SELECT seed.name FROM (
+  SELECT 'manage_users' AS name
+) seed
+WHERE NOT EXISTS (SELECT 1 FROM permissions p WHERE p.name = seed.name);
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND r.tenant_id IS NULL
+  AND p.name = 'manage_users'
+  AND NOT EXISTS (
+    SELECT 1 FROM role_permissions rp WHERE rp.role_id = r.id AND rp.permission_id = p.id
+  );
@@ -0,0 +1,3 @@
+DELETE FROM role_permissions
+WHERE role_id IN (SELECT id FROM roles WHERE name = 'admin' AND tenant_id IS NULL)
+  AND permission_id IN (SELECT id FROM permissions WHERE name = 'manage_clients');
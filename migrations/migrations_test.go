@@ -0,0 +1,162 @@
+package migrations
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"rbac/store"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestStatements(t *testing.T) {
+	script := `-- the users table
+CREATE TABLE users (
+  id {{serial}},
+  name VARCHAR(50) NOT NULL
+);
+
+INSERT INTO users (name) VALUES ('admin');
+DROP TABLE legacy`
+
+	for dialect, serial := range serialColumn {
+		m := &Migrator{dialect: dialect}
+		want := []string{
+			"CREATE TABLE users (\n  id " + serial + ",\n  name VARCHAR(50) NOT NULL\n)",
+			"INSERT INTO users (name) VALUES ('admin')",
+			"DROP TABLE legacy",
+		}
+		if got := m.statements(script); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: statements = %q, want %q", dialect, got, want)
+		}
+	}
+}
+
+func TestLoadDialectOverrides(t *testing.T) {
+	tests := []struct {
+		dialect  store.Dialect
+		wantUp   string
+		wantDown string
+	}{
+		{store.MySQL, "0004_tenants.up.mysql.sql", "0004_tenants.down.mysql.sql"},
+		{store.SQLite, "0004_tenants.up.sqlite.sql", "0004_tenants.down.sqlite.sql"},
+		{store.Postgres, "0004_tenants.up.sql", "0004_tenants.down.sql"},
+	}
+
+	for _, tt := range tests {
+		migrations, err := load(tt.dialect)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.dialect, err)
+		}
+		for i, m := range migrations {
+			if i > 0 && m.Version <= migrations[i-1].Version {
+				t.Errorf("%s: migration %d follows %d", tt.dialect, m.Version, migrations[i-1].Version)
+			}
+		}
+
+		var tenants *Migration
+		for i := range migrations {
+			if migrations[i].Version == 4 {
+				tenants = &migrations[i]
+			}
+		}
+		if tenants == nil {
+			t.Fatalf("%s: migration 4 not loaded", tt.dialect)
+		}
+		if up := readFile(t, tt.wantUp); tenants.up != up {
+			t.Errorf("%s: up script is not %s", tt.dialect, tt.wantUp)
+		}
+		if down := readFile(t, tt.wantDown); tenants.down != down {
+			t.Errorf("%s: down script is not %s", tt.dialect, tt.wantDown)
+		}
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	content, err := files.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestMigratorSQLite(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "rbac.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open(store.SQLite.DriverName(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m, err := NewMigrator(db, store.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := len(m.migrations)
+
+	assertApplied := func(want int) {
+		t.Helper()
+		statuses, err := m.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(statuses) != total {
+			t.Fatalf("%d statuses, want %d", len(statuses), total)
+		}
+		for i, status := range statuses {
+			if applied := status.AppliedAt != nil; applied != (i < want) {
+				t.Errorf("migration %d_%s applied: %v, want %v", status.Version, status.Name, applied, i < want)
+			}
+		}
+	}
+
+	assertApplied(0)
+	done, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != total {
+		t.Fatalf("Up applied %d migrations, want %d", len(done), total)
+	}
+	assertApplied(total)
+
+	done, err = m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 0 {
+		t.Errorf("second Up applied %d migrations", len(done))
+	}
+
+	last := m.migrations[total-1]
+	rolledBack, err := m.Down()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack == nil || rolledBack.Version != last.Version {
+		t.Fatalf("Down rolled back %v, want %d", rolledBack, last.Version)
+	}
+	assertApplied(total - 1)
+
+	for i := total - 1; i > 0; i-- {
+		if _, err := m.Down(); err != nil {
+			t.Fatalf("rolling back to %d: %v", i-1, err)
+		}
+	}
+	assertApplied(0)
+	if _, err := db.Exec("SELECT 1 FROM users"); err == nil {
+		t.Error("users table left after rolling everything back")
+	}
+	rolledBack, err = m.Down()
+	if err != nil || rolledBack != nil {
+		t.Errorf("Down with nothing applied = %v, %v; want nil, nil", rolledBack, err)
+	}
+
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("reapplying: %v", err)
+	}
+	assertApplied(total)
+}
@@ -0,0 +1,317 @@
+// Package sso signs users in through external OpenID Connect identity
+// providers with the authorization code flow and PKCE.
+package sso
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"rbac/config"
+	"rbac/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyRefreshInterval limits how often the provider's keys are fetched
+// again for a token signed with an unknown key.
+const keyRefreshInterval = time.Minute
+
+// Provider is an identity provider. Its discovery document and keys are
+// fetched when first needed.
+type Provider struct {
+	config.ProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        map[string]*utils.SigningKey
+	keysFetched time.Time
+}
+
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Claims are the claims of a verified ID token.
+type Claims map[string]interface{}
+
+func NewProvider(providerConfig config.ProviderConfig) *Provider {
+	return &Provider{ProviderConfig: providerConfig, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// AuthCodeURL returns where to send the user to sign in. The code
+// challenge is derived from verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURI)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", utils.EncodeBase64(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the ID
+// token, once its signature, issuer, audience, expiry and nonce check out.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURI},
+		"code_verifier": {verifier},
+	}
+	// client_secret_basic is the default when the provider names none.
+	basic := p.ClientSecret != "" && (len(md.TokenAuthMethods) == 0 || slices.Contains(md.TokenAuthMethods, "client_secret_basic"))
+	if !basic {
+		form.Set("client_id", p.ClientID)
+		if p.ClientSecret != "" {
+			form.Set("client_secret", p.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var response struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.do(req, &response); err != nil {
+		if response.Error != "" {
+			return nil, fmt.Errorf("token endpoint: %s %s", response.Error, response.ErrorDescription)
+		}
+		return nil, err
+	}
+	if response.IDToken == "" {
+		return nil, errors.New("token response has no ID token")
+	}
+
+	return p.verify(ctx, response.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (Claims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		return key.VerifyWith(token.Method)
+	},
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("invalid ID token: nonce does not match")
+	}
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.ClientID {
+			return nil, errors.New("invalid ID token: not issued to this client")
+		}
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("invalid ID token: no subject")
+	}
+	return Claims(claims), nil
+}
+
+// key returns the provider's key kid, fetching the keys again if it is
+// unknown. A token without kid matches a provider's only key.
+func (p *Provider) key(ctx context.Context, kid string) (*utils.SigningKey, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.lookupKey(kid) == nil && time.Since(p.keysFetched) >= keyRefreshInterval {
+		var set struct {
+			Keys []json.RawMessage `json:"keys"`
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, md.JWKSURI, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.do(req, &set); err != nil {
+			return nil, fmt.Errorf("fetching keys: %w", err)
+		}
+
+		// Keys of unsupported types, or meant for encryption, are skipped.
+		keys := make(map[string]*utils.SigningKey)
+		for _, raw := range set.Keys {
+			var jwk utils.JWK
+			if err := json.Unmarshal(raw, &jwk); err != nil || (jwk.Use != "" && jwk.Use != "sig") {
+				continue
+			}
+			if key, err := utils.ParseJWK(jwk); err == nil {
+				keys[key.ID] = key
+			}
+		}
+		p.keys, p.keysFetched = keys, time.Now()
+	}
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a fetched key; p.mu must be held.
+func (p *Provider) lookupKey(kid string) *utils.SigningKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var md metadata
+	if err := p.do(req, &md); err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", p.Issuer, err)
+	}
+	if md.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovering %s: document is for issuer %q", p.Issuer, md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s: endpoints missing", p.Issuer)
+	}
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// do sends req and decodes the JSON response into v, which is also filled
+// in from an error response.
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(body, v)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Redacted(), resp.Status)
+	}
+	return decodeErr
+}
+
+// Subject returns the user's ID at the provider.
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// String returns the claim at path, a dotted path into nested objects, if
+// it is a string.
+func (c Claims) String(path string) string {
+	value, _ := c.lookup(path).(string)
+	return value
+}
+
+// MapRoles returns the roles the mappings grant, in mapping order, and
+// every role the mappings can grant at all.
+func (c Claims) MapRoles(mappings []config.RoleMapping) (granted, managed []string) {
+	for _, mapping := range mappings {
+		if !slices.Contains(managed, mapping.Role) {
+			managed = append(managed, mapping.Role)
+		}
+		if c.has(mapping.Claim, mapping.Value) && !slices.Contains(granted, mapping.Role) {
+			granted = append(granted, mapping.Role)
+		}
+	}
+	return granted, managed
+}
+
+func (c Claims) has(path, value string) bool {
+	switch claim := c.lookup(path).(type) {
+	case string:
+		return claim == value
+	case []interface{}:
+		for _, item := range claim {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c Claims) lookup(path string) interface{} {
+	var value interface{} = map[string]interface{}(c)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
@@ -0,0 +1,258 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"rbac/config"
+	"rbac/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdP is an identity provider whose token endpoint answers the code
+// "code" with idToken.
+type testIdP struct {
+	*httptest.Server
+	key     *utils.SigningKey
+	idToken string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, _, err := utils.GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(metadata{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JWKSURI:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(utils.NewKeyring(key).JWKS())
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, _ := r.BasicAuth()
+		if clientID != "rbac" || secret != "rbac-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idp.idToken})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// sign signs claims with key, naming it in the kid header.
+func sign(t *testing.T, key *utils.SigningKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// claims changes the claims of a valid ID token.
+		claims func(claims jwt.MapClaims)
+		// token signs the claims; the IdP's key signs them if nil.
+		token   func(t *testing.T, idp *testIdP, claims jwt.MapClaims) string
+		wantErr string
+	}{
+		{name: "valid", claims: func(jwt.MapClaims) {}},
+		{
+			name:    "other issuer",
+			claims:  func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+			wantErr: "iss",
+		},
+		{
+			name:    "no issuer",
+			claims:  func(claims jwt.MapClaims) { delete(claims, "iss") },
+			wantErr: "iss",
+		},
+		{
+			name:    "other audience",
+			claims:  func(claims jwt.MapClaims) { claims["aud"] = "other" },
+			wantErr: "aud",
+		},
+		{
+			name:    "no audience",
+			claims:  func(claims jwt.MapClaims) { delete(claims, "aud") },
+			wantErr: "aud",
+		},
+		{
+			name: "several audiences, authorized party",
+			claims: func(claims jwt.MapClaims) {
+				claims["aud"] = []string{"other", "rbac"}
+				claims["azp"] = "rbac"
+			},
+		},
+		{
+			name:    "several audiences, no authorized party",
+			claims:  func(claims jwt.MapClaims) { claims["aud"] = []string{"other", "rbac"} },
+			wantErr: "not issued to this client",
+		},
+		{
+			name: "several audiences, other authorized party",
+			claims: func(claims jwt.MapClaims) {
+				claims["aud"] = []string{"other", "rbac"}
+				claims["azp"] = "other"
+			},
+			wantErr: "not issued to this client",
+		},
+		{
+			name:    "other nonce",
+			claims:  func(claims jwt.MapClaims) { claims["nonce"] = "replayed" },
+			wantErr: "nonce",
+		},
+		{
+			name:    "no nonce",
+			claims:  func(claims jwt.MapClaims) { delete(claims, "nonce") },
+			wantErr: "nonce",
+		},
+		{
+			name:    "expired",
+			claims:  func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+			wantErr: "expired",
+		},
+		{
+			name:   "expired within leeway",
+			claims: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-30 * time.Second).Unix() },
+		},
+		{
+			name:    "no expiry",
+			claims:  func(claims jwt.MapClaims) { delete(claims, "exp") },
+			wantErr: "exp",
+		},
+		{
+			name:    "issued in the future",
+			claims:  func(claims jwt.MapClaims) { claims["iat"] = time.Now().Add(time.Hour).Unix() },
+			wantErr: "used before issued",
+		},
+		{
+			name:    "no subject",
+			claims:  func(claims jwt.MapClaims) { delete(claims, "sub") },
+			wantErr: "no subject",
+		},
+		{
+			name:   "signed by another key",
+			claims: func(jwt.MapClaims) {},
+			token: func(t *testing.T, idp *testIdP, claims jwt.MapClaims) string {
+				other, _, err := utils.GenerateSigningKey("ES256")
+				if err != nil {
+					t.Fatal(err)
+				}
+				other.ID = idp.key.ID
+				return sign(t, other, claims)
+			},
+			wantErr: "signature",
+		},
+		{
+			name:   "unknown key",
+			claims: func(jwt.MapClaims) {},
+			token: func(t *testing.T, idp *testIdP, claims jwt.MapClaims) string {
+				other, _, err := utils.GenerateSigningKey("ES256")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return sign(t, other, claims)
+			},
+			wantErr: "unknown signing key",
+		},
+		{
+			name:   "tampered claims",
+			claims: func(jwt.MapClaims) {},
+			token: func(t *testing.T, idp *testIdP, claims jwt.MapClaims) string {
+				parts := strings.Split(sign(t, idp.key, claims), ".")
+				claims["sub"] = "admin"
+				payload, err := json.Marshal(claims)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parts[1] = utils.EncodeBase64(payload)
+				return strings.Join(parts, ".")
+			},
+			wantErr: "signature",
+		},
+		{
+			name:   "unsigned",
+			claims: func(jwt.MapClaims) {},
+			token: func(t *testing.T, idp *testIdP, claims jwt.MapClaims) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+				token.Header["kid"] = idp.key.ID
+				signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			wantErr: "signing method",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			now := time.Now()
+			claims := jwt.MapClaims{
+				"iss":   idp.URL,
+				"sub":   "user-1",
+				"aud":   "rbac",
+				"exp":   now.Add(5 * time.Minute).Unix(),
+				"iat":   now.Unix(),
+				"nonce": "nonce",
+			}
+			tt.claims(claims)
+			if tt.token != nil {
+				idp.idToken = tt.token(t, idp, claims)
+			} else {
+				idp.idToken = sign(t, idp.key, claims)
+			}
+
+			provider := NewProvider(config.ProviderConfig{
+				Name:         "test",
+				Issuer:       idp.URL,
+				ClientID:     "rbac",
+				ClientSecret: "rbac-secret",
+				RedirectURI:  "https://rbac.example.com/api/sso/test/callback",
+			})
+			got, err := provider.Exchange(context.Background(), "code", "verifier", "nonce")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Exchange = %v, %v; want error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if got.Subject() != "user-1" {
+				t.Errorf("subject %q, want user-1", got.Subject())
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+func ParseDialect(driver string) (Dialect, error) {
+	switch Dialect(strings.ToLower(driver)) {
+	case "", MySQL:
+		return MySQL, nil
+	case Postgres, "postgresql":
+		return Postgres, nil
+	case SQLite, "sqlite3":
+		return SQLite, nil
+	}
+	return "", fmt.Errorf("unsupported database driver: %s", driver)
+}
+
+// DriverName is the name the dialect's database/sql driver registers under.
+func (d Dialect) DriverName() string {
+	return string(d)
+}
+
+// Rebind rewrites the ? placeholders and `quoted` identifiers used
+// throughout the store into the dialect's native form ($1, $2, ... and
+// "quoted" for PostgreSQL).
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		switch r {
+		case '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		case '`':
+			b.WriteByte('"')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// SupportsReturning reports whether inserted IDs are read back with
+// RETURNING id instead of sql.Result.LastInsertId.
+func (d Dialect) SupportsReturning() bool {
+	return d == Postgres
+}
+
+// OnConflictUpdate returns the clause that makes an INSERT apply set to the
+// row already holding the inserted key instead of failing, so concurrent
+// writers of the same key cannot race between an UPDATE and an INSERT.
+func (d Dialect) OnConflictUpdate(key, set string) string {
+	if d == MySQL {
+		return " ON DUPLICATE KEY UPDATE " + set
+	}
+	return " ON CONFLICT (" + key + ") DO UPDATE SET " + set
+}
@@ -0,0 +1,61 @@
+package store
+
+import "testing"
+
+func TestParseDialect(t *testing.T) {
+	tests := []struct {
+		driver  string
+		want    Dialect
+		wantErr bool
+	}{
+		{driver: "", want: MySQL},
+		{driver: "mysql", want: MySQL},
+		{driver: "postgres", want: Postgres},
+		{driver: "PostgreSQL", want: Postgres},
+		{driver: "sqlite", want: SQLite},
+		{driver: "sqlite3", want: SQLite},
+		{driver: "oracle", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDialect(tt.driver)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDialect(%q) = %q, %v; want %q, error %v", tt.driver, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT `key` FROM t WHERE a = ? AND b IN (?, ?)"
+	tests := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{MySQL, query},
+		{SQLite, query},
+		{Postgres, `SELECT "key" FROM t WHERE a = $1 AND b IN ($2, $3)`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.dialect.Rebind(query); got != tt.want {
+			t.Errorf("%s: Rebind = %q, want %q", tt.dialect, got, tt.want)
+		}
+	}
+}
+
+func TestOnConflictUpdate(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{MySQL, " ON DUPLICATE KEY UPDATE n = t.n + 1"},
+		{SQLite, " ON CONFLICT (id) DO UPDATE SET n = t.n + 1"},
+		{Postgres, " ON CONFLICT (id) DO UPDATE SET n = t.n + 1"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.dialect.OnConflictUpdate("id", "n = t.n + 1"); got != tt.want {
+			t.Errorf("%s: OnConflictUpdate = %q, want %q", tt.dialect, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package store
+
+// createsCycle reports whether giving roleID the parents would make it
+// inherit from itself. edges maps a role ID to the IDs of its parents.
+func createsCycle(edges map[int][]int, roleID int, parents []int) bool {
+	seen := make(map[int]bool)
+	stack := append([]int(nil), parents...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == roleID {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		stack = append(stack, edges[id]...)
+	}
+	return false
+}
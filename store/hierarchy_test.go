@@ -0,0 +1,32 @@
+package store
+
+import "testing"
+
+func TestCreatesCycle(t *testing.T) {
+	// 1 inherits from 2, which inherits from 3; 4 stands alone.
+	edges := map[int][]int{1: {2}, 2: {3}}
+
+	tests := []struct {
+		name    string
+		roleID  int
+		parents []int
+		want    bool
+	}{
+		{"no parents", 1, nil, false},
+		{"self parent", 4, []int{4}, true},
+		{"new parent", 3, []int{4}, false},
+		{"direct cycle", 3, []int{2}, true},
+		{"indirect cycle", 3, []int{1}, true},
+		{"cycle among several parents", 3, []int{4, 1}, true},
+		{"shared ancestor", 4, []int{1, 2}, false},
+		{"replacing existing parents", 2, []int{4}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := createsCycle(edges, tt.roleID, tt.parents); got != tt.want {
+				t.Errorf("createsCycle(%d, %v) = %v, want %v", tt.roleID, tt.parents, got, tt.want)
+			}
+		})
+	}
+}
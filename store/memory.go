@@ -0,0 +1,263 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	apperrors "rbac/errors"
+)
+
+var _ Store = (*MemoryStore)(nil)
+
+type MemoryStore struct {
+	mu          sync.RWMutex
+	nextID      int
+	users       map[int]*memoryUser
+	roles       map[int]*memoryRole
+	permissions map[int]string
+	groups      map[int]*memoryGroup
+	tenants     map[int]string
+	bindings    map[int]ResourceBinding
+	changes     []memoryChange
+
+	refreshTokens map[int]*RefreshToken
+	sessions      map[int]*Session
+
+	clients map[int]OAuthClient
+	codes   map[string]AuthorizationCode
+
+	identities  map[int]Identity
+	loginStates map[string]LoginState
+
+	totps         map[int]TOTP
+	recoveryCodes map[int]map[int]*memoryRecoveryCode
+	challenges    map[string]MFAChallenge
+	mfaLockouts   map[int]MFALockout
+}
+
+type memoryUser struct {
+	username             string
+	password             string
+	disabled             bool
+	attributes           map[string]string
+	roleIDs              []int
+	roleConditions       map[int]string
+	tenantRoleIDs        map[int][]int
+	tenantRoleConditions map[int]map[int]string
+}
+
+type memoryRole struct {
+	name                 string
+	tenantID             int
+	permissionIDs        []int
+	deniedPermissionIDs  []int
+	permissionConditions map[int]string
+	parentIDs            []int
+	requireMFA           bool
+}
+
+type memoryRecoveryCode struct {
+	codeHash string
+	used     bool
+}
+
+type memoryGroup struct {
+	name      string
+	roleIDs   []int
+	memberIDs []int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:       make(map[int]*memoryUser),
+		roles:       make(map[int]*memoryRole),
+		permissions: make(map[int]string),
+		groups:      make(map[int]*memoryGroup),
+		tenants:     make(map[int]string),
+		bindings:    make(map[int]ResourceBinding),
+
+		refreshTokens: make(map[int]*RefreshToken),
+		sessions:      make(map[int]*Session),
+
+		clients: make(map[int]OAuthClient),
+		codes:   make(map[string]AuthorizationCode),
+
+		identities:  make(map[int]Identity),
+		loginStates: make(map[string]LoginState),
+
+		totps:         make(map[int]TOTP),
+		recoveryCodes: make(map[int]map[int]*memoryRecoveryCode),
+		challenges:    make(map[string]MFAChallenge),
+		mfaLockouts:   make(map[int]MFALockout),
+	}
+}
+
+func (s *MemoryStore) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+func sortedIDs[T any](m map[int]T) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func containsID(ids []int, id int) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
+
+func removeID(ids []int, id int) []int {
+	kept := ids[:0]
+	for _, existing := range ids {
+		if existing != id {
+			kept = append(kept, existing)
+		}
+	}
+	return kept
+}
+
+// roleID finds a role by name among the tenant's roles and then the global
+// ones, mirroring lookupRoleID.
+func (s *MemoryStore) roleID(name string, tenantID int) (int, bool) {
+	globalID, global := 0, false
+	for id, role := range s.roles {
+		if role.name != name {
+			continue
+		}
+		if tenantID != 0 && role.tenantID == tenantID {
+			return id, true
+		}
+		if role.tenantID == 0 {
+			globalID, global = id, true
+		}
+	}
+	return globalID, global
+}
+
+func (s *MemoryStore) roleNameTaken(name string, tenantID, exceptID int) bool {
+	for id, role := range s.roles {
+		if id != exceptID && role.name == name && role.tenantID == tenantID {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTenantRoles resolves names among the tenant's own roles only,
+// mirroring lookupTenantRoleID.
+func (s *MemoryStore) resolveTenantRoles(names []string, tenantID int) ([]int, error) {
+	ids := make([]int, 0, len(names))
+	for _, name := range names {
+		id, ok := 0, false
+		for roleID, role := range s.roles {
+			if role.name == name && role.tenantID == tenantID {
+				id, ok = roleID, true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", apperrors.ErrInvalidRole, name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) permissionID(name string) (int, bool) {
+	for id, perm := range s.permissions {
+		if perm == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (s *MemoryStore) resolveRoles(names []string, tenantID int) ([]int, error) {
+	ids := make([]int, 0, len(names))
+	for _, name := range names {
+		id, ok := s.roleID(name, tenantID)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", apperrors.ErrInvalidRole, name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) resolvePermissions(names []string) ([]int, error) {
+	ids := make([]int, 0, len(names))
+	for _, name := range names {
+		id, ok := s.permissionID(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", apperrors.ErrInvalidPermission, name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// conditionsByID re-keys a name-keyed condition map by the IDs the names
+// resolved to.
+func conditionsByID(names []string, ids []int, conditions map[string]string) map[int]string {
+	byID := make(map[int]string)
+	for i, name := range names {
+		if condition := conditions[name]; condition != "" {
+			byID[ids[i]] = condition
+		}
+	}
+	return byID
+}
+
+// conditionsByName is the inverse of conditionsByID.
+func conditionsByName(byID map[int]string, name func(id int) (string, bool)) map[string]string {
+	conditions := make(map[string]string)
+	for id, condition := range byID {
+		if n, ok := name(id); ok {
+			conditions[n] = condition
+		}
+	}
+	return conditions
+}
+
+func (s *MemoryStore) roleName(id int) (string, bool) {
+	role, ok := s.roles[id]
+	if !ok {
+		return "", false
+	}
+	return role.name, true
+}
+
+func (s *MemoryStore) permissionName(id int) (string, bool) {
+	perm, ok := s.permissions[id]
+	return perm, ok
+}
+
+func (s *MemoryStore) roleNames(ids []int) []string {
+	var names []string
+	for _, id := range ids {
+		if role, ok := s.roles[id]; ok {
+			names = append(names, role.name)
+		}
+	}
+	return names
+}
+
+func (s *MemoryStore) permissionNames(ids []int) []string {
+	var names []string
+	for _, id := range ids {
+		if perm, ok := s.permissions[id]; ok {
+			names = append(names, perm)
+		}
+	}
+	return names
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) GetResourceBindings() ([]ResourceBinding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var bindings []ResourceBinding
+	for _, id := range sortedIDs(s.bindings) {
+		bindings = append(bindings, s.binding(id))
+	}
+	return bindings, nil
+}
+
+func (s *MemoryStore) GetUserResourceBindings(userID int) ([]ResourceBinding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var bindings []ResourceBinding
+	for _, id := range sortedIDs(s.bindings) {
+		if s.bindings[id].UserID == userID {
+			bindings = append(bindings, s.binding(id))
+		}
+	}
+	return bindings, nil
+}
+
+func (s *MemoryStore) CreateResourceBinding(binding ResourceBinding) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[binding.UserID]; !ok {
+		return 0, apperrors.ErrUserNotFound
+	}
+	if binding.TenantID != 0 {
+		if _, ok := s.tenants[binding.TenantID]; !ok {
+			return 0, apperrors.ErrTenantNotFound
+		}
+	}
+
+	roleIDs, err := s.resolveRoles([]string{binding.Role}, binding.TenantID)
+	if err != nil {
+		return 0, err
+	}
+
+	id := s.newID()
+	binding.ID = id
+	binding.RoleID = roleIDs[0]
+	binding.Role = ""
+	s.bindings[id] = binding
+	return id, nil
+}
+
+func (s *MemoryStore) DeleteResourceBinding(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.bindings[id]; !ok {
+		return apperrors.ErrBindingNotFound
+	}
+	delete(s.bindings, id)
+	return nil
+}
+
+func (s *MemoryStore) binding(id int) ResourceBinding {
+	binding := s.bindings[id]
+	binding.Role = s.roles[binding.RoleID].name
+	return binding
+}
+
+// removeBindings drops every binding the predicate matches; it backs the
+// cascades of DeleteUser, DeleteRole and DeleteTenant.
+func (s *MemoryStore) removeBindings(match func(ResourceBinding) bool) {
+	for id, binding := range s.bindings {
+		if match(binding) {
+			delete(s.bindings, id)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package store
+
+import "time"
+
+type memoryChange struct {
+	Change
+	createdAt time.Time
+}
+
+func (s *MemoryStore) RecordChange(userID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.newID()
+	s.changes = append(s.changes, memoryChange{Change: Change{ID: id, UserID: userID}, createdAt: time.Now()})
+	return id, nil
+}
+
+func (s *MemoryStore) GetChangesSince(id int) ([]Change, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var changes []Change
+	for _, change := range s.changes {
+		if change.ID > id {
+			changes = append(changes, change.Change)
+		}
+	}
+	return changes, nil
+}
+
+func (s *MemoryStore) LatestChangeID() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.changes) == 0 {
+		return 0, nil
+	}
+	return s.changes[len(s.changes)-1].ID, nil
+}
+
+func (s *MemoryStore) PruneChanges(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.changes[:0]
+	for _, change := range s.changes {
+		if !change.createdAt.Before(before) {
+			kept = append(kept, change)
+		}
+	}
+	s.changes = kept
+	return nil
+}
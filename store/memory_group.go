@@ -0,0 +1,161 @@
+package store
+
+import (
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) GetGroups() ([]Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var groups []Group
+	for _, id := range sortedIDs(s.groups) {
+		groups = append(groups, *s.group(id))
+	}
+	return groups, nil
+}
+
+func (s *MemoryStore) GetGroup(id int) (*Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.groups[id]; !ok {
+		return nil, apperrors.ErrGroupNotFound
+	}
+	return s.group(id), nil
+}
+
+func (s *MemoryStore) CreateGroup(group Group) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.groupID(group.Name); ok {
+		return 0, apperrors.ErrDuplicateGroup
+	}
+
+	roleIDs, err := s.resolveRoles(group.Roles, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	id := s.newID()
+	s.groups[id] = &memoryGroup{name: group.Name, roleIDs: roleIDs}
+	return id, nil
+}
+
+func (s *MemoryStore) UpdateGroup(group Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.groups[group.ID]
+	if !ok {
+		return apperrors.ErrGroupNotFound
+	}
+	if otherID, taken := s.groupID(group.Name); taken && otherID != group.ID {
+		return apperrors.ErrDuplicateGroup
+	}
+
+	if group.Roles != nil {
+		roleIDs, err := s.resolveRoles(group.Roles, 0)
+		if err != nil {
+			return err
+		}
+		existing.roleIDs = roleIDs
+	}
+	existing.name = group.Name
+	return nil
+}
+
+func (s *MemoryStore) DeleteGroup(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.groups[id]; !ok {
+		return apperrors.ErrGroupNotFound
+	}
+	delete(s.groups, id)
+	return nil
+}
+
+func (s *MemoryStore) GetGroupMembers(id int) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	group, ok := s.groups[id]
+	if !ok {
+		return nil, apperrors.ErrGroupNotFound
+	}
+
+	var users []User
+	for _, userID := range sortedIDs(s.users) {
+		if containsID(group.memberIDs, userID) {
+			users = append(users, User{ID: userID, Username: s.users[userID].username})
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) AddGroupMember(groupID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupID]
+	if !ok {
+		return apperrors.ErrGroupNotFound
+	}
+	if _, ok := s.users[userID]; !ok {
+		return apperrors.ErrUserNotFound
+	}
+
+	if !containsID(group.memberIDs, userID) {
+		group.memberIDs = append(group.memberIDs, userID)
+	}
+	return nil
+}
+
+func (s *MemoryStore) RemoveGroupMember(groupID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupID]
+	if !ok {
+		return apperrors.ErrGroupNotFound
+	}
+	if !containsID(group.memberIDs, userID) {
+		return apperrors.ErrNotGroupMember
+	}
+
+	group.memberIDs = removeID(group.memberIDs, userID)
+	return nil
+}
+
+func (s *MemoryStore) GetUserGroups(userID int) ([]Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var groups []Group
+	for _, id := range sortedIDs(s.groups) {
+		if containsID(s.groups[id].memberIDs, userID) {
+			groups = append(groups, *s.group(id))
+		}
+	}
+	return groups, nil
+}
+
+func (s *MemoryStore) groupID(name string) (int, bool) {
+	for id, group := range s.groups {
+		if group.name == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (s *MemoryStore) group(id int) *Group {
+	group := s.groups[id]
+	return &Group{
+		ID:    id,
+		Name:  group.name,
+		Roles: s.roleNames(group.roleIDs),
+	}
+}
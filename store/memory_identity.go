@@ -0,0 +1,72 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) GetIdentity(provider, subject string) (*Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, identity := range s.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, apperrors.ErrIdentityNotFound
+}
+
+func (s *MemoryStore) CreateIdentityUser(user User, identity Identity) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return 0, fmt.Errorf("identity %s/%s is already linked", identity.Provider, identity.Subject)
+		}
+	}
+
+	userID, err := s.createUser(user)
+	if err != nil {
+		return 0, err
+	}
+	identity.ID = s.newID()
+	identity.UserID = userID
+	s.identities[identity.ID] = identity
+	return userID, nil
+}
+
+func (s *MemoryStore) CreateLoginState(state LoginState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loginStates[state.StateHash] = state
+	return nil
+}
+
+func (s *MemoryStore) UseLoginState(stateHash string) (*LoginState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.loginStates[stateHash]
+	if !ok {
+		return nil, apperrors.ErrLoginStateNotFound
+	}
+	delete(s.loginStates, stateHash)
+	return &state, nil
+}
+
+func (s *MemoryStore) DeleteExpiredLoginStates(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for stateHash, state := range s.loginStates {
+		if state.ExpiresAt.Before(before) {
+			delete(s.loginStates, stateHash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) GetTOTP(userID int) (*TOTP, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	totp, ok := s.totps[userID]
+	if !ok {
+		return nil, apperrors.ErrTOTPNotFound
+	}
+	return &totp, nil
+}
+
+func (s *MemoryStore) CreateTOTP(totp TOTP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[totp.UserID]; !ok {
+		return apperrors.ErrUserNotFound
+	}
+	s.totps[totp.UserID] = totp
+	return nil
+}
+
+func (s *MemoryStore) ConfirmTOTP(userID int, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[userID]
+	if !ok {
+		return apperrors.ErrTOTPNotFound
+	}
+	totp.Confirmed = true
+	s.totps[userID] = totp
+	s.replaceRecoveryCodes(userID, recoveryCodeHashes)
+	return nil
+}
+
+func (s *MemoryStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[userID]
+	if !ok || totp.LastStep >= step {
+		return false, nil
+	}
+	totp.LastStep = step
+	s.totps[userID] = totp
+	return true, nil
+}
+
+func (s *MemoryStore) DeleteTOTP(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.totps[userID]; !ok {
+		return apperrors.ErrTOTPNotFound
+	}
+	delete(s.totps, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
+
+func (s *MemoryStore) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// replaceRecoveryCodes keeps the codes as unused; s.mu must be held.
+func (s *MemoryStore) replaceRecoveryCodes(userID int, codeHashes []string) {
+	codes := make(map[int]*memoryRecoveryCode, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		codes[s.newID()] = &memoryRecoveryCode{codeHash: codeHash}
+	}
+	s.recoveryCodes[userID] = codes
+}
+
+func (s *MemoryStore) GetRecoveryCodes(userID int) ([]RecoveryCode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	codes := s.recoveryCodes[userID]
+	var unused []RecoveryCode
+	for _, id := range sortedIDs(codes) {
+		if !codes[id].used {
+			unused = append(unused, RecoveryCode{ID: id, UserID: userID, CodeHash: codes[id].codeHash})
+		}
+	}
+	return unused, nil
+}
+
+func (s *MemoryStore) UseRecoveryCode(userID, id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.recoveryCodes[userID][id]
+	if !ok || code.used {
+		return false, nil
+	}
+	code.used = true
+	return true, nil
+}
+
+func (s *MemoryStore) CountRecoveryCodes(userID int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, code := range s.recoveryCodes[userID] {
+		if !code.used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) GetMFALockout(userID int) (*MFALockout, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lockout := s.mfaLockouts[userID]
+	lockout.UserID = userID
+	return &lockout, nil
+}
+
+func (s *MemoryStore) AddMFAAttempt(userID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lockout := s.mfaLockouts[userID]
+	lockout.UserID = userID
+	lockout.Attempts++
+	s.mfaLockouts[userID] = lockout
+	return lockout.Attempts, nil
+}
+
+func (s *MemoryStore) LockMFA(userID int, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lockout, ok := s.mfaLockouts[userID]; ok {
+		lockout.Attempts = 0
+		lockout.LockedUntil = until
+		s.mfaLockouts[userID] = lockout
+	}
+	return nil
+}
+
+func (s *MemoryStore) ResetMFAAttempts(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.mfaLockouts, userID)
+	return nil
+}
+
+func (s *MemoryStore) CreateMFAChallenge(challenge MFAChallenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.challenges[challenge.TokenHash] = challenge
+	return nil
+}
+
+func (s *MemoryStore) GetMFAChallenge(tokenHash string) (*MFAChallenge, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	challenge, ok := s.challenges[tokenHash]
+	if !ok {
+		return nil, apperrors.ErrChallengeNotFound
+	}
+	return &challenge, nil
+}
+
+func (s *MemoryStore) FailMFAChallenge(tokenHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	challenge, ok := s.challenges[tokenHash]
+	if !ok {
+		return 0, apperrors.ErrChallengeNotFound
+	}
+	challenge.Attempts++
+	s.challenges[tokenHash] = challenge
+	return challenge.Attempts, nil
+}
+
+func (s *MemoryStore) DeleteMFAChallenge(tokenHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.challenges[tokenHash]
+	delete(s.challenges, tokenHash)
+	return ok, nil
+}
+
+func (s *MemoryStore) DeleteExpiredMFAChallenges(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, challenge := range s.challenges {
+		if challenge.ExpiresAt.Before(before) {
+			delete(s.challenges, tokenHash)
+		}
+	}
+	return nil
+}
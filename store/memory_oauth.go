@@ -0,0 +1,97 @@
+package store
+
+import (
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) GetOAuthClients() ([]OAuthClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var clients []OAuthClient
+	for _, id := range sortedIDs(s.clients) {
+		clients = append(clients, copyClient(s.clients[id]))
+	}
+	return clients, nil
+}
+
+func (s *MemoryStore) GetOAuthClient(clientID string) (*OAuthClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, client := range s.clients {
+		if client.ClientID == clientID {
+			found := copyClient(client)
+			return &found, nil
+		}
+	}
+	return nil, apperrors.ErrClientNotFound
+}
+
+func (s *MemoryStore) CreateOAuthClient(client OAuthClient) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client.ID = s.newID()
+	s.clients[client.ID] = copyClient(client)
+	return client.ID, nil
+}
+
+func (s *MemoryStore) DeleteOAuthClient(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[id]
+	if !ok {
+		return apperrors.ErrClientNotFound
+	}
+	for codeHash, code := range s.codes {
+		if code.ClientID == client.ClientID {
+			delete(s.codes, codeHash)
+		}
+	}
+	delete(s.clients, id)
+	return nil
+}
+
+func (s *MemoryStore) CreateAuthorizationCode(code AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[code.UserID]; !ok {
+		return apperrors.ErrUserNotFound
+	}
+	s.codes[code.CodeHash] = code
+	return nil
+}
+
+func (s *MemoryStore) UseAuthorizationCode(codeHash string) (*AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[codeHash]
+	if !ok {
+		return nil, apperrors.ErrCodeNotFound
+	}
+	delete(s.codes, codeHash)
+	return &code, nil
+}
+
+func (s *MemoryStore) DeleteExpiredAuthorizationCodes(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for codeHash, code := range s.codes {
+		if code.ExpiresAt.Before(before) {
+			delete(s.codes, codeHash)
+		}
+	}
+	return nil
+}
+
+func copyClient(client OAuthClient) OAuthClient {
+	client.RedirectURIs = append([]string(nil), client.RedirectURIs...)
+	return client
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) GetPermissions() ([]Permission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var permissions []Permission
+	for _, id := range sortedIDs(s.permissions) {
+		permissions = append(permissions, Permission{ID: id, Name: s.permissions[id]})
+	}
+	return permissions, nil
+}
+
+func (s *MemoryStore) GetPermission(id int) (*Permission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name, ok := s.permissions[id]
+	if !ok {
+		return nil, apperrors.ErrPermissionNotFound
+	}
+	return &Permission{ID: id, Name: name}, nil
+}
+
+func (s *MemoryStore) GetPermissionRoles(id int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.permissionRoles(id), nil
+}
+
+func (s *MemoryStore) CreatePermission(name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.permissionID(name); ok {
+		return 0, apperrors.ErrDuplicatePermission
+	}
+
+	id := s.newID()
+	s.permissions[id] = name
+	return id, nil
+}
+
+func (s *MemoryStore) UpdatePermission(id int, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.permissions[id]; !ok {
+		return apperrors.ErrPermissionNotFound
+	}
+	if otherID, taken := s.permissionID(name); taken && otherID != id {
+		return apperrors.ErrDuplicatePermission
+	}
+
+	s.permissions[id] = name
+	return nil
+}
+
+func (s *MemoryStore) DeletePermission(id int, cascade bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.permissions[id]; !ok {
+		return apperrors.ErrPermissionNotFound
+	}
+	if len(s.permissionRoles(id)) > 0 && !cascade {
+		return apperrors.ErrPermissionInUse
+	}
+
+	delete(s.permissions, id)
+	for _, role := range s.roles {
+		role.permissionIDs = removeID(role.permissionIDs, id)
+		role.deniedPermissionIDs = removeID(role.deniedPermissionIDs, id)
+		delete(role.permissionConditions, id)
+	}
+	return nil
+}
+
+func (s *MemoryStore) permissionRoles(id int) []string {
+	var roles []string
+	for _, roleID := range sortedIDs(s.roles) {
+		role := s.roles[roleID]
+		for _, permID := range append(append([]int(nil), role.permissionIDs...), role.deniedPermissionIDs...) {
+			if permID == id {
+				roles = append(roles, role.name)
+			}
+		}
+	}
+	return roles
+}
@@ -0,0 +1,287 @@
+package store
+
+import (
+	"fmt"
+
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) GetRoles() ([]Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var roles []Role
+	for _, id := range sortedIDs(s.roles) {
+		roles = append(roles, *s.role(id))
+	}
+	return roles, nil
+}
+
+func (s *MemoryStore) GetRole(id int) (*Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.roles[id]; !ok {
+		return nil, apperrors.ErrRoleNotFound
+	}
+	return s.role(id), nil
+}
+
+func (s *MemoryStore) GetRoleUsers(id int) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.roles[id]; !ok {
+		return nil, apperrors.ErrRoleNotFound
+	}
+
+	var users []User
+	for _, userID := range sortedIDs(s.users) {
+		if containsID(s.users[userID].roleIDs, id) {
+			users = append(users, User{ID: userID, Username: s.users[userID].username})
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) CreateRole(role Role) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createRole(role)
+}
+
+func (s *MemoryStore) CreateRoleWithMembers(role Role, members []int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkMembers(members); err != nil {
+		return 0, err
+	}
+	id, err := s.createRole(role)
+	if err != nil {
+		return 0, err
+	}
+	s.setRoleMembers(id, members)
+	return id, nil
+}
+
+func (s *MemoryStore) createRole(role Role) (int, error) {
+	if role.TenantID != 0 {
+		if _, ok := s.tenants[role.TenantID]; !ok {
+			return 0, apperrors.ErrTenantNotFound
+		}
+	}
+	if s.roleNameTaken(role.Name, role.TenantID, 0) {
+		return 0, apperrors.ErrDuplicateRole
+	}
+
+	permissionIDs, err := s.resolvePermissions(role.Permissions)
+	if err != nil {
+		return 0, err
+	}
+
+	deniedIDs, err := s.resolvePermissions(role.DeniedPermissions)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.checkEffects(permissionIDs, deniedIDs); err != nil {
+		return 0, err
+	}
+
+	conditions := conditionsByID(role.Permissions, permissionIDs, role.PermissionConditions)
+	for id, condition := range conditionsByID(role.DeniedPermissions, deniedIDs, role.PermissionConditions) {
+		conditions[id] = condition
+	}
+
+	parentIDs, err := s.resolveRoles(role.Parents, role.TenantID)
+	if err != nil {
+		return 0, err
+	}
+
+	id := s.newID()
+	s.roles[id] = &memoryRole{
+		name:                 role.Name,
+		tenantID:             role.TenantID,
+		permissionIDs:        permissionIDs,
+		deniedPermissionIDs:  deniedIDs,
+		permissionConditions: conditions,
+		parentIDs:            parentIDs,
+		requireMFA:           role.RequireMFA,
+	}
+	return id, nil
+}
+
+func (s *MemoryStore) UpdateRole(role Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.roles[role.ID]
+	if !ok {
+		return apperrors.ErrRoleNotFound
+	}
+	if s.roleNameTaken(role.Name, existing.tenantID, role.ID) {
+		return apperrors.ErrDuplicateRole
+	}
+
+	permissionIDs, err := s.replaceGrants(existing.permissionIDs, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	deniedIDs, err := s.replaceGrants(existing.deniedPermissionIDs, role.DeniedPermissions)
+	if err != nil {
+		return err
+	}
+	if err := s.checkEffects(permissionIDs, deniedIDs); err != nil {
+		return err
+	}
+
+	// Conditions of a list that is not replaced are kept.
+	permissionConditions := make(map[int]string)
+	collect := func(names []string, ids []int) {
+		if names == nil {
+			for _, id := range ids {
+				if condition, ok := existing.permissionConditions[id]; ok {
+					permissionConditions[id] = condition
+				}
+			}
+			return
+		}
+		for id, condition := range conditionsByID(names, ids, role.PermissionConditions) {
+			permissionConditions[id] = condition
+		}
+	}
+	collect(role.Permissions, permissionIDs)
+	collect(role.DeniedPermissions, deniedIDs)
+
+	parentIDs := existing.parentIDs
+	if role.Parents != nil {
+		var err error
+		parentIDs, err = s.resolveRoles(role.Parents, existing.tenantID)
+		if err != nil {
+			return err
+		}
+		if createsCycle(s.roleEdges(), role.ID, parentIDs) {
+			return apperrors.ErrRoleCycle
+		}
+	}
+
+	existing.name = role.Name
+	existing.permissionIDs = permissionIDs
+	existing.deniedPermissionIDs = deniedIDs
+	existing.permissionConditions = permissionConditions
+	existing.parentIDs = parentIDs
+	if role.SetRequireMFA != nil {
+		existing.requireMFA = *role.SetRequireMFA
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteRole(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.roles[id]; !ok {
+		return apperrors.ErrRoleNotFound
+	}
+	delete(s.roles, id)
+	for _, role := range s.roles {
+		role.parentIDs = removeID(role.parentIDs, id)
+	}
+	for _, user := range s.users {
+		user.roleIDs = removeID(user.roleIDs, id)
+		for tenantID, roleIDs := range user.tenantRoleIDs {
+			user.tenantRoleIDs[tenantID] = removeID(roleIDs, id)
+		}
+	}
+	for _, group := range s.groups {
+		group.roleIDs = removeID(group.roleIDs, id)
+	}
+	s.removeBindings(func(b ResourceBinding) bool { return b.RoleID == id })
+	return nil
+}
+
+func (s *MemoryStore) SetRoleMembers(id int, name string, members []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, ok := s.roles[id]
+	if !ok {
+		return apperrors.ErrRoleNotFound
+	}
+	if s.roleNameTaken(name, role.tenantID, id) {
+		return apperrors.ErrDuplicateRole
+	}
+	if err := s.checkMembers(members); err != nil {
+		return err
+	}
+
+	role.name = name
+	s.setRoleMembers(id, members)
+	return nil
+}
+
+func (s *MemoryStore) checkMembers(members []int) error {
+	for _, userID := range members {
+		if _, ok := s.users[userID]; !ok {
+			return fmt.Errorf("%w: %d", apperrors.ErrUserNotFound, userID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) setRoleMembers(id int, members []int) {
+	for userID, user := range s.users {
+		member, assigned := containsID(members, userID), containsID(user.roleIDs, id)
+		switch {
+		case member && !assigned:
+			user.roleIDs = append(user.roleIDs, id)
+		case !member && assigned:
+			user.roleIDs = removeID(user.roleIDs, id)
+			delete(user.roleConditions, id)
+		}
+	}
+}
+
+func (s *MemoryStore) role(id int) *Role {
+	role := s.roles[id]
+	return &Role{
+		ID:                   id,
+		Name:                 role.name,
+		TenantID:             role.tenantID,
+		Permissions:          s.permissionNames(role.permissionIDs),
+		DeniedPermissions:    s.permissionNames(role.deniedPermissionIDs),
+		PermissionConditions: conditionsByName(role.permissionConditions, s.permissionName),
+		Parents:              s.roleNames(role.parentIDs),
+		ParentIDs:            append([]int(nil), role.parentIDs...),
+		RequireMFA:           role.requireMFA,
+	}
+}
+
+// replaceGrants resolves names, or keeps current when names is nil.
+func (s *MemoryStore) replaceGrants(current []int, names []string) ([]int, error) {
+	if names == nil {
+		return current, nil
+	}
+	return s.resolvePermissions(names)
+}
+
+func (s *MemoryStore) checkEffects(allowed, denied []int) error {
+	for _, id := range denied {
+		for _, allowedID := range allowed {
+			if id == allowedID {
+				return fmt.Errorf("%w: %s is both allowed and denied", apperrors.ErrInvalidPermission, s.permissions[id])
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) roleEdges() map[int][]int {
+	edges := make(map[int][]int)
+	for id, role := range s.roles {
+		edges[id] = role.parentIDs
+	}
+	return edges
+}
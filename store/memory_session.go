@@ -0,0 +1,121 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) CreateSession(session Session) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[session.UserID]; !ok {
+		return 0, apperrors.ErrUserNotFound
+	}
+
+	now := time.Now()
+	session.ID = s.newID()
+	session.CreatedAt = now
+	session.LastUsedAt = now
+	session.RevokedAt = time.Time{}
+	s.sessions[session.ID] = &session
+	return session.ID, nil
+}
+
+func (s *MemoryStore) GetSession(id int) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, apperrors.ErrSessionNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+func (s *MemoryStore) GetUserSessions(userID int) ([]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var sessions []Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt.IsZero() && session.ExpiresAt.After(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions, nil
+}
+
+func (s *MemoryStore) TouchSession(id int, ip string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	session.LastUsedAt = time.Now()
+	if ip != "" {
+		session.IP = ip
+	}
+	if !expiresAt.IsZero() {
+		session.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (s *MemoryStore) RevokeSession(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return apperrors.ErrSessionNotFound
+	}
+	s.revokeFamily(session.UserID, session.FamilyID, time.Now())
+	return nil
+}
+
+func (s *MemoryStore) RevokeUserSessions(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return apperrors.ErrUserNotFound
+	}
+	s.revokeUserSessions(userID)
+	return nil
+}
+
+// revokeUserSessions revokes every session and refresh token of the user;
+// s.mu must be held.
+func (s *MemoryStore) revokeUserSessions(userID int) {
+	now := time.Now()
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt.IsZero() {
+			session.RevokedAt = now
+		}
+	}
+	for _, token := range s.refreshTokens {
+		if token.UserID == userID && token.RevokedAt.IsZero() {
+			token.RevokedAt = now
+		}
+	}
+}
+
+func (s *MemoryStore) DeleteExpiredSessions(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.ExpiresAt.Before(before) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
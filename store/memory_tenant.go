@@ -0,0 +1,159 @@
+package store
+
+import (
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) GetTenants() ([]Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tenants []Tenant
+	for _, id := range sortedIDs(s.tenants) {
+		tenants = append(tenants, Tenant{ID: id, Name: s.tenants[id]})
+	}
+	return tenants, nil
+}
+
+func (s *MemoryStore) GetTenant(id int) (*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name, ok := s.tenants[id]
+	if !ok {
+		return nil, apperrors.ErrTenantNotFound
+	}
+	return &Tenant{ID: id, Name: name}, nil
+}
+
+func (s *MemoryStore) CreateTenant(name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenantID(name); ok {
+		return 0, apperrors.ErrDuplicateTenant
+	}
+
+	id := s.newID()
+	s.tenants[id] = name
+	return id, nil
+}
+
+func (s *MemoryStore) UpdateTenant(tenant Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenant.ID]; !ok {
+		return apperrors.ErrTenantNotFound
+	}
+	if otherID, taken := s.tenantID(tenant.Name); taken && otherID != tenant.ID {
+		return apperrors.ErrDuplicateTenant
+	}
+
+	s.tenants[tenant.ID] = tenant.Name
+	return nil
+}
+
+func (s *MemoryStore) DeleteTenant(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[id]; !ok {
+		return apperrors.ErrTenantNotFound
+	}
+	delete(s.tenants, id)
+
+	for roleID, role := range s.roles {
+		if role.tenantID == id {
+			delete(s.roles, roleID)
+		}
+	}
+	for _, role := range s.roles {
+		kept := role.parentIDs[:0]
+		for _, parentID := range role.parentIDs {
+			if _, ok := s.roles[parentID]; ok {
+				kept = append(kept, parentID)
+			}
+		}
+		role.parentIDs = kept
+	}
+	for _, user := range s.users {
+		delete(user.tenantRoleIDs, id)
+		delete(user.tenantRoleConditions, id)
+	}
+	s.removeBindings(func(b ResourceBinding) bool { return b.TenantID == id })
+	return nil
+}
+
+func (s *MemoryStore) GetTenantUsers(tenantID int) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tenants[tenantID]; !ok {
+		return nil, apperrors.ErrTenantNotFound
+	}
+
+	var users []User
+	for _, id := range sortedIDs(s.users) {
+		user := s.users[id]
+		if len(user.tenantRoleIDs[tenantID]) > 0 {
+			users = append(users, User{
+				ID:             id,
+				Username:       user.username,
+				Roles:          s.roleNames(user.tenantRoleIDs[tenantID]),
+				RoleConditions: conditionsByName(user.tenantRoleConditions[tenantID], s.roleName),
+			})
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) GetUserTenantRoles(tenantID, userID int) ([]string, map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tenants[tenantID]; !ok {
+		return nil, nil, apperrors.ErrTenantNotFound
+	}
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, nil, apperrors.ErrUserNotFound
+	}
+	conditions := conditionsByName(user.tenantRoleConditions[tenantID], s.roleName)
+	return s.roleNames(user.tenantRoleIDs[tenantID]), conditions, nil
+}
+
+func (s *MemoryStore) SetUserTenantRoles(tenantID, userID int, roles []string, conditions map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenantID]; !ok {
+		return apperrors.ErrTenantNotFound
+	}
+	user, ok := s.users[userID]
+	if !ok {
+		return apperrors.ErrUserNotFound
+	}
+
+	roleIDs, err := s.resolveTenantRoles(roles, tenantID)
+	if err != nil {
+		return err
+	}
+
+	if user.tenantRoleIDs == nil {
+		user.tenantRoleIDs = make(map[int][]int)
+		user.tenantRoleConditions = make(map[int]map[int]string)
+	}
+	user.tenantRoleIDs[tenantID] = roleIDs
+	user.tenantRoleConditions[tenantID] = conditionsByID(roles, roleIDs, conditions)
+	return nil
+}
+
+func (s *MemoryStore) tenantID(name string) (int, bool) {
+	for id, tenant := range s.tenants {
+		if tenant == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
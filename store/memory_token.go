@@ -0,0 +1,80 @@
+package store
+
+import (
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) CreateRefreshToken(token RefreshToken) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[token.UserID]; !ok {
+		return 0, apperrors.ErrUserNotFound
+	}
+
+	token.ID = s.newID()
+	s.refreshTokens[token.ID] = &token
+	return token.ID, nil
+}
+
+func (s *MemoryStore) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.refreshTokens {
+		if token.TokenHash == tokenHash {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, apperrors.ErrTokenNotFound
+}
+
+func (s *MemoryStore) UseRefreshToken(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.refreshTokens[id]
+	if !ok || !token.UsedAt.IsZero() {
+		return false, nil
+	}
+	token.UsedAt = time.Now()
+	return true, nil
+}
+
+func (s *MemoryStore) RevokeRefreshTokenFamily(userID int, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeFamily(userID, familyID, time.Now())
+	return nil
+}
+
+// revokeFamily revokes the tokens and the session of a user's family; s.mu
+// must be held.
+func (s *MemoryStore) revokeFamily(userID int, familyID string, now time.Time) {
+	for _, token := range s.refreshTokens {
+		if token.UserID == userID && token.FamilyID == familyID && token.RevokedAt.IsZero() {
+			token.RevokedAt = now
+		}
+	}
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.FamilyID == familyID && session.RevokedAt.IsZero() {
+			session.RevokedAt = now
+		}
+	}
+}
+
+func (s *MemoryStore) DeleteExpiredRefreshTokens(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.refreshTokens {
+		if token.ExpiresAt.Before(before) {
+			delete(s.refreshTokens, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"strings"
+
+	apperrors "rbac/errors"
+)
+
+func (s *MemoryStore) CreateUser(user User) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createUser(user)
+}
+
+func (s *MemoryStore) createUser(user User) (int, error) {
+	if _, ok := s.userID(user.Username); ok {
+		return 0, apperrors.ErrDuplicateUsername
+	}
+
+	roleIDs, err := s.resolveRoles(user.Roles, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	id := s.newID()
+	s.users[id] = &memoryUser{
+		username:       user.Username,
+		password:       user.Password,
+		disabled:       user.Disabled,
+		attributes:     copyAttributes(user.Attributes),
+		roleIDs:        roleIDs,
+		roleConditions: conditionsByID(user.Roles, roleIDs, user.RoleConditions),
+	}
+	return id, nil
+}
+
+func (s *MemoryStore) GetUsers(limit, offset int) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []User
+	for i, id := range sortedIDs(s.users) {
+		if i < offset {
+			continue
+		}
+		if len(users) == limit {
+			break
+		}
+		user := s.user(id)
+		user.Password = ""
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) GetUsersByUsernameFold(username string) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []User
+	for _, id := range sortedIDs(s.users) {
+		if strings.EqualFold(s.users[id].username, username) {
+			user := s.user(id)
+			user.Password = ""
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) CountUsers() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.users), nil
+}
+
+func (s *MemoryStore) GetUser(id int) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.users[id]; !ok {
+		return nil, apperrors.ErrUserNotFound
+	}
+	return s.user(id), nil
+}
+
+func (s *MemoryStore) GetUserByUsername(username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.userID(username)
+	if !ok {
+		return nil, apperrors.ErrUserNotFound
+	}
+	return s.user(id), nil
+}
+
+func (s *MemoryStore) UpdateUser(update User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[update.ID]
+	if !ok {
+		return apperrors.ErrUserNotFound
+	}
+	if otherID, taken := s.userID(update.Username); taken && otherID != update.ID {
+		return apperrors.ErrDuplicateUsername
+	}
+
+	if update.Roles != nil {
+		roleIDs, err := s.resolveRoles(update.Roles, 0)
+		if err != nil {
+			return err
+		}
+		user.roleIDs = roleIDs
+		user.roleConditions = conditionsByID(update.Roles, roleIDs, update.RoleConditions)
+	}
+	if update.Attributes != nil {
+		user.attributes = copyAttributes(update.Attributes)
+	}
+	user.username = update.Username
+	if update.SetDisabled != nil {
+		s.setUserDisabled(update.ID, *update.SetDisabled)
+	}
+	return nil
+}
+
+func (s *MemoryStore) SetUserDisabled(id int, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return apperrors.ErrUserNotFound
+	}
+	s.setUserDisabled(id, disabled)
+	return nil
+}
+
+func (s *MemoryStore) setUserDisabled(id int, disabled bool) {
+	s.users[id].disabled = disabled
+	if disabled {
+		s.revokeUserSessions(id)
+	}
+}
+
+func (s *MemoryStore) DeleteUser(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return apperrors.ErrUserNotFound
+	}
+	delete(s.users, id)
+	for _, group := range s.groups {
+		group.memberIDs = removeID(group.memberIDs, id)
+	}
+	s.removeBindings(func(b ResourceBinding) bool { return b.UserID == id })
+	for tokenID, token := range s.refreshTokens {
+		if token.UserID == id {
+			delete(s.refreshTokens, tokenID)
+		}
+	}
+	for sessionID, session := range s.sessions {
+		if session.UserID == id {
+			delete(s.sessions, sessionID)
+		}
+	}
+	for codeHash, code := range s.codes {
+		if code.UserID == id {
+			delete(s.codes, codeHash)
+		}
+	}
+	for identityID, identity := range s.identities {
+		if identity.UserID == id {
+			delete(s.identities, identityID)
+		}
+	}
+	delete(s.totps, id)
+	delete(s.recoveryCodes, id)
+	delete(s.mfaLockouts, id)
+	for tokenHash, challenge := range s.challenges {
+		if challenge.UserID == id {
+			delete(s.challenges, tokenHash)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) userID(username string) (int, bool) {
+	for id, user := range s.users {
+		if user.username == username {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (s *MemoryStore) user(id int) *User {
+	user := s.users[id]
+	return &User{
+		ID:             id,
+		Username:       user.username,
+		Password:       user.password,
+		Disabled:       user.disabled,
+		Roles:          s.roleNames(user.roleIDs),
+		RoleConditions: conditionsByName(user.roleConditions, s.roleName),
+		Attributes:     copyAttributes(user.attributes),
+	}
+}
+
+func copyAttributes(attributes map[string]string) map[string]string {
+	if len(attributes) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	apperrors "rbac/errors"
+)
+
+var _ Store = (*SQLStore)(nil)
+
+type SQLStore struct {
+	db *dialectDB
+}
+
+func NewSQLStore(conn *sql.DB, dialect Dialect) *SQLStore {
+	return &SQLStore{db: &dialectDB{DB: conn, dialect: dialect}}
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// dialectDB and dialectTx rebind every query for the configured dialect so
+// the store can be written once with ? placeholders.
+type dialectDB struct {
+	*sql.DB
+	dialect Dialect
+}
+
+func (d *dialectDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.DB.Query(d.dialect.Rebind(query), args...)
+}
+
+func (d *dialectDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return d.DB.QueryRow(d.dialect.Rebind(query), args...)
+}
+
+func (d *dialectDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.DB.Exec(d.dialect.Rebind(query), args...)
+}
+
+func (d *dialectDB) Begin() (*dialectTx, error) {
+	t, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &dialectTx{Tx: t, dialect: d.dialect}, nil
+}
+
+func (d *dialectDB) Insert(query string, args ...interface{}) (int64, error) {
+	return insert(d, d.dialect, query, args...)
+}
+
+type dialectTx struct {
+	*sql.Tx
+	dialect Dialect
+}
+
+func (t *dialectTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.Query(t.dialect.Rebind(query), args...)
+}
+
+func (t *dialectTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRow(t.dialect.Rebind(query), args...)
+}
+
+func (t *dialectTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(t.dialect.Rebind(query), args...)
+}
+
+func (t *dialectTx) Insert(query string, args ...interface{}) (int64, error) {
+	return insert(t, t.dialect, query, args...)
+}
+
+type execer interface {
+	queryer
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insert(e execer, dialect Dialect, query string, args ...interface{}) (int64, error) {
+	if dialect.SupportsReturning() {
+		var id int64
+		err := e.QueryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := e.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func queryStrings(q queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+func queryIDs(q queryer, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func exists(q queryer, query string, args ...interface{}) (bool, error) {
+	var found bool
+	err := q.QueryRow("SELECT EXISTS ("+query+")", args...).Scan(&found)
+	return found, err
+}
+
+// lookupRoleID finds a role by name among the tenant's roles and then the
+// global ones. A tenantID of 0 only looks at global roles.
+func lookupRoleID(q queryer, name string, tenantID int) (int, error) {
+	var roleID int
+	var err error
+	if tenantID == 0 {
+		err = q.QueryRow("SELECT id FROM roles WHERE name = ? AND tenant_id IS NULL", name).Scan(&roleID)
+	} else {
+		err = q.QueryRow(`
+			SELECT id FROM roles
+			WHERE name = ? AND (tenant_id = ? OR tenant_id IS NULL)
+			ORDER BY tenant_id IS NULL
+			LIMIT 1
+		`, name, tenantID).Scan(&roleID)
+	}
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", apperrors.ErrInvalidRole, name)
+	}
+	return roleID, err
+}
+
+// lookupTenantRoleID finds a role by name among the tenant's own roles
+// only, for assignments made within the tenant: a global role is assigned
+// by whoever may manage global roles, not by the tenant's administrators.
+func lookupTenantRoleID(q queryer, name string, tenantID int) (int, error) {
+	var roleID int
+	err := q.QueryRow("SELECT id FROM roles WHERE name = ? AND tenant_id = ?", name, tenantID).Scan(&roleID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", apperrors.ErrInvalidRole, name)
+	}
+	return roleID, err
+}
+
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func nullableString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// queryConditional reads (name, condition_expr) rows into the names and a
+// map holding the conditions of the names that have one.
+func queryConditional(q queryer, query string, args ...interface{}) ([]string, map[string]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	conditions := make(map[string]string)
+	for rows.Next() {
+		var name string
+		var condition sql.NullString
+		if err := rows.Scan(&name, &condition); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+		if condition.String != "" {
+			conditions[name] = condition.String
+		}
+	}
+	return names, conditions, rows.Err()
+}
+
+func assignRoles(tx *dialectTx, userID int64, roles []string, conditions map[string]string) error {
+	for _, roleName := range roles {
+		roleID, err := lookupRoleID(tx, roleName, 0)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO user_roles (user_id, role_id, condition_expr) VALUES (?, ?, ?)",
+			userID, roleID, nullableString(conditions[roleName]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Grants in role_permissions either allow or deny their permission.
+const (
+	effectAllow = "allow"
+	effectDeny  = "deny"
+)
+
+func assignPermissions(tx *dialectTx, roleID int64, permissions []string, effect string, conditions map[string]string) error {
+	for _, permName := range permissions {
+		var permID int
+		err := tx.QueryRow("SELECT id FROM permissions WHERE name = ?", permName).Scan(&permID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s", apperrors.ErrInvalidPermission, permName)
+		}
+		if err != nil {
+			return err
+		}
+
+		var existing string
+		err = tx.QueryRow("SELECT effect FROM role_permissions WHERE role_id = ? AND permission_id = ?", roleID, permID).Scan(&existing)
+		if err == nil {
+			if existing != effect {
+				return fmt.Errorf("%w: %s is both allowed and denied", apperrors.ErrInvalidPermission, permName)
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO role_permissions (role_id, permission_id, effect, condition_expr) VALUES (?, ?, ?, ?)",
+			roleID, permID, effect, nullableString(conditions[permName]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"database/sql"
+
+	apperrors "rbac/errors"
+)
+
+const selectResourceBindings = `
+	SELECT b.id, b.user_id, b.role_id, r.name, b.tenant_id, b.resource_type, b.resource_id, b.condition_expr
+	FROM resource_role_bindings b
+	JOIN roles r ON r.id = b.role_id
+`
+
+func (s *SQLStore) GetResourceBindings() ([]ResourceBinding, error) {
+	return s.queryResourceBindings(selectResourceBindings + "ORDER BY b.id")
+}
+
+func (s *SQLStore) GetUserResourceBindings(userID int) ([]ResourceBinding, error) {
+	return s.queryResourceBindings(selectResourceBindings+"WHERE b.user_id = ? ORDER BY b.id", userID)
+}
+
+func (s *SQLStore) CreateResourceBinding(binding ResourceBinding) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	found, err := exists(tx, "SELECT 1 FROM users WHERE id = ?", binding.UserID)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, apperrors.ErrUserNotFound
+	}
+
+	if binding.TenantID != 0 {
+		found, err := exists(tx, "SELECT 1 FROM tenants WHERE id = ?", binding.TenantID)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, apperrors.ErrTenantNotFound
+		}
+	}
+
+	roleID, err := lookupRoleID(tx, binding.Role, binding.TenantID)
+	if err != nil {
+		return 0, err
+	}
+
+	bindingID, err := tx.Insert(`
+		INSERT INTO resource_role_bindings (user_id, role_id, tenant_id, resource_type, resource_id, condition_expr)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, binding.UserID, roleID, nullableID(binding.TenantID), binding.ResourceType, binding.ResourceID,
+		nullableString(binding.Condition))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(bindingID), nil
+}
+
+func (s *SQLStore) DeleteResourceBinding(id int) error {
+	result, err := s.db.Exec("DELETE FROM resource_role_bindings WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrBindingNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) queryResourceBindings(query string, args ...interface{}) ([]ResourceBinding, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bindings []ResourceBinding
+	for rows.Next() {
+		var binding ResourceBinding
+		var tenantID sql.NullInt64
+		var condition sql.NullString
+		err := rows.Scan(&binding.ID, &binding.UserID, &binding.RoleID, &binding.Role,
+			&tenantID, &binding.ResourceType, &binding.ResourceID, &condition)
+		if err != nil {
+			return nil, err
+		}
+		binding.TenantID = int(tenantID.Int64)
+		binding.Condition = condition.String
+		bindings = append(bindings, binding)
+	}
+	return bindings, rows.Err()
+}
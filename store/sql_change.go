@@ -0,0 +1,46 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+func (s *SQLStore) RecordChange(userID int) (int, error) {
+	id, err := s.db.Insert("INSERT INTO authz_changes (user_id, created_at) VALUES (?, ?)",
+		nullableID(userID), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *SQLStore) GetChangesSince(id int) ([]Change, error) {
+	rows, err := s.db.Query("SELECT id, user_id FROM authz_changes WHERE id > ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []Change
+	for rows.Next() {
+		var change Change
+		var userID sql.NullInt64
+		if err := rows.Scan(&change.ID, &userID); err != nil {
+			return nil, err
+		}
+		change.UserID = int(userID.Int64)
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func (s *SQLStore) LatestChangeID() (int, error) {
+	var id int
+	err := s.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM authz_changes").Scan(&id)
+	return id, err
+}
+
+func (s *SQLStore) PruneChanges(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM authz_changes WHERE created_at < ?", before.UTC())
+	return err
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"database/sql"
+
+	apperrors "rbac/errors"
+)
+
+func (s *SQLStore) GetGroups() ([]Group, error) {
+	rows, err := s.db.Query("SELECT id, name FROM `groups` ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var group Group
+		if err := rows.Scan(&group.ID, &group.Name); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		groups[i].Roles, err = s.getGroupRoles(groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+func (s *SQLStore) GetGroup(id int) (*Group, error) {
+	var group Group
+	err := s.db.QueryRow("SELECT id, name FROM `groups` WHERE id = ?", id).Scan(&group.ID, &group.Name)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	group.Roles, err = s.getGroupRoles(group.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (s *SQLStore) CreateGroup(group Group) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	taken, err := exists(tx, "SELECT 1 FROM `groups` WHERE name = ?", group.Name)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, apperrors.ErrDuplicateGroup
+	}
+
+	groupID, err := tx.Insert("INSERT INTO `groups` (name) VALUES (?)", group.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := assignGroupRoles(tx, groupID, group.Roles); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(groupID), nil
+}
+
+func (s *SQLStore) UpdateGroup(group Group) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	found, err := exists(tx, "SELECT 1 FROM `groups` WHERE id = ?", group.ID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrGroupNotFound
+	}
+
+	taken, err := exists(tx, "SELECT 1 FROM `groups` WHERE name = ? AND id <> ?", group.Name, group.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return apperrors.ErrDuplicateGroup
+	}
+
+	_, err = tx.Exec("UPDATE `groups` SET name = ? WHERE id = ?", group.Name, group.ID)
+	if err != nil {
+		return err
+	}
+
+	if group.Roles != nil {
+		_, err = tx.Exec("DELETE FROM group_roles WHERE group_id = ?", group.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := assignGroupRoles(tx, int64(group.ID), group.Roles); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteGroup(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM group_roles WHERE group_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM group_members WHERE group_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM `groups` WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrGroupNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetGroupMembers(id int) ([]User, error) {
+	found, err := exists(s.db, "SELECT 1 FROM `groups` WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, apperrors.ErrGroupNotFound
+	}
+
+	rows, err := s.db.Query(`
+		SELECT u.id, u.username FROM users u
+		JOIN group_members gm ON u.id = gm.user_id
+		WHERE gm.group_id = ?
+		ORDER BY u.id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLStore) AddGroupMember(groupID, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	found, err := exists(tx, "SELECT 1 FROM `groups` WHERE id = ?", groupID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrGroupNotFound
+	}
+
+	found, err = exists(tx, "SELECT 1 FROM users WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrUserNotFound
+	}
+
+	member, err := exists(tx, "SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID)
+	if err != nil {
+		return err
+	}
+	if member {
+		return nil
+	}
+
+	_, err = tx.Exec("INSERT INTO group_members (group_id, user_id) VALUES (?, ?)", groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) RemoveGroupMember(groupID, userID int) error {
+	found, err := exists(s.db, "SELECT 1 FROM `groups` WHERE id = ?", groupID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrGroupNotFound
+	}
+
+	result, err := s.db.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrNotGroupMember
+	}
+	return nil
+}
+
+func (s *SQLStore) GetUserGroups(userID int) ([]Group, error) {
+	rows, err := s.db.Query("SELECT g.id, g.name FROM `groups` g "+
+		"JOIN group_members gm ON g.id = gm.group_id "+
+		"WHERE gm.user_id = ? ORDER BY g.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var group Group
+		if err := rows.Scan(&group.ID, &group.Name); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		groups[i].Roles, err = s.getGroupRoles(groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+func (s *SQLStore) getGroupRoles(groupID int) ([]string, error) {
+	return queryStrings(s.db, `
+		SELECT r.name FROM roles r
+		JOIN group_roles gr ON r.id = gr.role_id
+		WHERE gr.group_id = ?
+	`, groupID)
+}
+
+func assignGroupRoles(tx *dialectTx, groupID int64, roles []string) error {
+	for _, roleName := range roles {
+		roleID, err := lookupRoleID(tx, roleName, 0)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO group_roles (group_id, role_id) VALUES (?, ?)", groupID, roleID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
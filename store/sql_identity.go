@@ -0,0 +1,97 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *SQLStore) GetIdentity(provider, subject string) (*Identity, error) {
+	var identity Identity
+	err := s.db.QueryRow("SELECT id, user_id, provider, subject FROM user_identities WHERE provider = ? AND subject = ?",
+		provider, subject).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (s *SQLStore) CreateIdentityUser(user User, identity Identity) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := createUser(tx, user)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO user_identities (user_id, provider, subject) VALUES (?, ?, ?)",
+		userID, identity.Provider, identity.Subject)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(userID), nil
+}
+
+func (s *SQLStore) CreateLoginState(state LoginState) error {
+	_, err := s.db.Exec(`
+		INSERT INTO sso_states (state_hash, provider, nonce, code_verifier, tenant_id, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, nullableID(state.TenantID), state.ExpiresAt.UTC())
+	return err
+}
+
+func (s *SQLStore) UseLoginState(stateHash string) (*LoginState, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var state LoginState
+	var tenantID sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT state_hash, provider, nonce, code_verifier, tenant_id, expires_at
+		FROM sso_states WHERE state_hash = ?
+	`, stateHash).Scan(&state.StateHash, &state.Provider, &state.Nonce, &state.CodeVerifier, &tenantID, &state.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrLoginStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	state.TenantID = int(tenantID.Int64)
+
+	result, err := tx.Exec("DELETE FROM sso_states WHERE state_hash = ?", stateHash)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, apperrors.ErrLoginStateNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *SQLStore) DeleteExpiredLoginStates(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM sso_states WHERE expires_at < ?", before.UTC())
+	return err
+}
@@ -0,0 +1,293 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *SQLStore) GetTOTP(userID int) (*TOTP, error) {
+	var totp TOTP
+	err := s.db.QueryRow("SELECT user_id, secret, confirmed, last_step FROM user_totp WHERE user_id = ?", userID).
+		Scan(&totp.UserID, &totp.Secret, &totp.Confirmed, &totp.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
+func (s *SQLStore) CreateTOTP(totp TOTP) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	found, err := exists(tx, "SELECT 1 FROM users WHERE id = ?", totp.UserID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrUserNotFound
+	}
+
+	_, err = tx.Exec("DELETE FROM user_totp WHERE user_id = ?", totp.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO user_totp (user_id, secret, confirmed, last_step) VALUES (?, ?, ?, ?)",
+		totp.UserID, totp.Secret, totp.Confirmed, totp.LastStep)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) ConfirmTOTP(userID int, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE user_totp SET confirmed = ? WHERE user_id = ?", true, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrTOTPNotFound
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	result, err := s.db.Exec("UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *SQLStore) DeleteTOTP(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM user_totp WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrTOTPNotFound
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *dialectTx, userID int, codeHashes []string) error {
+	_, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) GetRecoveryCodes(userID int) ([]RecoveryCode, error) {
+	rows, err := s.db.Query("SELECT id, user_id, code_hash FROM recovery_codes WHERE user_id = ? AND used_at IS NULL ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []RecoveryCode
+	for rows.Next() {
+		var code RecoveryCode
+		if err := rows.Scan(&code.ID, &code.UserID, &code.CodeHash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+func (s *SQLStore) UseRecoveryCode(userID, id int) (bool, error) {
+	result, err := s.db.Exec("UPDATE recovery_codes SET used_at = ? WHERE id = ? AND user_id = ? AND used_at IS NULL",
+		time.Now().UTC(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *SQLStore) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+func (s *SQLStore) GetMFALockout(userID int) (*MFALockout, error) {
+	lockout := MFALockout{UserID: userID}
+	var lockedUntil sql.NullTime
+	err := s.db.QueryRow("SELECT attempts, locked_until FROM mfa_lockouts WHERE user_id = ?", userID).
+		Scan(&lockout.Attempts, &lockedUntil)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	lockout.LockedUntil = lockedUntil.Time
+	return &lockout, nil
+}
+
+func (s *SQLStore) AddMFAAttempt(userID int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	upsert := "INSERT INTO mfa_lockouts (user_id, attempts) VALUES (?, 1)" +
+		tx.dialect.OnConflictUpdate("user_id", "attempts = mfa_lockouts.attempts + 1")
+	if _, err := tx.Exec(upsert, userID); err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	err = tx.QueryRow("SELECT attempts FROM mfa_lockouts WHERE user_id = ?", userID).Scan(&attempts)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return attempts, nil
+}
+
+func (s *SQLStore) LockMFA(userID int, until time.Time) error {
+	_, err := s.db.Exec("UPDATE mfa_lockouts SET attempts = 0, locked_until = ? WHERE user_id = ?", until.UTC(), userID)
+	return err
+}
+
+func (s *SQLStore) ResetMFAAttempts(userID int) error {
+	_, err := s.db.Exec("DELETE FROM mfa_lockouts WHERE user_id = ?", userID)
+	return err
+}
+
+func (s *SQLStore) CreateMFAChallenge(challenge MFAChallenge) error {
+	_, err := s.db.Exec(`
+		INSERT INTO mfa_challenges (token_hash, user_id, tenant_id, attempts, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, challenge.TokenHash, challenge.UserID, nullableID(challenge.TenantID), challenge.Attempts, challenge.ExpiresAt.UTC())
+	return err
+}
+
+func (s *SQLStore) GetMFAChallenge(tokenHash string) (*MFAChallenge, error) {
+	var challenge MFAChallenge
+	var tenantID sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT token_hash, user_id, tenant_id, attempts, expires_at
+		FROM mfa_challenges WHERE token_hash = ?
+	`, tokenHash).Scan(&challenge.TokenHash, &challenge.UserID, &tenantID, &challenge.Attempts, &challenge.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	challenge.TenantID = int(tenantID.Int64)
+	return &challenge, nil
+}
+
+func (s *SQLStore) FailMFAChallenge(tokenHash string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	err = tx.QueryRow("SELECT attempts FROM mfa_challenges WHERE token_hash = ?", tokenHash).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		return 0, apperrors.ErrChallengeNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return attempts, nil
+}
+
+func (s *SQLStore) DeleteMFAChallenge(tokenHash string) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM mfa_challenges WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *SQLStore) DeleteExpiredMFAChallenges(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM mfa_challenges WHERE expires_at < ?", before.UTC())
+	return err
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *SQLStore) GetOAuthClients() ([]OAuthClient, error) {
+	rows, err := s.db.Query("SELECT id, client_id, name, secret_hash, redirect_uris FROM oauth_clients ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+func (s *SQLStore) GetOAuthClient(clientID string) (*OAuthClient, error) {
+	client, err := scanOAuthClient(s.db.QueryRow(
+		"SELECT id, client_id, name, secret_hash, redirect_uris FROM oauth_clients WHERE client_id = ?", clientID))
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrClientNotFound
+	}
+	return client, err
+}
+
+func (s *SQLStore) CreateOAuthClient(client OAuthClient) (int, error) {
+	redirectURIs, err := json.Marshal(client.RedirectURIs)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := s.db.Insert("INSERT INTO oauth_clients (client_id, name, secret_hash, redirect_uris) VALUES (?, ?, ?, ?)",
+		client.ClientID, client.Name, nullableString(client.SecretHash), string(redirectURIs))
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *SQLStore) DeleteOAuthClient(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var clientID string
+	err = tx.QueryRow("SELECT client_id FROM oauth_clients WHERE id = ?", id).Scan(&clientID)
+	if err == sql.ErrNoRows {
+		return apperrors.ErrClientNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM oauth_codes WHERE client_id = ?", clientID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM oauth_clients WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) CreateAuthorizationCode(code AuthorizationCode) error {
+	_, err := s.db.Exec(`
+		INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope, nullableString(code.Nonce),
+		code.CodeChallenge, code.AuthTime.UTC(), code.ExpiresAt.UTC())
+	return err
+}
+
+func (s *SQLStore) UseAuthorizationCode(codeHash string) (*AuthorizationCode, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var code AuthorizationCode
+	var nonce sql.NullString
+	err = tx.QueryRow(`
+		SELECT code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at
+		FROM oauth_codes WHERE code_hash = ?
+	`, codeHash).Scan(&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope, &nonce,
+		&code.CodeChallenge, &code.AuthTime, &code.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	code.Nonce = nonce.String
+
+	// Of two concurrent redemptions only the one that deletes the row wins.
+	result, err := tx.Exec("DELETE FROM oauth_codes WHERE code_hash = ?", codeHash)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, apperrors.ErrCodeNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (s *SQLStore) DeleteExpiredAuthorizationCodes(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM oauth_codes WHERE expires_at < ?", before.UTC())
+	return err
+}
+
+func scanOAuthClient(row interface{ Scan(...interface{}) error }) (*OAuthClient, error) {
+	var client OAuthClient
+	var secretHash sql.NullString
+	var redirectURIs string
+	if err := row.Scan(&client.ID, &client.ClientID, &client.Name, &secretHash, &redirectURIs); err != nil {
+		return nil, err
+	}
+	client.SecretHash = secretHash.String
+	if err := json.Unmarshal([]byte(redirectURIs), &client.RedirectURIs); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"database/sql"
+
+	apperrors "rbac/errors"
+)
+
+func (s *SQLStore) GetPermissions() ([]Permission, error) {
+	rows, err := s.db.Query("SELECT id, name FROM permissions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []Permission
+	for rows.Next() {
+		var perm Permission
+		if err := rows.Scan(&perm.ID, &perm.Name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, perm)
+	}
+	return permissions, rows.Err()
+}
+
+func (s *SQLStore) GetPermission(id int) (*Permission, error) {
+	var perm Permission
+	err := s.db.QueryRow("SELECT id, name FROM permissions WHERE id = ?", id).Scan(&perm.ID, &perm.Name)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrPermissionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &perm, nil
+}
+
+func (s *SQLStore) GetPermissionRoles(id int) ([]string, error) {
+	return queryStrings(s.db, `
+		SELECT r.name FROM roles r
+		JOIN role_permissions rp ON r.id = rp.role_id
+		WHERE rp.permission_id = ?
+	`, id)
+}
+
+func (s *SQLStore) CreatePermission(name string) (int, error) {
+	taken, err := exists(s.db, "SELECT 1 FROM permissions WHERE name = ?", name)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, apperrors.ErrDuplicatePermission
+	}
+
+	permID, err := s.db.Insert("INSERT INTO permissions (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	return int(permID), nil
+}
+
+func (s *SQLStore) UpdatePermission(id int, name string) error {
+	found, err := exists(s.db, "SELECT 1 FROM permissions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrPermissionNotFound
+	}
+
+	taken, err := exists(s.db, "SELECT 1 FROM permissions WHERE name = ? AND id <> ?", name, id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return apperrors.ErrDuplicatePermission
+	}
+
+	_, err = s.db.Exec("UPDATE permissions SET name = ? WHERE id = ?", name, id)
+	return err
+}
+
+func (s *SQLStore) DeletePermission(id int, cascade bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	inUse, err := exists(tx, "SELECT 1 FROM role_permissions WHERE permission_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		if !cascade {
+			return apperrors.ErrPermissionInUse
+		}
+
+		_, err = tx.Exec("DELETE FROM role_permissions WHERE permission_id = ?", id)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM permissions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrPermissionNotFound
+	}
+
+	return tx.Commit()
+}
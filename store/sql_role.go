@@ -0,0 +1,530 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	apperrors "rbac/errors"
+)
+
+func (s *SQLStore) GetRoles() ([]Role, error) {
+	rows, err := s.db.Query("SELECT id, name, tenant_id, require_mfa FROM roles ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		var role Role
+		var tenantID sql.NullInt64
+		if err := rows.Scan(&role.ID, &role.Name, &tenantID, &role.RequireMFA); err != nil {
+			return nil, err
+		}
+		role.TenantID = int(tenantID.Int64)
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	grants, err := s.db.Query(`
+		SELECT rp.role_id, p.name, rp.effect, rp.condition_expr FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer grants.Close()
+
+	permissions := make(map[int][]string)
+	denied := make(map[int][]string)
+	conditions := make(map[int]map[string]string)
+	for grants.Next() {
+		var roleID int
+		var name, effect string
+		var condition sql.NullString
+		if err := grants.Scan(&roleID, &name, &effect, &condition); err != nil {
+			return nil, err
+		}
+		if effect == effectDeny {
+			denied[roleID] = append(denied[roleID], name)
+		} else {
+			permissions[roleID] = append(permissions[roleID], name)
+		}
+		if condition.String != "" {
+			if conditions[roleID] == nil {
+				conditions[roleID] = make(map[string]string)
+			}
+			conditions[roleID][name] = condition.String
+		}
+	}
+	if err := grants.Err(); err != nil {
+		return nil, err
+	}
+
+	parents, err := s.namesByRole(`
+		SELECT rp.role_id, r.name FROM role_parents rp
+		JOIN roles r ON r.id = rp.parent_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	edges, err := roleEdges(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range roles {
+		roles[i].Permissions = permissions[roles[i].ID]
+		roles[i].DeniedPermissions = denied[roles[i].ID]
+		roles[i].PermissionConditions = conditions[roles[i].ID]
+		roles[i].Parents = parents[roles[i].ID]
+		roles[i].ParentIDs = edges[roles[i].ID]
+	}
+	return roles, nil
+}
+
+func (s *SQLStore) GetRole(id int) (*Role, error) {
+	var role Role
+	var tenantID sql.NullInt64
+	err := s.db.QueryRow("SELECT id, name, tenant_id, require_mfa FROM roles WHERE id = ?", id).
+		Scan(&role.ID, &role.Name, &tenantID, &role.RequireMFA)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	role.TenantID = int(tenantID.Int64)
+
+	role.Permissions, role.PermissionConditions, err = s.getRolePermissions(role.ID, effectAllow)
+	if err != nil {
+		return nil, err
+	}
+
+	var deniedConditions map[string]string
+	role.DeniedPermissions, deniedConditions, err = s.getRolePermissions(role.ID, effectDeny)
+	if err != nil {
+		return nil, err
+	}
+	for name, condition := range deniedConditions {
+		role.PermissionConditions[name] = condition
+	}
+
+	rows, err := s.db.Query(`
+		SELECT r.id, r.name FROM roles r
+		JOIN role_parents rp ON r.id = rp.parent_id
+		WHERE rp.role_id = ?
+	`, role.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var parentID int
+		var parentName string
+		if err := rows.Scan(&parentID, &parentName); err != nil {
+			return nil, err
+		}
+		role.ParentIDs = append(role.ParentIDs, parentID)
+		role.Parents = append(role.Parents, parentName)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (s *SQLStore) GetRoleUsers(id int) ([]User, error) {
+	found, err := exists(s.db, "SELECT 1 FROM roles WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, apperrors.ErrRoleNotFound
+	}
+
+	rows, err := s.db.Query(`
+		SELECT u.id, u.username FROM users u
+		JOIN user_roles ur ON u.id = ur.user_id
+		WHERE ur.role_id = ?
+		ORDER BY u.id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLStore) CreateRole(role Role) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	roleID, err := createRole(tx, role)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(roleID), nil
+}
+
+func (s *SQLStore) CreateRoleWithMembers(role Role, members []int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	roleID, err := createRole(tx, role)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := setRoleMembers(tx, int(roleID), members); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(roleID), nil
+}
+
+func createRole(tx *dialectTx, role Role) (int64, error) {
+	if role.TenantID != 0 {
+		found, err := exists(tx, "SELECT 1 FROM tenants WHERE id = ?", role.TenantID)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, apperrors.ErrTenantNotFound
+		}
+	}
+
+	taken, err := roleNameTaken(tx, role.Name, role.TenantID, 0)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, apperrors.ErrDuplicateRole
+	}
+
+	roleID, err := tx.Insert("INSERT INTO roles (name, tenant_id, require_mfa) VALUES (?, ?, ?)",
+		role.Name, nullableID(role.TenantID), role.RequireMFA)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := assignPermissions(tx, roleID, role.Permissions, effectAllow, role.PermissionConditions); err != nil {
+		return 0, err
+	}
+
+	if err := assignPermissions(tx, roleID, role.DeniedPermissions, effectDeny, role.PermissionConditions); err != nil {
+		return 0, err
+	}
+
+	if err := assignParents(tx, roleID, role.TenantID, role.Parents); err != nil {
+		return 0, err
+	}
+	return roleID, nil
+}
+
+func (s *SQLStore) UpdateRole(role Role) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tenantID sql.NullInt64
+	err = tx.QueryRow("SELECT tenant_id FROM roles WHERE id = ?", role.ID).Scan(&tenantID)
+	if err == sql.ErrNoRows {
+		return apperrors.ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	taken, err := roleNameTaken(tx, role.Name, int(tenantID.Int64), role.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return apperrors.ErrDuplicateRole
+	}
+
+	_, err = tx.Exec("UPDATE roles SET name = ? WHERE id = ?", role.Name, role.ID)
+	if err != nil {
+		return err
+	}
+
+	if role.SetRequireMFA != nil {
+		_, err = tx.Exec("UPDATE roles SET require_mfa = ? WHERE id = ?", *role.SetRequireMFA, role.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Both lists are cleared before either is written so a permission can
+	// move from one to the other in a single update.
+	for effect, permissions := range map[string][]string{effectAllow: role.Permissions, effectDeny: role.DeniedPermissions} {
+		if permissions == nil {
+			continue
+		}
+		_, err = tx.Exec("DELETE FROM role_permissions WHERE role_id = ? AND effect = ?", role.ID, effect)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := assignPermissions(tx, int64(role.ID), role.Permissions, effectAllow, role.PermissionConditions); err != nil {
+		return err
+	}
+
+	if err := assignPermissions(tx, int64(role.ID), role.DeniedPermissions, effectDeny, role.PermissionConditions); err != nil {
+		return err
+	}
+
+	if role.Parents != nil {
+		_, err = tx.Exec("DELETE FROM role_parents WHERE role_id = ?", role.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := assignParents(tx, int64(role.ID), int(tenantID.Int64), role.Parents); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteRole(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM role_parents WHERE role_id = ? OR parent_id = ?", id, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_roles WHERE role_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM group_roles WHERE role_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM tenant_user_roles WHERE role_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM resource_role_bindings WHERE role_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM roles WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrRoleNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) SetRoleMembers(id int, name string, members []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tenantID sql.NullInt64
+	err = tx.QueryRow("SELECT tenant_id FROM roles WHERE id = ?", id).Scan(&tenantID)
+	if err == sql.ErrNoRows {
+		return apperrors.ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	taken, err := roleNameTaken(tx, name, int(tenantID.Int64), id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return apperrors.ErrDuplicateRole
+	}
+
+	_, err = tx.Exec("UPDATE roles SET name = ? WHERE id = ?", name, id)
+	if err != nil {
+		return err
+	}
+
+	if err := setRoleMembers(tx, id, members); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setRoleMembers assigns the role outside tenants to exactly the users
+// members, keeping the conditions of the assignments that remain.
+func setRoleMembers(tx *dialectTx, id int, members []int) error {
+	assigned, err := queryIDs(tx, "SELECT user_id FROM user_roles WHERE role_id = ?", id)
+	if err != nil {
+		return err
+	}
+	for _, userID := range members {
+		if slices.Contains(assigned, userID) {
+			continue
+		}
+		found, err := exists(tx, "SELECT 1 FROM users WHERE id = ?", userID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%w: %d", apperrors.ErrUserNotFound, userID)
+		}
+		_, err = tx.Exec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", userID, id)
+		if err != nil {
+			return err
+		}
+		assigned = append(assigned, userID)
+	}
+	for _, userID := range assigned {
+		if slices.Contains(members, userID) {
+			continue
+		}
+		_, err = tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) getRolePermissions(roleID int, effect string) ([]string, map[string]string, error) {
+	return queryConditional(s.db, `
+		SELECT p.name, rp.condition_expr FROM permissions p
+		JOIN role_permissions rp ON p.id = rp.permission_id
+		WHERE rp.role_id = ? AND rp.effect = ?
+	`, roleID, effect)
+}
+
+func (s *SQLStore) namesByRole(query string, args ...interface{}) (map[int][]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[int][]string)
+	for rows.Next() {
+		var roleID int
+		var name string
+		if err := rows.Scan(&roleID, &name); err != nil {
+			return nil, err
+		}
+		names[roleID] = append(names[roleID], name)
+	}
+	return names, rows.Err()
+}
+
+// roleNameTaken reports whether another role in the same tenant, or among
+// the global roles when tenantID is 0, already uses name.
+func roleNameTaken(q queryer, name string, tenantID, exceptID int) (bool, error) {
+	if tenantID == 0 {
+		return exists(q, "SELECT 1 FROM roles WHERE name = ? AND tenant_id IS NULL AND id <> ?", name, exceptID)
+	}
+	return exists(q, "SELECT 1 FROM roles WHERE name = ? AND tenant_id = ? AND id <> ?", name, tenantID, exceptID)
+}
+
+func assignParents(tx *dialectTx, roleID int64, tenantID int, parents []string) error {
+	if len(parents) == 0 {
+		return nil
+	}
+
+	parentIDs := make([]int, 0, len(parents))
+	for _, parentName := range parents {
+		parentID, err := lookupRoleID(tx, parentName, tenantID)
+		if err != nil {
+			return err
+		}
+		parentIDs = append(parentIDs, parentID)
+	}
+
+	edges, err := roleEdges(tx)
+	if err != nil {
+		return err
+	}
+	if createsCycle(edges, int(roleID), parentIDs) {
+		return apperrors.ErrRoleCycle
+	}
+
+	for _, parentID := range parentIDs {
+		_, err := tx.Exec("INSERT INTO role_parents (role_id, parent_id) VALUES (?, ?)", roleID, parentID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func roleEdges(q queryer) (map[int][]int, error) {
+	rows, err := q.Query("SELECT role_id, parent_id FROM role_parents")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edges := make(map[int][]int)
+	for rows.Next() {
+		var roleID, parentID int
+		if err := rows.Scan(&roleID, &parentID); err != nil {
+			return nil, err
+		}
+		edges[roleID] = append(edges[roleID], parentID)
+	}
+	return edges, rows.Err()
+}
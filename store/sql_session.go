@@ -0,0 +1,147 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+const selectSessions = `
+	SELECT id, user_id, tenant_id, family_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at
+	FROM sessions
+`
+
+func (s *SQLStore) CreateSession(session Session) (int, error) {
+	now := time.Now().UTC()
+	id, err := s.db.Insert(`
+		INSERT INTO sessions (user_id, tenant_id, family_id, user_agent, ip, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, session.UserID, nullableID(session.TenantID), session.FamilyID, nullableString(session.UserAgent),
+		nullableString(session.IP), now, now, session.ExpiresAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *SQLStore) GetSession(id int) (*Session, error) {
+	sessions, err := s.querySessions(selectSessions+"WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, apperrors.ErrSessionNotFound
+	}
+	return &sessions[0], nil
+}
+
+func (s *SQLStore) GetUserSessions(userID int) ([]Session, error) {
+	return s.querySessions(selectSessions+"WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY id",
+		userID, time.Now().UTC())
+}
+
+func (s *SQLStore) TouchSession(id int, ip string, expiresAt time.Time) error {
+	query := "UPDATE sessions SET last_used_at = ?"
+	args := []interface{}{time.Now().UTC()}
+	if ip != "" {
+		query += ", ip = ?"
+		args = append(args, ip)
+	}
+	if !expiresAt.IsZero() {
+		query += ", expires_at = ?"
+		args = append(args, expiresAt.UTC())
+	}
+	_, err := s.db.Exec(query+" WHERE id = ?", append(args, id)...)
+	return err
+}
+
+func (s *SQLStore) RevokeSession(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var familyID string
+	err = tx.QueryRow("SELECT family_id FROM sessions WHERE id = ?", id).Scan(&familyID)
+	if err == sql.ErrNoRows {
+		return apperrors.ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", now, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", now, familyID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) RevokeUserSessions(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	found, err := exists(tx, "SELECT 1 FROM users WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrUserNotFound
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", now, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", now, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteExpiredSessions(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE expires_at < ?", before.UTC())
+	return err
+}
+
+func (s *SQLStore) querySessions(query string, args ...interface{}) ([]Session, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		var tenantID sql.NullInt64
+		var userAgent, ip sql.NullString
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&session.ID, &session.UserID, &tenantID, &session.FamilyID, &userAgent, &ip,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		session.TenantID = int(tenantID.Int64)
+		session.UserAgent = userAgent.String
+		session.IP = ip.String
+		session.RevokedAt = revokedAt.Time
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
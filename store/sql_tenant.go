@@ -0,0 +1,250 @@
+package store
+
+import (
+	"database/sql"
+
+	apperrors "rbac/errors"
+)
+
+func (s *SQLStore) GetTenants() ([]Tenant, error) {
+	rows, err := s.db.Query("SELECT id, name FROM tenants ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []Tenant
+	for rows.Next() {
+		var tenant Tenant
+		if err := rows.Scan(&tenant.ID, &tenant.Name); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
+
+func (s *SQLStore) GetTenant(id int) (*Tenant, error) {
+	var tenant Tenant
+	err := s.db.QueryRow("SELECT id, name FROM tenants WHERE id = ?", id).Scan(&tenant.ID, &tenant.Name)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func (s *SQLStore) CreateTenant(name string) (int, error) {
+	taken, err := exists(s.db, "SELECT 1 FROM tenants WHERE name = ?", name)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, apperrors.ErrDuplicateTenant
+	}
+
+	tenantID, err := s.db.Insert("INSERT INTO tenants (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	return int(tenantID), nil
+}
+
+func (s *SQLStore) UpdateTenant(tenant Tenant) error {
+	taken, err := exists(s.db, "SELECT 1 FROM tenants WHERE name = ? AND id <> ?", tenant.Name, tenant.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return apperrors.ErrDuplicateTenant
+	}
+
+	result, err := s.db.Exec("UPDATE tenants SET name = ? WHERE id = ?", tenant.Name, tenant.ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		found, err := exists(s.db, "SELECT 1 FROM tenants WHERE id = ?", tenant.ID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return apperrors.ErrTenantNotFound
+		}
+	}
+	return nil
+}
+
+// DeleteTenant removes the tenant together with its roles and every role
+// assignment made within it.
+func (s *SQLStore) DeleteTenant(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM tenant_user_roles WHERE tenant_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM resource_role_bindings WHERE tenant_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM role_permissions WHERE role_id IN (SELECT id FROM roles WHERE tenant_id = ?)", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM role_parents
+		WHERE role_id IN (SELECT id FROM roles WHERE tenant_id = ?)
+		OR parent_id IN (SELECT id FROM roles WHERE tenant_id = ?)
+	`, id, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM roles WHERE tenant_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM tenants WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrTenantNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetTenantUsers(tenantID int) ([]User, error) {
+	found, err := exists(s.db, "SELECT 1 FROM tenants WHERE id = ?", tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, apperrors.ErrTenantNotFound
+	}
+
+	rows, err := s.db.Query(`
+		SELECT DISTINCT u.id, u.username FROM users u
+		JOIN tenant_user_roles tur ON u.id = tur.user_id
+		WHERE tur.tenant_id = ?
+		ORDER BY u.id
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		users[i].Roles, users[i].RoleConditions, err = s.getUserTenantRoles(tenantID, users[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+func (s *SQLStore) GetUserTenantRoles(tenantID, userID int) ([]string, map[string]string, error) {
+	found, err := exists(s.db, "SELECT 1 FROM tenants WHERE id = ?", tenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, apperrors.ErrTenantNotFound
+	}
+
+	found, err = exists(s.db, "SELECT 1 FROM users WHERE id = ?", userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, apperrors.ErrUserNotFound
+	}
+
+	return s.getUserTenantRoles(tenantID, userID)
+}
+
+func (s *SQLStore) SetUserTenantRoles(tenantID, userID int, roles []string, conditions map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	found, err := exists(tx, "SELECT 1 FROM tenants WHERE id = ?", tenantID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrTenantNotFound
+	}
+
+	found, err = exists(tx, "SELECT 1 FROM users WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrUserNotFound
+	}
+
+	_, err = tx.Exec("DELETE FROM tenant_user_roles WHERE tenant_id = ? AND user_id = ?", tenantID, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, roleName := range roles {
+		roleID, err := lookupTenantRoleID(tx, roleName, tenantID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO tenant_user_roles (tenant_id, user_id, role_id, condition_expr) VALUES (?, ?, ?, ?)",
+			tenantID, userID, roleID, nullableString(conditions[roleName]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) getUserTenantRoles(tenantID, userID int) ([]string, map[string]string, error) {
+	return queryConditional(s.db, `
+		SELECT r.name, tur.condition_expr FROM roles r
+		JOIN tenant_user_roles tur ON r.id = tur.role_id
+		WHERE tur.tenant_id = ? AND tur.user_id = ?
+	`, tenantID, userID)
+}
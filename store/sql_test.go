@@ -0,0 +1,461 @@
+package store_test
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	apperrors "rbac/errors"
+	"rbac/migrations"
+	"rbac/store"
+
+	_ "modernc.org/sqlite"
+)
+
+// newSQLiteStore opens a migrated SQLite database in a temporary directory.
+func newSQLiteStore(t *testing.T) *store.SQLStore {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "rbac.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open(store.SQLite.DriverName(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.NewMigrator(db, store.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	return store.NewSQLStore(db, store.SQLite)
+}
+
+func TestSQLStoreCreateUser(t *testing.T) {
+	s := newSQLiteStore(t)
+	if _, err := s.CreatePermission("read_reports"); err != nil {
+		t.Fatal(err)
+	}
+	roleID, err := s.CreateRole(store.Role{Name: "editor", Permissions: []string{"read_reports"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roleID == 0 {
+		t.Fatal("CreateRole returned no ID")
+	}
+
+	first, err := s.CreateUser(store.User{Username: "alice", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.CreateUser(store.User{
+		Username:       "bob",
+		Password:       "hash",
+		Roles:          []string{"editor"},
+		RoleConditions: map[string]string{"editor": `user.department == "sales"`},
+		Attributes:     map[string]string{"department": "sales"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == 0 || second <= first {
+		t.Fatalf("user IDs %d, %d: want increasing inserted IDs", first, second)
+	}
+
+	user, err := s.GetUser(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != second || user.Username != "bob" {
+		t.Errorf("GetUser = %d %q, want %d %q", user.ID, user.Username, second, "bob")
+	}
+	if !reflect.DeepEqual(user.Roles, []string{"editor"}) {
+		t.Errorf("roles %v, want [editor]", user.Roles)
+	}
+	if user.RoleConditions["editor"] != `user.department == "sales"` {
+		t.Errorf("role conditions %v", user.RoleConditions)
+	}
+	if user.Attributes["department"] != "sales" {
+		t.Errorf("attributes %v", user.Attributes)
+	}
+
+	disabledID, err := s.CreateUser(store.User{Username: "dave", Disabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disabled, err := s.GetUser(disabledID); err != nil || !disabled.Disabled {
+		t.Errorf("user created disabled: %+v, %v", disabled, err)
+	}
+
+	if _, err := s.CreateUser(store.User{Username: "alice"}); !errors.Is(err, apperrors.ErrDuplicateUsername) {
+		t.Errorf("duplicate username: %v, want %v", err, apperrors.ErrDuplicateUsername)
+	}
+	if _, err := s.CreateUser(store.User{Username: "carol", Roles: []string{"missing"}}); !errors.Is(err, apperrors.ErrInvalidRole) {
+		t.Errorf("unknown role: %v, want %v", err, apperrors.ErrInvalidRole)
+	}
+	if _, err := s.GetUserByUsername("carol"); !errors.Is(err, apperrors.ErrUserNotFound) {
+		t.Errorf("user with unknown role was created: %v", err)
+	}
+}
+
+func TestSQLStoreNotFound(t *testing.T) {
+	s := newSQLiteStore(t)
+	const missing = 999
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"GetUser", func() error { _, err := s.GetUser(missing); return err }, apperrors.ErrUserNotFound},
+		{"GetUserByUsername", func() error { _, err := s.GetUserByUsername("nobody"); return err }, apperrors.ErrUserNotFound},
+		{"UpdateUser", func() error { return s.UpdateUser(store.User{ID: missing, Username: "nobody"}) }, apperrors.ErrUserNotFound},
+		{"SetUserDisabled", func() error { return s.SetUserDisabled(missing, true) }, apperrors.ErrUserNotFound},
+		{"GetRole", func() error { _, err := s.GetRole(missing); return err }, apperrors.ErrRoleNotFound},
+		{"UpdateRole", func() error { return s.UpdateRole(store.Role{ID: missing, Name: "nobody"}) }, apperrors.ErrRoleNotFound},
+		{"DeleteRole", func() error { return s.DeleteRole(missing) }, apperrors.ErrRoleNotFound},
+		{"GetPermission", func() error { _, err := s.GetPermission(missing); return err }, apperrors.ErrPermissionNotFound},
+		{"UpdatePermission", func() error { return s.UpdatePermission(missing, "nobody") }, apperrors.ErrPermissionNotFound},
+		{"GetGroup", func() error { _, err := s.GetGroup(missing); return err }, apperrors.ErrGroupNotFound},
+		{"GetTenant", func() error { _, err := s.GetTenant(missing); return err }, apperrors.ErrTenantNotFound},
+		{"GetSession", func() error { _, err := s.GetSession(missing); return err }, apperrors.ErrSessionNotFound},
+		{"RevokeSession", func() error { return s.RevokeSession(missing) }, apperrors.ErrSessionNotFound},
+		{"RevokeUserSessions", func() error { return s.RevokeUserSessions(missing) }, apperrors.ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Errorf("error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLStoreUpdateUserDisabled(t *testing.T) {
+	s := newSQLiteStore(t)
+	userID, err := s.CreateUser(store.User{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateSession(store.Session{UserID: userID, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	disabled := true
+	if err := s.UpdateUser(store.User{ID: userID, Username: "alice", SetDisabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.GetUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.Disabled {
+		t.Error("user not disabled")
+	}
+	sessions, err := s.GetUserSessions(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("%d sessions left after disabling", len(sessions))
+	}
+
+	if err := s.UpdateUser(store.User{ID: userID, Username: "alice2"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err = s.GetUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.Disabled {
+		t.Error("update without SetDisabled enabled the user")
+	}
+}
+
+func TestSQLStoreGetUsersByUsernameFold(t *testing.T) {
+	s := newSQLiteStore(t)
+	if _, err := s.CreateUser(store.User{Username: "Alice", Password: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser(store.User{Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := s.GetUsersByUsernameFold("ALICE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Username != "Alice" {
+		t.Fatalf("users %+v, want Alice", users)
+	}
+	if users[0].Password != "" {
+		t.Error("password returned")
+	}
+}
+
+func TestSQLStoreRoles(t *testing.T) {
+	s := newSQLiteStore(t)
+	userID, err := s.CreateUser(store.User{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.CreateRoleWithMembers(store.Role{Name: "ops"}, []int{userID, 999}); !errors.Is(err, apperrors.ErrUserNotFound) {
+		t.Fatalf("unknown member: %v, want %v", err, apperrors.ErrUserNotFound)
+	}
+	roles, err := s.GetRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range roles {
+		if role.Name == "ops" {
+			t.Fatal("refused creation left the role behind")
+		}
+	}
+
+	roleID, err := s.CreateRoleWithMembers(store.Role{Name: "ops"}, []int{userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := s.GetRoleUsers(roleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].ID != userID {
+		t.Errorf("members %+v, want alice", members)
+	}
+	if _, err := s.CreateRole(store.Role{Name: "ops"}); !errors.Is(err, apperrors.ErrDuplicateRole) {
+		t.Errorf("duplicate role: %v, want %v", err, apperrors.ErrDuplicateRole)
+	}
+
+	requireMFA := true
+	if err := s.UpdateRole(store.Role{ID: roleID, Name: "ops", SetRequireMFA: &requireMFA}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateRole(store.Role{ID: roleID, Name: "operations"}); err != nil {
+		t.Fatal(err)
+	}
+	role, err := s.GetRole(roleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.Name != "operations" || !role.RequireMFA {
+		t.Errorf("role %q require_mfa %v, want operations true", role.Name, role.RequireMFA)
+	}
+}
+
+func TestRoleParents(t *testing.T) {
+	stores := map[string]store.Store{
+		"memory": store.NewMemoryStore(),
+		"sqlite": newSQLiteStore(t),
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			tenantID, err := s.CreateTenant("acme")
+			if err != nil {
+				t.Fatal(err)
+			}
+			globalBase, err := s.CreateRole(store.Role{Name: "base"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			globalViewer, err := s.CreateRole(store.Role{Name: "viewer"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tenantBase, err := s.CreateRole(store.Role{Name: "base", TenantID: tenantID})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			global, err := s.CreateRole(store.Role{Name: "editor", Parents: []string{"base"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tenant, err := s.CreateRole(store.Role{Name: "editor", TenantID: tenantID, Parents: []string{"base", "viewer"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				roleID int
+				want   []int
+			}{
+				{global, []int{globalBase}},
+				{tenant, []int{tenantBase, globalViewer}},
+			}
+			for _, tt := range tests {
+				role, err := s.GetRole(tt.roleID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := append([]int(nil), role.ParentIDs...)
+				sort.Ints(got)
+				want := append([]int(nil), tt.want...)
+				sort.Ints(want)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("role %d parents %v, want %v", tt.roleID, got, want)
+				}
+			}
+
+			if err := s.UpdateRole(store.Role{ID: globalBase, Name: "base", Parents: []string{"editor"}}); !errors.Is(err, apperrors.ErrRoleCycle) {
+				t.Errorf("indirect cycle: %v, want %v", err, apperrors.ErrRoleCycle)
+			}
+			if err := s.UpdateRole(store.Role{ID: globalViewer, Name: "viewer", Parents: []string{"viewer"}}); !errors.Is(err, apperrors.ErrRoleCycle) {
+				t.Errorf("self parent: %v, want %v", err, apperrors.ErrRoleCycle)
+			}
+			// Within the tenant, editor names the tenant's own editor, which
+			// already inherits from the tenant's base.
+			if err := s.UpdateRole(store.Role{ID: tenantBase, Name: "base", Parents: []string{"editor"}}); !errors.Is(err, apperrors.ErrRoleCycle) {
+				t.Errorf("cycle through tenant role: %v, want %v", err, apperrors.ErrRoleCycle)
+			}
+		})
+	}
+}
+
+func TestSetUserTenantRoles(t *testing.T) {
+	stores := map[string]store.Store{
+		"memory": store.NewMemoryStore(),
+		"sqlite": newSQLiteStore(t),
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			tenantID, err := s.CreateTenant("acme")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CreateRole(store.Role{Name: "superuser"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CreateRole(store.Role{Name: "editor", TenantID: tenantID}); err != nil {
+				t.Fatal(err)
+			}
+			userID, err := s.CreateUser(store.User{Username: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.SetUserTenantRoles(tenantID, userID, []string{"editor"}, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetUserTenantRoles(tenantID, userID, []string{"editor", "superuser"}, nil); !errors.Is(err, apperrors.ErrInvalidRole) {
+				t.Fatalf("global role: %v, want %v", err, apperrors.ErrInvalidRole)
+			}
+			roles, _, err := s.GetUserTenantRoles(tenantID, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(roles, []string{"editor"}) {
+				t.Errorf("tenant roles %v after refused assignment, want [editor]", roles)
+			}
+		})
+	}
+}
+
+func TestSQLStoreDeletePermission(t *testing.T) {
+	s := newSQLiteStore(t)
+	viewID, err := s.CreatePermission("read_report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	editID, err := s.CreatePermission("approve_report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	editorID, err := s.CreateRole(store.Role{Name: "editor", Permissions: []string{"read_report", "approve_report"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateRole(store.Role{Name: "intern", DeniedPermissions: []string{"approve_report"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeletePermission(editID, false); !errors.Is(err, apperrors.ErrPermissionInUse) {
+		t.Fatalf("without cascade: %v, want %v", err, apperrors.ErrPermissionInUse)
+	}
+	roles, err := s.GetPermissionRoles(editID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(roles)
+	if !reflect.DeepEqual(roles, []string{"editor", "intern"}) {
+		t.Fatalf("roles %v after refused delete, want [editor intern]", roles)
+	}
+
+	if err := s.DeletePermission(editID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetPermission(editID); !errors.Is(err, apperrors.ErrPermissionNotFound) {
+		t.Errorf("permission after cascade delete: %v", err)
+	}
+	if roles, err := s.GetPermissionRoles(editID); err != nil || len(roles) != 0 {
+		t.Errorf("role_permissions rows left: %v, %v", roles, err)
+	}
+	editor, err := s.GetRole(editorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(editor.Permissions, []string{"read_report"}) {
+		t.Errorf("editor grants %v, want [read_report]", editor.Permissions)
+	}
+	if roles, err := s.GetPermissionRoles(viewID); err != nil || len(roles) != 1 {
+		t.Errorf("other permission's roles %v, %v", roles, err)
+	}
+}
+
+// Concurrent failures, including the first ones for a user, each count
+// once instead of racing to insert the lockout row.
+func TestSQLStoreAddMFAAttempt(t *testing.T) {
+	s := newSQLiteStore(t)
+	userID, err := s.CreateUser(store.User{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	attempts := make([]int, n)
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempts[i], errs[i] = s.AddMFAAttempt(userID)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Ints(attempts)
+	for i, got := range attempts {
+		if got != i+1 {
+			t.Fatalf("attempt counts %v, want 1 to %d", attempts, n)
+		}
+	}
+
+	if err := s.LockMFA(userID, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.AddMFAAttempt(userID); err != nil || got != 1 {
+		t.Errorf("attempt after locking: %d, %v; want 1", got, err)
+	}
+	lockout, err := s.GetMFALockout(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockout.LockedUntil.IsZero() {
+		t.Error("counting an attempt cleared the lock")
+	}
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *SQLStore) CreateRefreshToken(token RefreshToken) (int, error) {
+	id, err := s.db.Insert(`
+		INSERT INTO refresh_tokens (user_id, tenant_id, family_id, token_hash, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, token.UserID, nullableID(token.TenantID), token.FamilyID, token.TokenHash, token.ExpiresAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *SQLStore) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	var tenantID sql.NullInt64
+	var usedAt, revokedAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT id, user_id, tenant_id, family_id, token_hash, expires_at, used_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = ?
+	`, tokenHash).Scan(&token.ID, &token.UserID, &tenantID, &token.FamilyID, &token.TokenHash,
+		&token.ExpiresAt, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.TenantID = int(tenantID.Int64)
+	token.UsedAt = usedAt.Time
+	token.RevokedAt = revokedAt.Time
+	return &token, nil
+}
+
+func (s *SQLStore) UseRefreshToken(id int) (bool, error) {
+	result, err := s.db.Exec("UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (s *SQLStore) RevokeRefreshTokenFamily(userID int, familyID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL", now, userID, familyID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL", now, userID, familyID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) DeleteExpiredRefreshTokens(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM refresh_tokens WHERE expires_at < ?", before.UTC())
+	return err
+}
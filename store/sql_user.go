@@ -0,0 +1,373 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	apperrors "rbac/errors"
+)
+
+func (s *SQLStore) CreateUser(user User) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := createUser(tx, user)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(userID), nil
+}
+
+func createUser(tx *dialectTx, user User) (int64, error) {
+	taken, err := exists(tx, "SELECT 1 FROM users WHERE username = ?", user.Username)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, apperrors.ErrDuplicateUsername
+	}
+
+	attributes, err := encodeAttributes(user.Attributes)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := tx.Insert("INSERT INTO users (username, password, disabled, attributes) VALUES (?, ?, ?, ?)",
+		user.Username, user.Password, user.Disabled, attributes)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := assignRoles(tx, userID, user.Roles, user.RoleConditions); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (s *SQLStore) GetUsers(limit, offset int) ([]User, error) {
+	return s.queryUsers(`
+		SELECT u.id, u.username, u.disabled, u.attributes
+		FROM users u
+		ORDER BY u.id
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+}
+
+func (s *SQLStore) GetUsersByUsernameFold(username string) ([]User, error) {
+	return s.queryUsers(`
+		SELECT u.id, u.username, u.disabled, u.attributes
+		FROM users u
+		WHERE LOWER(u.username) = LOWER(?)
+		ORDER BY u.id
+	`, username)
+}
+
+// queryUsers reads the users a query selects the ID, username, disabled
+// flag and attributes of, with their roles but not their password.
+func (s *SQLStore) queryUsers(query string, args ...interface{}) ([]User, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		var attributes sql.NullString
+		if err := rows.Scan(&user.ID, &user.Username, &user.Disabled, &attributes); err != nil {
+			return nil, err
+		}
+		if user.Attributes, err = decodeAttributes(attributes); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		users[i].Roles, users[i].RoleConditions, err = s.getUserRoles(users[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+func (s *SQLStore) CountUsers() (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
+
+func (s *SQLStore) GetUser(id int) (*User, error) {
+	return s.getUserBy("id", id)
+}
+
+func (s *SQLStore) GetUserByUsername(username string) (*User, error) {
+	return s.getUserBy("username", username)
+}
+
+func (s *SQLStore) getUserBy(column string, value interface{}) (*User, error) {
+	var user User
+	var attributes sql.NullString
+	err := s.db.QueryRow("SELECT id, username, password, disabled, attributes FROM users WHERE "+column+" = ?", value).
+		Scan(&user.ID, &user.Username, &user.Password, &user.Disabled, &attributes)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user.Attributes, err = decodeAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Roles, user.RoleConditions, err = s.getUserRoles(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *SQLStore) UpdateUser(user User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	found, err := exists(tx, "SELECT 1 FROM users WHERE id = ?", user.ID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperrors.ErrUserNotFound
+	}
+
+	taken, err := exists(tx, "SELECT 1 FROM users WHERE username = ? AND id <> ?", user.Username, user.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return apperrors.ErrDuplicateUsername
+	}
+
+	_, err = tx.Exec("UPDATE users SET username = ? WHERE id = ?", user.Username, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if user.Attributes != nil {
+		attributes, err := encodeAttributes(user.Attributes)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE users SET attributes = ? WHERE id = ?", attributes, user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if user.Roles != nil {
+		_, err = tx.Exec("DELETE FROM user_roles WHERE user_id = ?", user.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := assignRoles(tx, int64(user.ID), user.Roles, user.RoleConditions); err != nil {
+			return err
+		}
+	}
+
+	if user.SetDisabled != nil {
+		if err := setUserDisabled(tx, user.ID, *user.SetDisabled); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) SetUserDisabled(id int, disabled bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE users SET disabled = ? WHERE id = ?", disabled, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		found, err := exists(tx, "SELECT 1 FROM users WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return apperrors.ErrUserNotFound
+		}
+	}
+
+	if err := revokeDisabledUser(tx, id, disabled); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setUserDisabled is SetUserDisabled for a user known to exist.
+func setUserDisabled(tx *dialectTx, id int, disabled bool) error {
+	_, err := tx.Exec("UPDATE users SET disabled = ? WHERE id = ?", disabled, id)
+	if err != nil {
+		return err
+	}
+	return revokeDisabledUser(tx, id, disabled)
+}
+
+// revokeDisabledUser revokes the sessions and refresh tokens of a user
+// being disabled.
+func revokeDisabledUser(tx *dialectTx, id int, disabled bool) error {
+	if !disabled {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	_, err := tx.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", now, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", now, id)
+	return err
+}
+
+func (s *SQLStore) DeleteUser(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM user_roles WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM group_members WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM tenant_user_roles WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM resource_role_bindings WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM refresh_tokens WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM sessions WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM oauth_codes WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_identities WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM user_totp WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM mfa_challenges WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM mfa_lockouts WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return apperrors.ErrUserNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) getUserRoles(userID int) ([]string, map[string]string, error) {
+	return queryConditional(s.db, `
+		SELECT r.name, ur.condition_expr FROM roles r
+		JOIN user_roles ur ON r.id = ur.role_id
+		WHERE ur.user_id = ?
+	`, userID)
+}
+
+func encodeAttributes(attributes map[string]string) (interface{}, error) {
+	if len(attributes) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+func decodeAttributes(encoded sql.NullString) (map[string]string, error) {
+	if encoded.String == "" {
+		return nil, nil
+	}
+	var attributes map[string]string
+	err := json.Unmarshal([]byte(encoded.String), &attributes)
+	return attributes, err
+}
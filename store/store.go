@@ -0,0 +1,373 @@
+package store
+
+import "time"
+
+// User.RoleConditions maps an assigned role name to the condition under
+// which the assignment holds; roles without an entry hold unconditionally.
+// On update nil Roles or Attributes leave the stored values unchanged, and
+// RoleConditions is only written together with Roles. Disabled is written
+// by CreateUser but not by UpdateUser; a non-nil SetDisabled is, disabling
+// or enabling the user as SetUserDisabled does.
+type User struct {
+	ID             int
+	Username       string
+	Password       string
+	Disabled       bool
+	SetDisabled    *bool
+	Roles          []string
+	RoleConditions map[string]string
+	Attributes     map[string]string
+}
+
+// Role.Permissions and Role.Parents hold names. On update a nil slice leaves
+// the stored value unchanged. A TenantID of 0 marks a global role; a tenant
+// role's parents are resolved among that tenant's roles first, then the
+// global ones. PermissionConditions maps a permission name to the condition
+// under which the grant holds and is only written together with Permissions.
+// RequireMFA is written by CreateRole; UpdateRole writes SetRequireMFA
+// instead, leaving the stored value unchanged when it is nil.
+type Role struct {
+	ID                   int
+	Name                 string
+	TenantID             int
+	Permissions          []string
+	DeniedPermissions    []string
+	PermissionConditions map[string]string
+	Parents              []string
+	ParentIDs            []int
+	RequireMFA           bool
+	SetRequireMFA        *bool
+}
+
+type Permission struct {
+	ID   int
+	Name string
+}
+
+// Group.Roles holds role names. On update a nil slice leaves the stored
+// value unchanged.
+type Group struct {
+	ID    int
+	Name  string
+	Roles []string
+}
+
+type Tenant struct {
+	ID   int
+	Name string
+}
+
+// ResourceBinding grants a role to a user on resources of one type only.
+// ResourceID is an exact ID, a prefix ending in "*" or "*" for every
+// resource of the type. Role is resolved within TenantID like any tenant
+// assignment, and a binding with a TenantID only applies in that tenant.
+type ResourceBinding struct {
+	ID           int
+	UserID       int
+	RoleID       int
+	Role         string
+	TenantID     int
+	ResourceType string
+	ResourceID   string
+	Condition    string
+}
+
+type UserStore interface {
+	CreateUser(user User) (int, error)
+	GetUsers(limit, offset int) ([]User, error)
+	CountUsers() (int, error)
+	GetUser(id int) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	// GetUsersByUsernameFold returns the users whose username matches
+	// ignoring case, without their password.
+	GetUsersByUsernameFold(username string) ([]User, error)
+	UpdateUser(user User) error
+	// SetUserDisabled disables or enables a user. Disabling revokes the
+	// user's sessions.
+	SetUserDisabled(id int, disabled bool) error
+	DeleteUser(id int) error
+}
+
+type RoleStore interface {
+	GetRoles() ([]Role, error)
+	GetRole(id int) (*Role, error)
+	// GetRoleUsers returns the users assigned the role outside tenants,
+	// with their ID and username only.
+	GetRoleUsers(id int) ([]User, error)
+	CreateRole(role Role) (int, error)
+	// CreateRoleWithMembers creates the role and assigns it outside tenants
+	// to the users members. Nothing is created if a user does not exist.
+	CreateRoleWithMembers(role Role, members []int) (int, error)
+	UpdateRole(role Role) error
+	DeleteRole(id int) error
+	// SetRoleMembers renames the role and assigns it outside tenants to
+	// exactly the users members, keeping the conditions of the assignments
+	// that remain. Nothing changes if the name is taken or a user does not
+	// exist.
+	SetRoleMembers(id int, name string, members []int) error
+}
+
+type PermissionStore interface {
+	GetPermissions() ([]Permission, error)
+	GetPermission(id int) (*Permission, error)
+	GetPermissionRoles(id int) ([]string, error)
+	CreatePermission(name string) (int, error)
+	UpdatePermission(id int, name string) error
+	DeletePermission(id int, cascade bool) error
+}
+
+type GroupStore interface {
+	GetGroups() ([]Group, error)
+	GetGroup(id int) (*Group, error)
+	CreateGroup(group Group) (int, error)
+	UpdateGroup(group Group) error
+	DeleteGroup(id int) error
+	GetGroupMembers(id int) ([]User, error)
+	AddGroupMember(groupID, userID int) error
+	RemoveGroupMember(groupID, userID int) error
+	GetUserGroups(userID int) ([]Group, error)
+}
+
+// Roles assigned within a tenant are named among the tenant's own roles
+// only; global roles are assigned to the user and hold in every tenant.
+type TenantStore interface {
+	GetTenants() ([]Tenant, error)
+	GetTenant(id int) (*Tenant, error)
+	CreateTenant(name string) (int, error)
+	UpdateTenant(tenant Tenant) error
+	DeleteTenant(id int) error
+	GetTenantUsers(tenantID int) ([]User, error)
+	GetUserTenantRoles(tenantID, userID int) ([]string, map[string]string, error)
+	SetUserTenantRoles(tenantID, userID int, roles []string, conditions map[string]string) error
+}
+
+type BindingStore interface {
+	GetResourceBindings() ([]ResourceBinding, error)
+	GetUserResourceBindings(userID int) ([]ResourceBinding, error)
+	CreateResourceBinding(binding ResourceBinding) (int, error)
+	DeleteResourceBinding(id int) error
+}
+
+// Change records that what a user, or every user when UserID is 0, is
+// authorized to do may have changed.
+type Change struct {
+	ID     int
+	UserID int
+}
+
+type ChangeStore interface {
+	RecordChange(userID int) (int, error)
+	GetChangesSince(id int) ([]Change, error)
+	LatestChangeID() (int, error)
+	PruneChanges(before time.Time) error
+}
+
+// RefreshToken is the record of an issued refresh token. Only a hash of the
+// token is kept. The tokens rotated from one login share a FamilyID. Zero
+// UsedAt and RevokedAt mean not used and not revoked.
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	TenantID  int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    time.Time
+	RevokedAt time.Time
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(token RefreshToken) (int, error)
+	GetRefreshToken(tokenHash string) (*RefreshToken, error)
+	// UseRefreshToken marks the token used, reporting false if it already was.
+	UseRefreshToken(id int) (bool, error)
+	// RevokeRefreshTokenFamily revokes the tokens and the session of the
+	// user's family.
+	RevokeRefreshTokenFamily(userID int, familyID string) error
+	DeleteExpiredRefreshTokens(before time.Time) error
+}
+
+// Session is one login. Its refresh tokens form the family FamilyID, and
+// access tokens carry its ID. ExpiresAt moves with every refresh.
+type Session struct {
+	ID         int
+	UserID     int
+	TenantID   int
+	FamilyID   string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  time.Time
+}
+
+type SessionStore interface {
+	CreateSession(session Session) (int, error)
+	GetSession(id int) (*Session, error)
+	// GetUserSessions returns the sessions that are neither revoked nor
+	// expired.
+	GetUserSessions(userID int) ([]Session, error)
+	// TouchSession sets the last use to now, and the IP and expiry unless
+	// they are empty.
+	TouchSession(id int, ip string, expiresAt time.Time) error
+	// RevokeSession revokes the session and its refresh tokens.
+	RevokeSession(id int) error
+	RevokeUserSessions(userID int) error
+	DeleteExpiredSessions(before time.Time) error
+}
+
+// OAuthClient is an application that signs users in through the OpenID
+// Connect provider. A public client has no SecretHash.
+type OAuthClient struct {
+	ID           int
+	ClientID     string
+	Name         string
+	SecretHash   string
+	RedirectURIs []string
+}
+
+// AuthorizationCode is a pending authorization, stored under the hash of
+// the code handed to the client.
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        int
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+}
+
+type OAuthStore interface {
+	GetOAuthClients() ([]OAuthClient, error)
+	GetOAuthClient(clientID string) (*OAuthClient, error)
+	CreateOAuthClient(client OAuthClient) (int, error)
+	DeleteOAuthClient(id int) error
+	CreateAuthorizationCode(code AuthorizationCode) error
+	// UseAuthorizationCode returns the code and deletes it, so that it can
+	// be redeemed once.
+	UseAuthorizationCode(codeHash string) (*AuthorizationCode, error)
+	DeleteExpiredAuthorizationCodes(before time.Time) error
+}
+
+// Identity links a user to their account at an external identity provider.
+type Identity struct {
+	ID       int
+	UserID   int
+	Provider string
+	Subject  string
+}
+
+// LoginState is a sign-in through an identity provider that has not come
+// back yet, stored under the hash of its state parameter.
+type LoginState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	TenantID     int
+	ExpiresAt    time.Time
+}
+
+type IdentityStore interface {
+	GetIdentity(provider, subject string) (*Identity, error)
+	// CreateIdentityUser creates a user linked to the identity.
+	CreateIdentityUser(user User, identity Identity) (int, error)
+	CreateLoginState(state LoginState) error
+	// UseLoginState returns the state and deletes it, so that it can be
+	// used once.
+	UseLoginState(stateHash string) (*LoginState, error)
+	DeleteExpiredLoginStates(before time.Time) error
+}
+
+// TOTP is a user's authenticator app, sharing the base32 Secret. Its codes
+// only pass logins once it is Confirmed. LastStep is the time step of the
+// last code accepted; codes of that step and earlier are refused.
+type TOTP struct {
+	UserID    int
+	Secret    string
+	Confirmed bool
+	LastStep  int64
+}
+
+// RecoveryCode is an unused recovery code of a user, of which only a bcrypt
+// hash is stored.
+type RecoveryCode struct {
+	ID       int
+	UserID   int
+	CodeHash string
+}
+
+// MFALockout counts a user's second-factor attempts since the last that
+// passed. While LockedUntil is in the future their codes are refused.
+type MFALockout struct {
+	UserID      int
+	Attempts    int
+	LockedUntil time.Time
+}
+
+// MFAChallenge is a login that passed the password check and waits for a
+// second factor, stored under the hash of its token.
+type MFAChallenge struct {
+	TokenHash string
+	UserID    int
+	TenantID  int
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+type MFAStore interface {
+	GetTOTP(userID int) (*TOTP, error)
+	// CreateTOTP starts an enrollment, replacing the user's current one.
+	CreateTOTP(totp TOTP) error
+	// ConfirmTOTP confirms the enrollment and replaces the user's recovery
+	// codes.
+	ConfirmTOTP(userID int, recoveryCodeHashes []string) error
+	// UseTOTPStep records that a code of step was accepted, reporting false
+	// if one of that step or a later one already was.
+	UseTOTPStep(userID int, step int64) (bool, error)
+	// DeleteTOTP removes the enrollment and the recovery codes.
+	DeleteTOTP(userID int) error
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	// GetRecoveryCodes returns the user's unused recovery codes.
+	GetRecoveryCodes(userID int) ([]RecoveryCode, error)
+	// UseRecoveryCode marks the code used, reporting false if it already
+	// was.
+	UseRecoveryCode(userID, id int) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+	// GetMFALockout returns the user's attempts, with none counted if the
+	// user has no record.
+	GetMFALockout(userID int) (*MFALockout, error)
+	// AddMFAAttempt counts an attempt and returns the attempts so far.
+	AddMFAAttempt(userID int) (int, error)
+	// LockMFA refuses the user's codes until the given time and clears
+	// their attempts.
+	LockMFA(userID int, until time.Time) error
+	ResetMFAAttempts(userID int) error
+	CreateMFAChallenge(challenge MFAChallenge) error
+	GetMFAChallenge(tokenHash string) (*MFAChallenge, error)
+	// FailMFAChallenge counts a wrong code and returns the attempts so far.
+	FailMFAChallenge(tokenHash string) (int, error)
+	// DeleteMFAChallenge deletes the challenge, reporting false if it was
+	// already gone.
+	DeleteMFAChallenge(tokenHash string) (bool, error)
+	DeleteExpiredMFAChallenges(before time.Time) error
+}
+
+type Store interface {
+	UserStore
+	RoleStore
+	PermissionStore
+	GroupStore
+	TenantStore
+	BindingStore
+	ChangeStore
+	RefreshTokenStore
+	SessionStore
+	OAuthStore
+	IdentityStore
+	MFAStore
+}
@@ -1,53 +1,145 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token types, carried in the typ claim so that one kind of token cannot
+// be used in place of the other.
+// OAuthAccessToken is issued to OpenID Connect clients and only accepted
+// at userinfo.
+const (
+	AccessToken      = "access"
+	RefreshToken     = "refresh"
+	OAuthAccessToken = "oauth_access"
+)
+
+// Token lifetimes.
+const (
+	AccessTokenTTL  = 24 * time.Hour
+	RefreshTokenTTL = 7 * 24 * time.Hour
+	IDTokenTTL      = time.Hour
+
+	OAuthAccessTokenTTL = time.Hour
+)
+
+// Permissions, when present, are the user's effective permissions as of
+// PolicyVersion; see authz.TokenPolicy. SessionID names the login the token
+// belongs to. FamilyID is set on refresh tokens only and names the chain of
+// tokens rotated from that login. Scope is set on OAuth access tokens only.
 type JWTClaim struct {
-	UserID   int      `json:"user_id"`
-	Username string   `json:"username"`
-	Roles    []string `json:"roles"`
+	UserID        int      `json:"user_id"`
+	Username      string   `json:"username"`
+	Roles         []string `json:"roles"`
+	TenantID      int      `json:"tenant_id,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	PolicyVersion int      `json:"pv,omitempty"`
+	SessionID     int      `json:"sid,omitempty"`
+	Type          string   `json:"typ"`
+	FamilyID      string   `json:"fam,omitempty"`
+	Scope         string   `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID int, username string, roles []string) (string, string, error) {
-	claims := JWTClaim{
-		UserID:   userID,
-		Username: username,
-		Roles:    roles,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)), // 24 hours
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// GenerateJWT signs an access token carrying claims, with its registered
+// claims filled in, and a refresh token for the same user in the family.
+func GenerateJWT(claims JWTClaim, familyID string) (string, string, error) {
+	key := currentKeyring().signingKey()
+	now := time.Now()
+
+	// Refresh reads the user afresh, so only the IDs are carried.
+	refreshClaims := JWTClaim{
+		UserID:    claims.UserID,
+		TenantID:  claims.TenantID,
+		SessionID: claims.SessionID,
+		Type:      RefreshToken,
+		FamilyID:  familyID,
+	}
+
+	claims.Type = AccessToken
+	claims.FamilyID = ""
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	accessToken, err := key.sign(claims)
+	if err != nil {
+		return "", "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secretKey := []byte(os.Getenv("JWT_SECRET_KEY"))
-	accessToken, err := token.SignedString(secretKey)
+	// The random ID keeps every refresh token, and so its hash, unique.
+	jti, err := RandomID()
 	if err != nil {
 		return "", "", err
 	}
-	
-	refreshClaims := jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().AddDate(0, 0, 7)), // 7 days
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		Subject:   fmt.Sprintf("%d", userID),
+	refreshClaims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(RefreshTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Subject:   fmt.Sprintf("%d", claims.UserID),
+		ID:        jti,
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(secretKey)
+	refreshToken, err := key.sign(refreshClaims)
 
-	return accessToken, refreshTokenString, err
+	return accessToken, refreshToken, err
 }
 
-func ValidateJWT(tokenString string) (*JWTClaim, error) {
-	secretKey := []byte(os.Getenv("JWT_SECRET_KEY"))
+// GenerateOAuthAccessToken signs an access token for an OpenID Connect
+// client, carrying only the user and the scope granted to the client.
+func GenerateOAuthAccessToken(userID int, clientID, scope string) (string, error) {
+	now := time.Now()
+	return currentKeyring().signingKey().sign(JWTClaim{
+		UserID: userID,
+		Scope:  scope,
+		Type:   OAuthAccessToken,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   fmt.Sprintf("%d", userID),
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(OAuthAccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token. Issuer,
+// Subject and Audience are set by the caller.
+type IDTokenClaims struct {
+	Nonce             string   `json:"nonce,omitempty"`
+	AuthTime          int64    `json:"auth_time"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Roles             []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateIDToken signs an ID token valid for IDTokenTTL.
+func GenerateIDToken(claims IDTokenClaims) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(IDTokenTTL))
+	return currentKeyring().signingKey().sign(claims)
+}
+
+// SigningAlgorithm returns the algorithm new tokens are signed with.
+func SigningAlgorithm() string {
+	return currentKeyring().signingKey().Method.Alg()
+}
+
+// ValidateJWT parses a token, which must be of the given type.
+func ValidateJWT(tokenString, tokenType string) (*JWTClaim, error) {
+	ring := currentKeyring()
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaim{}, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
+		kid, _ := token.Header["kid"].(string)
+		key, err := ring.verificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		return key.verificationKey(token.Method)
 	})
 
 	if err != nil {
@@ -55,8 +147,35 @@ func ValidateJWT(tokenString string) (*JWTClaim, error) {
 	}
 
 	if claims, ok := token.Claims.(*JWTClaim); ok && token.Valid {
+		if claims.Type != tokenType {
+			return nil, fmt.Errorf("token is not a %s token", tokenType)
+		}
 		return claims, nil
 	}
 
 	return nil, fmt.Errorf("invalid token")
-} 
\ No newline at end of file
+}
+
+// sign signs claims, naming the key in the kid header.
+func (k *SigningKey) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.Method, claims)
+	if k.ID != "" {
+		token.Header["kid"] = k.ID
+	}
+	return token.SignedString(k.Private)
+}
+
+// HashToken returns the hex SHA-256 of a token, under which it is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomID returns 128 random bits in hex.
+func RandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,365 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key statuses. A pending key is published but does not sign yet, so that
+// every replica and every JWKS cache knows it before its first token.
+const (
+	KeyPending  = "pending"
+	KeyActive   = "active"
+	KeyRetiring = "retiring"
+)
+
+// MaxTokenLifetime is how long a key has to keep verifying tokens after
+// it stopped signing.
+const MaxTokenLifetime = RefreshTokenTTL
+
+// keyTimeFormat names key files, which start with the time the key becomes
+// active: 20240501T120000Z_<kid>.pem, or .key holding an HS256 secret.
+const keyTimeFormat = "20060102T150405Z"
+
+type KeyInfo struct {
+	ID          string     `json:"kid"`
+	Algorithm   string     `json:"alg"`
+	Status      string     `json:"status"`
+	ActivatesAt *time.Time `json:"activates_at,omitempty"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Keyring holds the key tokens are signed with and the older keys that
+// still verify tokens, selected by the kid header. Keys come from the
+// configuration, or from a directory that RotateKeys adds keys to and that
+// Run reloads.
+type Keyring struct {
+	dir string
+
+	mu   sync.RWMutex
+	keys []ringKey
+}
+
+// ringKey is a loaded key. A zero activatesAt orders it by position: the
+// keys of a configured keyring carry no times and no file.
+type ringKey struct {
+	key         *SigningKey
+	activatesAt time.Time
+	file        string
+}
+
+var keyring *Keyring
+
+// SetKeyring makes ring the one GenerateJWT signs with and ValidateJWT
+// verifies with. Until it is called tokens use HS256 with JWT_SECRET_KEY.
+func SetKeyring(ring *Keyring) {
+	keyring = ring
+}
+
+func currentKeyring() *Keyring {
+	if keyring != nil {
+		return keyring
+	}
+	key := &SigningKey{Method: jwt.SigningMethodHS256, Private: []byte(os.Getenv("JWT_SECRET_KEY"))}
+	return NewKeyring(key)
+}
+
+// NewKeyring returns a keyring signing with active and still verifying
+// tokens signed with previous.
+func NewKeyring(active *SigningKey, previous ...*SigningKey) *Keyring {
+	ring := &Keyring{}
+	for _, key := range previous {
+		ring.keys = append(ring.keys, ringKey{key: key})
+	}
+	ring.keys = append(ring.keys, ringKey{key: active})
+	return ring
+}
+
+// LoadKeyring loads the keys in dir, which must hold one that is active.
+func LoadKeyring(dir string) (*Keyring, error) {
+	ring := &Keyring{dir: dir}
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Reload reads the key directory again. Keys past MaxTokenLifetime after
+// retiring are skipped.
+func (r *Keyring) Reload() error {
+	keys, err := readKeyDir(r.dir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var loaded []ringKey
+	for i, key := range keys {
+		if i+1 < len(keys) && !keys[i+1].activatesAt.After(now) &&
+			now.After(keys[i+1].activatesAt.Add(MaxTokenLifetime)) {
+			continue
+		}
+		loaded = append(loaded, key)
+	}
+	if len(loaded) == 0 || loaded[0].activatesAt.After(now) {
+		return fmt.Errorf("no active signing key in %s", r.dir)
+	}
+
+	r.mu.Lock()
+	r.keys = loaded
+	r.mu.Unlock()
+	return nil
+}
+
+// Run reloads the key directory every interval until ctx is done, so that
+// keys added by RotateKeys are picked up.
+func (r *Keyring) Run(ctx context.Context, interval time.Duration) {
+	if r.dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := r.Reload(); err != nil {
+			log.Printf("Failed to reload signing keys: %v", err)
+		}
+	}
+}
+
+// signingKey returns the latest key that has become active.
+func (r *Keyring) signingKey() *SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	active := r.keys[0].key
+	for _, k := range r.keys {
+		if k.activatesAt.After(now) {
+			break
+		}
+		active = k.key
+	}
+	return active
+}
+
+// verificationKey finds the key named by kid. Tokens without a kid, signed
+// before keys had IDs, are checked against the signing key.
+func (r *Keyring) verificationKey(kid string) (*SigningKey, error) {
+	if kid == "" {
+		return r.signingKey(), nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.keys {
+		if k.key.ID == kid {
+			return k.key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// JWKS returns the public keys tokens may be verified with, including
+// pending ones.
+func (r *Keyring) JWKS() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range r.keys {
+		if jwk, ok := k.key.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// Status lists the keys, newest first.
+func (r *Keyring) Status() []KeyInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	active := 0
+	for i, k := range r.keys {
+		if !k.activatesAt.After(now) {
+			active = i
+		}
+	}
+
+	var infos []KeyInfo
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		k := r.keys[i]
+		info := KeyInfo{ID: k.key.ID, Algorithm: k.key.Method.Alg()}
+		switch {
+		case i > active:
+			info.Status = KeyPending
+		case i == active:
+			info.Status = KeyActive
+		default:
+			info.Status = KeyRetiring
+		}
+		if !k.activatesAt.IsZero() {
+			info.ActivatesAt = timePtr(k.activatesAt)
+			if i < active {
+				retiredAt := r.keys[i+1].activatesAt
+				info.RetiredAt = timePtr(retiredAt)
+				info.ExpiresAt = timePtr(retiredAt.Add(MaxTokenLifetime))
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// RotateKeys adds a new key for method to dir, becoming active after
+// delay, and deletes keys no longer needed to verify any token.
+func RotateKeys(dir, method string, delay time.Duration) (*KeyInfo, error) {
+	key, data, err := GenerateSigningKey(method)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := readKeyDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	activatesAt := time.Now().Add(delay).UTC().Truncate(time.Second)
+	ext := ".pem"
+	if key.Method == jwt.SigningMethodHS256 {
+		ext = ".key"
+	}
+	name := filepath.Join(dir, activatesAt.Format(keyTimeFormat)+"_"+key.ID+ext)
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i, k := range keys {
+		next := activatesAt
+		if i+1 < len(keys) {
+			next = keys[i+1].activatesAt
+		}
+		if now.After(next.Add(MaxTokenLifetime)) {
+			if err := os.Remove(k.file); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &KeyInfo{ID: key.ID, Algorithm: key.Method.Alg(), Status: KeyPending, ActivatesAt: &activatesAt}, nil
+}
+
+// GenerateSigningKey creates a key for method and returns it with the
+// contents of its key file.
+func GenerateSigningKey(method string) (*SigningKey, []byte, error) {
+	if method == jwt.SigningMethodHS256.Alg() {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		secret := EncodeBase64(b)
+		key, err := hmacKey(secret, "")
+		return key, []byte(secret + "\n"), err
+	}
+
+	var private interface{}
+	var err error
+	switch method {
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256.Alg():
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, fmt.Errorf("unsupported signing method %s", method)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := newSigningKey(method, private, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// readKeyDir loads the keys in dir ordered by activation time.
+func readKeyDir(dir string) ([]ringKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []ringKey
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || (ext != ".pem" && ext != ".key") {
+			continue
+		}
+		stamp, _, _ := strings.Cut(name, "_")
+		activatesAt, err := time.Parse(keyTimeFormat, stamp)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key file names must start with the activation time", name)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		var key *SigningKey
+		if ext == ".key" {
+			key, err = hmacKey(strings.TrimSpace(string(data)), "")
+		} else {
+			key, err = parseKeyFile(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		keys = append(keys, ringKey{key: key, activatesAt: activatesAt, file: filepath.Join(dir, name)})
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].activatesAt.Before(keys[j].activatesAt) })
+	return keys, nil
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
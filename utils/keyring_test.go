@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKey adds a key for method to dir that becomes active at activatesAt.
+func writeKey(t *testing.T, dir, method string, activatesAt time.Time) *SigningKey {
+	t.Helper()
+	key, data, err := GenerateSigningKey(method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := ".pem"
+	if method == "HS256" {
+		ext = ".key"
+	}
+	name := activatesAt.UTC().Format(keyTimeFormat) + "_" + key.ID + ext
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKeyringActivation(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	expired := writeKey(t, dir, "ES256", now.Add(-30*24*time.Hour))
+	retiring := writeKey(t, dir, "RS256", now.Add(-20*24*time.Hour))
+	active := writeKey(t, dir, "ES256", now.Add(-2*24*time.Hour))
+	pending := writeKey(t, dir, "EdDSA", now.Add(time.Hour))
+
+	ring, err := LoadKeyring(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ring.signingKey(); got.ID != active.ID {
+		t.Errorf("signing with %s, want the active key %s", got.ID, active.ID)
+	}
+	if got, err := ring.verificationKey(""); err != nil || got.ID != active.ID {
+		t.Errorf("token without kid checked against %v, %v; want the active key", got, err)
+	}
+	for _, key := range []*SigningKey{retiring, active, pending} {
+		if _, err := ring.verificationKey(key.ID); err != nil {
+			t.Errorf("kid %s: %v", key.ID, err)
+		}
+	}
+	if _, err := ring.verificationKey(expired.ID); err == nil {
+		t.Error("expired key still verifies tokens")
+	}
+
+	published := make(map[string]bool)
+	for _, jwk := range ring.JWKS().Keys {
+		published[jwk.KeyID] = true
+	}
+	if len(published) != 3 || !published[retiring.ID] || !published[active.ID] || !published[pending.ID] {
+		t.Errorf("JWKS publishes %v, want the retiring, active and pending keys", published)
+	}
+
+	statuses := ring.Status()
+	wantStatuses := []struct {
+		id     string
+		status string
+	}{
+		{pending.ID, KeyPending},
+		{active.ID, KeyActive},
+		{retiring.ID, KeyRetiring},
+	}
+	if len(statuses) != len(wantStatuses) {
+		t.Fatalf("statuses %+v", statuses)
+	}
+	for i, want := range wantStatuses {
+		if statuses[i].ID != want.id || statuses[i].Status != want.status {
+			t.Errorf("status %d: %s %s, want %s %s", i, statuses[i].ID, statuses[i].Status, want.id, want.status)
+		}
+	}
+	if retired := statuses[2].RetiredAt; retired == nil || !retired.Equal(*statuses[1].ActivatesAt) {
+		t.Errorf("retiring key retired at %v, want when the active key activated", retired)
+	}
+}
+
+func TestKeyringNoActiveKey(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "ES256", time.Now().Add(time.Hour))
+	if _, err := LoadKeyring(dir); err == nil {
+		t.Error("loaded a keyring whose only key is pending")
+	}
+	if _, err := LoadKeyring(t.TempDir()); err == nil {
+		t.Error("loaded an empty keyring")
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+	dir := t.TempDir()
+	expired := writeKey(t, dir, "HS256", time.Now().Add(-30*24*time.Hour))
+	first := writeKey(t, dir, "HS256", time.Now().Add(-20*24*time.Hour))
+	ring, err := LoadKeyring(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(ring)
+	t.Cleanup(func() { SetKeyring(nil) })
+
+	oldToken, _, err := GenerateJWT(JWTClaim{UserID: 1}, "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := RotateKeys(dir, "ES256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != KeyPending || info.Algorithm != "ES256" {
+		t.Errorf("rotated key %+v", info)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*_"+expired.ID+".key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Error("expired key file kept")
+	}
+
+	if got := ring.signingKey(); got.ID != first.ID {
+		t.Fatalf("signing with %s before reloading", got.ID)
+	}
+	if err := ring.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ring.signingKey(); got.ID != info.ID {
+		t.Errorf("signing with %s after reloading, want the rotated key %s", got.ID, info.ID)
+	}
+	if SigningAlgorithm() != "ES256" {
+		t.Errorf("signing algorithm %s, want ES256", SigningAlgorithm())
+	}
+
+	newToken, _, err := GenerateJWT(JWTClaim{UserID: 1}, "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"before rotation": oldToken, "after rotation": newToken} {
+		if _, err := ValidateJWT(token, AccessToken); err != nil {
+			t.Errorf("token signed %s rejected: %v", name, err)
+		}
+	}
+}
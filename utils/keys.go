@@ -0,0 +1,321 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey signs and verifies tokens with one algorithm. For HS256 the
+// key is the shared secret; otherwise Private holds the private key and
+// Public its public half, which JWKS publishes under ID.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+// JWK is a public key in JSON Web Key form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadSigningKey builds the key for method, one of HS256, RS256, ES256 or
+// EdDSA. HS256 uses secret; the others read a PEM private key, PKCS #8 or
+// the PKCS #1 and SEC 1 forms, from keyFile. An empty keyID is replaced by
+// the RFC 7638 thumbprint of the key.
+func LoadSigningKey(method, secret, keyFile, keyID string) (*SigningKey, error) {
+	if method == jwt.SigningMethodHS256.Alg() {
+		if secret == "" {
+			return nil, errors.New("JWT_SECRET_KEY is required for HS256")
+		}
+		return hmacKey(secret, keyID)
+	}
+
+	if keyFile == "" {
+		return nil, fmt.Errorf("a private key file is required for %s", method)
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	private, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyFile, err)
+	}
+	return newSigningKey(method, private, keyID)
+}
+
+// LoadKeyFile loads a PEM private key, choosing the signing method by its
+// type.
+func LoadKeyFile(keyFile string) (*SigningKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseKeyFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyFile, err)
+	}
+	return key, nil
+}
+
+func parseKeyFile(data []byte) (*SigningKey, error) {
+	private, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	var method string
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256.Alg()
+	case *ecdsa.PrivateKey:
+		method = jwt.SigningMethodES256.Alg()
+	default:
+		method = jwt.SigningMethodEdDSA.Alg()
+	}
+	return newSigningKey(method, private, "")
+}
+
+func newSigningKey(method string, private interface{}, keyID string) (*SigningKey, error) {
+	key := &SigningKey{ID: keyID, Private: private}
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 needs a P-256 key")
+		}
+		key.Method, key.Public = jwt.SigningMethodES256, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+	if key.Method.Alg() != method {
+		return nil, fmt.Errorf("a %s key cannot sign %s", key.Method.Alg(), method)
+	}
+
+	if key.ID == "" {
+		thumbprint, err := key.thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		key.ID = thumbprint
+	}
+	return key, nil
+}
+
+func hmacKey(secret, keyID string) (*SigningKey, error) {
+	key := &SigningKey{ID: keyID, Method: jwt.SigningMethodHS256, Private: []byte(secret)}
+	if key.ID == "" {
+		thumbprint, err := key.thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		key.ID = thumbprint
+	}
+	return key, nil
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unrecognized private key")
+}
+
+// JWK returns the public key in JWK form; ok is false for HS256 keys,
+// which have nothing to publish.
+func (k *SigningKey) JWK() (JWK, bool) {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = EncodeBase64(pub.N.Bytes())
+		jwk.E = EncodeBase64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = EncodeBase64(pub.X.FillBytes(make([]byte, 32)))
+		jwk.Y = EncodeBase64(pub.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = EncodeBase64(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// ParseJWK reads a public key published by another issuer. A key without
+// alg is given the one this package would use for its type.
+func ParseJWK(jwk JWK) (*SigningKey, error) {
+	key := &SigningKey{ID: jwk.KeyID}
+	switch {
+	case jwk.KeyType == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.Public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	case jwk.KeyType == "EC" && jwk.Curve == "P-256":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 key")
+		}
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		key.Method = jwt.SigningMethodES256
+		key.Public = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case jwk.KeyType == "OKP" && jwk.Curve == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		key.Method, key.Public = jwt.SigningMethodEdDSA, ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s %s", jwk.KeyType, jwk.Curve)
+	}
+
+	if jwk.Algorithm != "" && jwk.Algorithm != key.Method.Alg() {
+		method := jwt.GetSigningMethod(jwk.Algorithm)
+		if _, ok := method.(*jwt.SigningMethodRSA); !ok || jwk.KeyType != "RSA" {
+			return nil, fmt.Errorf("unsupported algorithm %s for a %s key", jwk.Algorithm, jwk.KeyType)
+		}
+		key.Method = method
+	}
+	return key, nil
+}
+
+// VerifyWith checks the signature of a token signed with method; see
+// jwt.Keyfunc.
+func (k *SigningKey) VerifyWith(method jwt.SigningMethod) (interface{}, error) {
+	if k.Public == nil {
+		return nil, errors.New("not a public key")
+	}
+	return k.verificationKey(method)
+}
+
+// thumbprint hashes the required members of the JWK in lexical order, as
+// RFC 7638 specifies.
+func (k *SigningKey) thumbprint() (string, error) {
+	jwk, ok := k.JWK()
+	if !ok {
+		jwk = JWK{KeyType: "oct"}
+	}
+
+	var members interface{}
+	switch jwk.KeyType {
+	case "oct":
+		members = struct {
+			K   string `json:"k"`
+			Kty string `json:"kty"`
+		}{EncodeBase64(k.Private.([]byte)), jwk.KeyType}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return EncodeBase64(sum[:]), nil
+}
+
+// verificationKey returns the key to check a token signed with method, so
+// that a token cannot pick an algorithm the key was not meant for.
+func (k *SigningKey) verificationKey(method jwt.SigningMethod) (interface{}, error) {
+	if method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", method.Alg())
+	}
+	if k.Public != nil {
+		return k.Public, nil
+	}
+	return k.Private, nil
+}
+
+// EncodeBase64 encodes data in unpadded base64url, as JOSE uses it.
+func EncodeBase64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
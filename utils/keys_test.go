@@ -0,0 +1,292 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var signingMethods = []string{"HS256", "RS256", "ES256", "EdDSA"}
+
+func TestThumbprintRFC7638(t *testing.T) {
+	// The example key of RFC 7638, section 3.1.
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &SigningKey{
+		Method: jwt.SigningMethodRS256,
+		Public: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537},
+	}
+
+	thumbprint, err := key.thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; thumbprint != want {
+		t.Errorf("thumbprint %s, want %s", thumbprint, want)
+	}
+}
+
+func TestKeyIDs(t *testing.T) {
+	for _, method := range signingMethods {
+		t.Run(method, func(t *testing.T) {
+			key, data, err := GenerateSigningKey(method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			thumbprint, err := key.thumbprint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.ID != thumbprint {
+				t.Errorf("kid %s, want the thumbprint %s", key.ID, thumbprint)
+			}
+
+			secret, keyFile := "", ""
+			if method == "HS256" {
+				secret = string(data[:len(data)-1])
+			} else {
+				keyFile = filepath.Join(t.TempDir(), "key.pem")
+				if err := os.WriteFile(keyFile, data, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			loaded, err := LoadSigningKey(method, secret, keyFile, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.ID != key.ID {
+				t.Errorf("loaded kid %s, want %s", loaded.ID, key.ID)
+			}
+			named, err := LoadSigningKey(method, secret, keyFile, "configured")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if named.ID != "configured" {
+				t.Errorf("configured kid replaced by %s", named.ID)
+			}
+		})
+	}
+}
+
+func TestLoadSigningKeyFormats(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := x509.MarshalECPrivateKey(p384Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		block   *pem.Block
+		wantErr bool
+	}{
+		{"PKCS #1 RSA", "RS256", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, false},
+		{"SEC 1 EC", "ES256", &pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}, false},
+		{"key for another method", "ES256", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, true},
+		{"P-384 key", "ES256", &pem.Block{Type: "EC PRIVATE KEY", Bytes: p384}, true},
+		{"not a key", "RS256", &pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyFile := filepath.Join(t.TempDir(), "key.pem")
+			if err := os.WriteFile(keyFile, pem.EncodeToMemory(tt.block), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			key, err := LoadSigningKey(tt.method, "", keyFile, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && key.Method.Alg() != tt.method {
+				t.Errorf("method %s, want %s", key.Method.Alg(), tt.method)
+			}
+		})
+	}
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	for _, method := range signingMethods {
+		t.Run(method, func(t *testing.T) {
+			key, _, err := GenerateSigningKey(method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jwk, ok := key.JWK()
+			if method == "HS256" {
+				if ok {
+					t.Errorf("HS256 secret published as %+v", jwk)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("no JWK")
+			}
+			if jwk.KeyID != key.ID || jwk.Algorithm != method || jwk.Use != "sig" {
+				t.Errorf("JWK kid %s alg %s use %s", jwk.KeyID, jwk.Algorithm, jwk.Use)
+			}
+
+			parsed, err := ParseJWK(jwk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := key.sign(jwt.RegisteredClaims{Subject: "1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+				return parsed.VerifyWith(token.Method)
+			}); err != nil {
+				t.Errorf("token not verified with the published key: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseJWKAlgorithm(t *testing.T) {
+	rsaKey, _, err := GenerateSigningKey("RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, _, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK, _ := rsaKey.JWK()
+	ecJWK, _ := ecKey.JWK()
+
+	tests := []struct {
+		name    string
+		jwk     JWK
+		alg     string
+		want    string
+		wantErr bool
+	}{
+		{"RSA without alg", rsaJWK, "", "RS256", false},
+		{"RSA with RS384", rsaJWK, "RS384", "RS384", false},
+		{"RSA with HS256", rsaJWK, "HS256", "", true},
+		{"EC with RS256", ecJWK, "RS256", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk := tt.jwk
+			jwk.Algorithm = tt.alg
+			key, err := ParseJWK(jwk)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && key.Method.Alg() != tt.want {
+				t.Errorf("method %s, want %s", key.Method.Alg(), tt.want)
+			}
+		})
+	}
+}
+
+func TestVerificationKeyMethod(t *testing.T) {
+	rsaKey, _, err := GenerateSigningKey("RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacKey, _, err := GenerateSigningKey("HS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     *SigningKey
+		method  jwt.SigningMethod
+		wantErr bool
+	}{
+		{"RS256 key, RS256 token", rsaKey, jwt.SigningMethodRS256, false},
+		{"RS256 key, HS256 token", rsaKey, jwt.SigningMethodHS256, true},
+		{"RS256 key, ES256 token", rsaKey, jwt.SigningMethodES256, true},
+		{"HS256 key, HS256 token", hmacKey, jwt.SigningMethodHS256, false},
+		{"HS256 key, RS256 token", hmacKey, jwt.SigningMethodRS256, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.key.verificationKey(tt.method); (err != nil) != tt.wantErr {
+				t.Errorf("error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// An HS256 token whose secret is the RSA public key, which anyone can read
+// from the JWKS, must not pass for one signed with the private key.
+func TestValidateJWTRejectsHS256WithRSAPublicKey(t *testing.T) {
+	key, _, err := GenerateSigningKey("RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyring(NewKeyring(key))
+	t.Cleanup(func() { SetKeyring(nil) })
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	claims := JWTClaim{
+		UserID: 1,
+		Type:   AccessToken,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+
+	for _, kid := range []string{key.ID, ""} {
+		for _, secret := range [][]byte{publicPEM, der} {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+			if kid != "" {
+				token.Header["kid"] = kid
+			}
+			forged, err := token.SignedString(secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ValidateJWT(forged, AccessToken); err == nil {
+				t.Errorf("kid %q: HS256 token signed with the public key accepted", kid)
+			}
+		}
+	}
+
+	genuine, err := key.sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(genuine, AccessToken); err != nil {
+		t.Errorf("RS256 token rejected: %v", err)
+	}
+}